@@ -1,3 +0,0 @@
-db = db.getSiblingDB('date');
-db.createCollection('users');
-db.users.createIndex({ location: "2dsphere" });
\ No newline at end of file
@@ -1,20 +1,41 @@
 package app
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+
 	"github.com/brianvoe/gofakeit/v7"
+	"github.com/muzzapp/date-api/internal/auth"
 	"github.com/muzzapp/date-api/internal/config"
+	"github.com/muzzapp/date-api/internal/mailer"
+	"github.com/muzzapp/date-api/internal/storage/memory"
 	"github.com/muzzapp/date-api/internal/storage/mongoclient"
 	"github.com/muzzapp/date-api/internal/storage/persistence"
+	"github.com/muzzapp/date-api/internal/storage/postgres"
+	"github.com/muzzapp/date-api/internal/storage/sqlite"
 	"github.com/muzzapp/date-api/internal/users"
 	"github.com/muzzapp/date-api/internal/web"
 )
 
 type Config struct {
 	GRPCUrl string `envconfig:"GRPC_URL" default:"http://localhost:80"`
+	// StorageBackend is mongo, postgres, sqlite for a single node, or memory to run without a database,
+	// the memory data is lost on restart
+	StorageBackend string `envconfig:"STORAGE_BACKEND" default:"mongo"`
+}
+
+// Store is every store the services need, implemented by each storage backend.
+type Store interface {
+	users.Store
+	users.AttemptStore
+	users.TokenStore
+	auth.Store
 }
 
 type App struct {
-	srv *web.Server
+	srv         *web.Server
+	userService *users.Service
 }
 
 func New() (*App, error) {
@@ -24,26 +45,146 @@ func New() (*App, error) {
 	}
 
 	// init clients
-	mongoClient, err := mongoclient.GetDatabase()
+	store, err := newStore(c)
 	if err != nil {
 		return nil, err
 	}
-	store := persistence.New(mongoClient)
 	faker := gofakeit.New(0)
 
+	authConf := &auth.Config{}
+	if err = config.Load(authConf); err != nil {
+		return nil, err
+	}
+	keys, err := auth.NewKeySet(authConf)
+	if err != nil {
+		return nil, err
+	}
+
+	lockoutConf := &users.LockoutConfig{}
+	if err = config.Load(lockoutConf); err != nil {
+		return nil, err
+	}
+
+	accountConf := &users.AccountConfig{}
+	if err = config.Load(accountConf); err != nil {
+		return nil, err
+	}
+	twoFactorConf := &users.TwoFactorConfig{}
+	if err = config.Load(twoFactorConf); err != nil {
+		return nil, err
+	}
+	deletionConf := &users.DeletionConfig{}
+	if err = config.Load(deletionConf); err != nil {
+		return nil, err
+	}
+	mailerConf := &mailer.Config{}
+	if err = config.Load(mailerConf); err != nil {
+		return nil, err
+	}
+	mail, err := mailer.New(mailerConf)
+	if err != nil {
+		return nil, err
+	}
+
 	// init service/business
-	userService := users.NewService(faker, store)
+	userOpts := []users.Option{
+		users.WithLoginLockout(store, lockoutConf),
+		users.WithAccountRecovery(store, mail, accountConf),
+		users.WithAccountDeletion(deletionConf),
+	}
+	// the TOTP login stays disabled until a key seals its secrets
+	if twoFactorConf.Key != "" {
+		twoFactorKey, err := users.NewTwoFactorKey(twoFactorConf)
+		if err != nil {
+			return nil, err
+		}
+		userOpts = append(userOpts, users.WithTwoFactor(store, twoFactorConf, twoFactorKey))
+	}
+	userService := users.NewService(faker, store, userOpts...)
+	authService := auth.NewService(authConf, keys, store, userService)
 
 	// init web layer
-	srv, err := web.New(userService)
+	srv, err := web.New(userService, authService)
 	if err != nil {
 		return nil, err
 	}
 	return &App{
-		srv: srv,
+		srv:         srv,
+		userService: userService,
 	}, nil
 }
 
+func newStore(c *Config) (Store, error) {
+	switch c.StorageBackend {
+	case "mongo":
+		mongoClient, err := mongoclient.GetDatabase()
+		if err != nil {
+			return nil, err
+		}
+		warnPendingMigrations(context.Background(), persistence.NewMigrator(mongoClient))
+		return persistence.New(mongoClient), nil
+	case "postgres":
+		conf := &postgres.Config{}
+		if err := config.Load(conf); err != nil {
+			return nil, err
+		}
+		ctx := context.Background()
+		pool, err := postgres.Connect(ctx, conf)
+		if err != nil {
+			return nil, err
+		}
+		if err = postgres.Migrate(ctx, pool); err != nil {
+			pool.Close()
+			return nil, err
+		}
+		return postgres.New(pool), nil
+	case "sqlite":
+		conf := &sqlite.Config{}
+		if err := config.Load(conf); err != nil {
+			return nil, err
+		}
+		ctx := context.Background()
+		db, err := sqlite.Open(ctx, conf)
+		if err != nil {
+			return nil, err
+		}
+		if err = sqlite.Migrate(ctx, db); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		return sqlite.New(db), nil
+	case "memory":
+		return memory.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", c.StorageBackend)
+	}
+}
+
 func (a *App) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.userService.RunPurge(ctx)
+	// the mails still being sent are not lost on shutdown
+	defer a.userService.Wait()
+
 	return a.srv.Serve()
 }
+
+// warnPendingMigrations logs the MongoDB migrations not applied yet, they are run with date-api migrate rather than
+// on start since some rewrite every user.
+func warnPendingMigrations(ctx context.Context, migrator *persistence.Migrator) {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		slog.Error("newStore MigrationStatus", "err", err)
+		return
+	}
+	var pending []int32
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, status.Version)
+		}
+	}
+	if len(pending) > 0 {
+		slog.Warn("pending mongodb migrations, run date-api migrate", "versions", pending)
+	}
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/config"
+	"github.com/muzzapp/date-api/internal/storage/mongoclient"
+	"github.com/muzzapp/date-api/internal/storage/persistence"
+	"github.com/muzzapp/date-api/internal/storage/postgres"
+	"github.com/muzzapp/date-api/internal/storage/sqlite"
+)
+
+var errMigrateUsage = errors.New("usage: date-api migrate [up [version] | down <version> | status]")
+
+// Migrate runs the migrate subcommand against the storage backend of STORAGE_BACKEND:
+//
+//	migrate [up [version]]  applies the pending migrations, up to version when given
+//	migrate down <version>  reverts the migrations applied after version, 0 reverts them all
+//	migrate status          lists the migrations and when they were applied
+//
+// PostgreSQL and SQLite are also migrated on start and only support up.
+func Migrate(ctx context.Context, args []string, out io.Writer) error {
+	command, version, err := parseMigrateArgs(args)
+	if err != nil {
+		return err
+	}
+	c := &Config{}
+	if err = config.Load(c); err != nil {
+		return err
+	}
+
+	switch c.StorageBackend {
+	case "mongo":
+		db, err := mongoclient.GetDatabase()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = db.Client().Disconnect(context.WithoutCancel(ctx))
+		}()
+		return migrateMongo(ctx, persistence.NewMigrator(db), command, version, out)
+	case "postgres":
+		if command != "up" || version != 0 {
+			return errors.New("postgres only supports migrate up")
+		}
+		conf := &postgres.Config{}
+		if err = config.Load(conf); err != nil {
+			return err
+		}
+		pool, err := postgres.Connect(ctx, conf)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		return postgres.Migrate(ctx, pool)
+	case "sqlite":
+		if command != "up" || version != 0 {
+			return errors.New("sqlite only supports migrate up")
+		}
+		conf := &sqlite.Config{}
+		if err = config.Load(conf); err != nil {
+			return err
+		}
+		db, err := sqlite.Open(ctx, conf)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return sqlite.Migrate(ctx, db)
+	case "memory":
+		return errors.New("the memory backend has nothing to migrate")
+	default:
+		return fmt.Errorf("unknown storage backend %q", c.StorageBackend)
+	}
+}
+
+// parseMigrateArgs returns the command and its version, zero when omitted.
+func parseMigrateArgs(args []string) (string, int32, error) {
+	if len(args) == 0 {
+		return "up", 0, nil
+	}
+	command, args := args[0], args[1:]
+	switch {
+	case command == "status" && len(args) == 0:
+		return command, 0, nil
+	case command == "up" && len(args) == 0:
+		return command, 0, nil
+	case (command == "up" || command == "down") && len(args) == 1:
+		version, err := strconv.ParseInt(args[0], 10, 32)
+		if err != nil || version < 0 {
+			return "", 0, errMigrateUsage
+		}
+		return command, int32(version), nil
+	default:
+		return "", 0, errMigrateUsage
+	}
+}
+
+func migrateMongo(ctx context.Context, migrator *persistence.Migrator, command string, version int32, out io.Writer) error {
+	switch command {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "VERSION\tAPPLIED\tDESCRIPTION")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			_, _ = fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, applied, status.Description)
+		}
+		return w.Flush()
+	case "up":
+		done, err := migrator.Up(ctx, version)
+		printMigrations(out, "applied", done)
+		return err
+	default:
+		done, err := migrator.Down(ctx, version)
+		printMigrations(out, "reverted", done)
+		return err
+	}
+}
+
+func printMigrations(out io.Writer, verb string, migrations []persistence.Migration) {
+	if len(migrations) == 0 {
+		_, _ = fmt.Fprintln(out, "nothing to migrate")
+	}
+	for _, migration := range migrations {
+		_, _ = fmt.Fprintf(out, "%s %d %s\n", verb, migration.Version, migration.Description)
+	}
+}
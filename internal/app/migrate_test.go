@@ -0,0 +1,36 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMigrateArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		command string
+		version int32
+		err     error
+	}{
+		{name: "up by default", command: "up"},
+		{name: "up to a version", args: []string{"up", "3"}, command: "up", version: 3},
+		{name: "down to a version", args: []string{"down", "0"}, command: "down"},
+		{name: "status", args: []string{"status"}, command: "status"},
+		{name: "down needs a version", args: []string{"down"}, err: errMigrateUsage},
+		{name: "version must be a number", args: []string{"up", "latest"}, err: errMigrateUsage},
+		{name: "unknown command", args: []string{"redo"}, err: errMigrateUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			command, version, err := parseMigrateArgs(tt.args)
+
+			// then
+			require.ErrorIs(t, err, tt.err)
+			require.Equal(t, tt.command, command)
+			require.Equal(t, tt.version, version)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+// Claims are the claims of the access tokens, the user ID is the subject.
+type Claims struct {
+	Name  string       `json:"name"`
+	Roles []users.Role `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+func newClaims(user *users.User) *Claims {
+	return &Claims{
+		Name:  user.Name,
+		Roles: []users.Role{user.Role},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: strconv.FormatInt(int64(user.ID), 10),
+		},
+	}
+}
+
+// UserID parses the subject, it fails on tokens without a numeric subject.
+func (c *Claims) UserID() (int32, error) {
+	ID, err := strconv.ParseInt(c.Subject, 10, 32)
+	if err != nil {
+		return 0, ErrInvalidClaims
+	}
+	return int32(ID), nil
+}
+
+func (c *Claims) HasRole(role users.Role) bool {
+	return slices.Contains(c.Roles, role)
+}
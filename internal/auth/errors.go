@@ -0,0 +1,12 @@
+package auth
+
+import "errors"
+
+var (
+	ErrInvalidRefreshToken  = errors.New("invalid refresh token")
+	ErrRefreshTokenNotFound = errors.New("db refresh token not found")
+	ErrInvalidSigningKey    = errors.New("invalid signing key")
+	ErrUnknownSigningKey    = errors.New("unknown signing key")
+	ErrInvalidClaims        = errors.New("invalid token claims")
+	ErrTokenRevoked         = errors.New("token revoked")
+)
@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+//go:generate mockgen -source=interfaces.go -destination=interfaces_mock.go -package=auth
+
+type Store interface {
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	GetRefreshToken(ctx context.Context, ID string) (*RefreshToken, error)
+	// RevokeRefreshToken reports whether the token was still active, so only one of concurrent refreshes wins.
+	RevokeRefreshToken(ctx context.Context, ID string, now time.Time) (bool, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string, now time.Time) error
+	RevokeUserRefreshTokens(ctx context.Context, userID int32, now time.Time) error
+	RevokeAccessToken(ctx context.Context, token *RevokedToken) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+type Users interface {
+	GetActiveUser(ctx context.Context, ID int32) (*users.User, error)
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a signing key loaded from a PEM file, keys with only a public part verify the tokens signed before
+// a rotation but cannot sign new ones.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet signs the access tokens with one key and verifies them against every key, so keys can be rotated
+// without invalidating the tokens already issued.
+type KeySet struct {
+	secret  []byte
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeySet loads the keys of conf. Tokens are signed with the SigningKeyID key when set, with HS256 and Secret
+// otherwise. HS256 tokens are verified as long as Secret is set.
+func NewKeySet(conf *Config) (*KeySet, error) {
+	set := &KeySet{
+		secret: []byte(conf.Secret),
+		keys:   make(map[string]*Key, len(conf.Keys)),
+	}
+	for ID, path := range conf.Keys {
+		key, err := loadKey(ID, path)
+		if err != nil {
+			return nil, err
+		}
+		set.keys[ID] = key
+	}
+
+	switch {
+	case conf.SigningKeyID != "":
+		key, ok := set.keys[conf.SigningKeyID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is not one of JWT_KEYS", ErrInvalidSigningKey, conf.SigningKeyID)
+		}
+		if key.Private == nil {
+			return nil, fmt.Errorf("%w: %s has no private key", ErrInvalidSigningKey, conf.SigningKeyID)
+		}
+		set.signing = key
+	case len(set.secret) == 0:
+		return nil, fmt.Errorf("%w: set SECRET or JWT_SIGNING_KEY_ID", ErrInvalidSigningKey)
+	}
+	return set, nil
+}
+
+func loadKey(ID, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key %s: %w", ID, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %s is not PEM encoded", ErrInvalidSigningKey, ID)
+	}
+
+	key := &Key{ID: ID}
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse key %s: %w", ID, err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s type is not supported", ErrInvalidSigningKey, ID)
+		}
+		key.Private, key.Public = signer, signer.Public()
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse key %s: %w", ID, err)
+		}
+		key.Private, key.Public = private, private.Public()
+	case "PUBLIC KEY":
+		if key.Public, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("parse key %s: %w", ID, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s PEM type %s is not supported", ErrInvalidSigningKey, ID, block.Type)
+	}
+
+	switch key.Public.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%w: %s must be an RSA or Ed25519 key", ErrInvalidSigningKey, ID)
+	}
+	return key, nil
+}
+
+func (k *KeySet) sign(claims jwt.Claims) (string, error) {
+	if k.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+	}
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	token.Header["kid"] = k.signing.ID
+	return token.SignedString(k.signing.Private)
+}
+
+// Keyfunc picks the key verifying a token from its kid, the algorithm of the token must be the one of the key
+// so a public key can never be used as an HMAC secret.
+func (k *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if token.Method != jwt.SigningMethodHS256 || len(k.secret) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSigningKey, token.Method.Alg())
+		}
+		return k.secret, nil
+	}
+	ID, _ := token.Header["kid"].(string)
+	key, ok := k.keys[ID]
+	if !ok || key.Method.Alg() != token.Method.Alg() {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSigningKey, ID)
+	}
+	return key.Public, nil
+}
+
+// JWKS is the JSON Web Key Set of the public keys, HS256 has no public key so it is never published.
+type JWKS struct {
+	Keys []*JWK `json:"keys"`
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+func (k *KeySet) JWKS() *JWKS {
+	jwks := &JWKS{Keys: make([]*JWK, 0, len(k.keys))}
+	for _, key := range k.keys {
+		jwk := &JWK{ID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].ID < jwks.Keys[j].ID
+	})
+	return jwks
+}
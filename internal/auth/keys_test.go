@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func writePrivateKey(t *testing.T, dir, name string, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	return path
+}
+
+func writePublicKey(t *testing.T, dir, name string, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+	return path
+}
+
+func parse(t *testing.T, keys *KeySet, token string) (*jwt.Token, error) {
+	t.Helper()
+	return jwt.Parse(token, keys.Keyfunc)
+}
+
+func TestKeySet(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	oldRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyFiles := map[string]string{
+		"rsa-1": writePrivateKey(t, dir, "rsa-1.pem", rsaKey),
+		"ed-1":  writePrivateKey(t, dir, "ed-1.pem", edPrivate),
+		"rsa-0": writePublicKey(t, dir, "rsa-0.pem", &oldRSAKey.PublicKey),
+	}
+	claims := jwt.MapClaims{"id": 1}
+
+	t.Run("a signing key or a secret is required", func(t *testing.T) {
+		// when
+		_, err := NewKeySet(&Config{})
+
+		// then
+		require.ErrorIs(t, err, ErrInvalidSigningKey)
+	})
+
+	t.Run("public keys cannot sign", func(t *testing.T) {
+		// when
+		_, err := NewKeySet(&Config{Keys: keyFiles, SigningKeyID: "rsa-0"})
+
+		// then
+		require.ErrorIs(t, err, ErrInvalidSigningKey)
+	})
+
+	t.Run("HS256 with the secret", func(t *testing.T) {
+		// given
+		keys, err := NewKeySet(&Config{Secret: "secret"})
+		require.NoError(t, err)
+
+		// when
+		token, err := keys.sign(claims)
+		require.NoError(t, err)
+
+		// then
+		parsed, err := parse(t, keys, token)
+		require.NoError(t, err)
+		require.Equal(t, jwt.SigningMethodHS256, parsed.Method)
+	})
+
+	for ID, method := range map[string]jwt.SigningMethod{"rsa-1": jwt.SigningMethodRS256, "ed-1": jwt.SigningMethodEdDSA} {
+		t.Run(method.Alg()+" with the signing key", func(t *testing.T) {
+			// given
+			keys, err := NewKeySet(&Config{Keys: keyFiles, SigningKeyID: ID})
+			require.NoError(t, err)
+
+			// when
+			token, err := keys.sign(claims)
+			require.NoError(t, err)
+
+			// then
+			parsed, err := parse(t, keys, token)
+			require.NoError(t, err)
+			require.Equal(t, method, parsed.Method)
+			require.Equal(t, ID, parsed.Header["kid"])
+		})
+	}
+
+	t.Run("tokens signed before a rotation are still verified", func(t *testing.T) {
+		// given
+		before, err := NewKeySet(&Config{Keys: keyFiles, SigningKeyID: "rsa-1"})
+		require.NoError(t, err)
+		token, err := before.sign(claims)
+		require.NoError(t, err)
+
+		// when
+		after, err := NewKeySet(&Config{Keys: keyFiles, SigningKeyID: "ed-1"})
+		require.NoError(t, err)
+
+		// then
+		_, err = parse(t, after, token)
+		require.NoError(t, err)
+	})
+
+	t.Run("HS256 tokens are rejected without a secret", func(t *testing.T) {
+		// given
+		keys, err := NewKeySet(&Config{Keys: keyFiles, SigningKeyID: "rsa-1"})
+		require.NoError(t, err)
+		der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+		require.NoError(t, err)
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		forged.Header["kid"] = "rsa-1"
+		token, err := forged.SignedString(der)
+		require.NoError(t, err)
+
+		// when
+		_, err = parse(t, keys, token)
+
+		// then
+		require.ErrorIs(t, err, ErrUnknownSigningKey)
+	})
+
+	t.Run("algorithm must match the key", func(t *testing.T) {
+		// given
+		keys, err := NewKeySet(&Config{Keys: keyFiles, SigningKeyID: "rsa-1"})
+		require.NoError(t, err)
+		forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		forged.Header["kid"] = "rsa-1"
+		token, err := forged.SignedString(edPrivate)
+		require.NoError(t, err)
+
+		// when
+		_, err = parse(t, keys, token)
+
+		// then
+		require.ErrorIs(t, err, ErrUnknownSigningKey)
+	})
+
+	t.Run("JWKS publishes every public key", func(t *testing.T) {
+		// given
+		keys, err := NewKeySet(&Config{Secret: "secret", Keys: keyFiles, SigningKeyID: "ed-1"})
+		require.NoError(t, err)
+
+		// when
+		jwks := keys.JWKS()
+
+		// then
+		require.Len(t, jwks.Keys, 3)
+		require.Equal(t, &JWK{
+			KeyType:   "OKP",
+			ID:        "ed-1",
+			Use:       "sig",
+			Algorithm: "EdDSA",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(edPublic),
+		}, jwks.Keys[0])
+		require.Equal(t, "rsa-0", jwks.Keys[1].ID)
+		require.Equal(t, "RS256", jwks.Keys[2].Algorithm)
+		require.Equal(t, "AQAB", jwks.Keys[2].E)
+	})
+}
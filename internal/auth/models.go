@@ -0,0 +1,27 @@
+package auth
+
+import "time"
+
+// Tokens are handed to a client at login and on every refresh.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// RefreshToken is stored hashed, only the client knows the token itself. The tokens rotated from the same login
+// share a FamilyID so reusing a rotated token revokes the whole family.
+type RefreshToken struct {
+	ID        string     `bson:"_id"`
+	FamilyID  string     `bson:"familyID"`
+	UserID    int32      `bson:"userID"`
+	ExpiresAt time.Time  `bson:"expiresAt"`
+	CreatedAt time.Time  `bson:"createdAt"`
+	RevokedAt *time.Time `bson:"revokedAt,omitempty"`
+}
+
+// RevokedToken is the ID of an access token revoked before its expiry, it can be forgotten once expired.
+type RevokedToken struct {
+	JTI       string    `bson:"_id"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
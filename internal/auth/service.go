@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/muzzapp/date-api/internal/securetoken"
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+type Config struct {
+	// Secret signs and verifies HS256 tokens, it can be left empty once every service uses the signing keys
+	Secret string `envconfig:"SECRET"`
+	// Keys maps key IDs to PEM files as id:path,id:path, RSA and Ed25519 keys are supported
+	Keys map[string]string `envconfig:"JWT_KEYS"`
+	// SigningKeyID is the key of Keys signing new tokens, Secret is used when empty
+	SigningKeyID string `envconfig:"JWT_SIGNING_KEY_ID"`
+	// Issuer and Audience are set on every token and required when verifying them
+	Issuer          string        `envconfig:"JWT_ISSUER" default:"date-api"`
+	Audience        string        `envconfig:"JWT_AUDIENCE" default:"date-api"`
+	AccessTokenTTL  time.Duration `envconfig:"ACCESS_TOKEN_TTL" default:"15m"`
+	RefreshTokenTTL time.Duration `envconfig:"REFRESH_TOKEN_TTL" default:"720h"`
+}
+
+type Service struct {
+	conf  *Config
+	keys  *KeySet
+	store Store
+	users Users
+}
+
+func NewService(conf *Config, keys *KeySet, store Store, users Users) *Service {
+	return &Service{
+		conf:  conf,
+		keys:  keys,
+		store: store,
+		users: users,
+	}
+}
+
+// Issue starts a new session for a user who just logged in.
+func (s *Service) Issue(ctx context.Context, user *users.User) (*Tokens, error) {
+	return s.issue(ctx, user, uuid.NewString(), time.Now().UTC())
+}
+
+func (s *Service) issue(ctx context.Context, user *users.User, familyID string, now time.Time) (*Tokens, error) {
+	accessToken, err := s.accessToken(user, now)
+	if err != nil {
+		slog.Error("issue accessToken", "ID", user.ID, "err", err)
+		return nil, err
+	}
+	refreshToken, err := securetoken.New()
+	if err != nil {
+		slog.Error("issue refreshToken", "ID", user.ID, "err", err)
+		return nil, err
+	}
+	token := &RefreshToken{
+		ID:        securetoken.Hash(refreshToken),
+		FamilyID:  familyID,
+		UserID:    user.ID,
+		ExpiresAt: now.Add(s.conf.RefreshTokenTTL),
+		CreatedAt: now,
+	}
+	if err = s.store.CreateRefreshToken(ctx, token); err != nil {
+		slog.Error("issue CreateRefreshToken", "ID", user.ID, "err", err)
+		return nil, err
+	}
+	return &Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.conf.AccessTokenTTL,
+	}, nil
+}
+
+func (s *Service) accessToken(user *users.User, now time.Time) (string, error) {
+	claims := newClaims(user)
+	claims.ID = uuid.NewString()
+	claims.Issuer = s.conf.Issuer
+	claims.Audience = jwt.ClaimStrings{s.conf.Audience}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(s.conf.AccessTokenTTL))
+	return s.keys.sign(claims)
+}
+
+// Refresh rotates a refresh token: it is revoked and a new pair of tokens is issued. A token used twice means it
+// leaked, the whole family is revoked and the user has to log in again.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	now := time.Now().UTC()
+	ID := securetoken.Hash(refreshToken)
+	token, err := s.store.GetRefreshToken(ctx, ID)
+	switch {
+	case errors.Is(err, ErrRefreshTokenNotFound):
+		return nil, ErrInvalidRefreshToken
+	case err != nil:
+		slog.Error("Refresh GetRefreshToken", "err", err)
+		return nil, err
+	}
+	if token.RevokedAt != nil {
+		return nil, s.revokeFamily(ctx, token, now)
+	}
+	if !now.Before(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	revoked, err := s.store.RevokeRefreshToken(ctx, ID, now)
+	if err != nil {
+		slog.Error("Refresh RevokeRefreshToken", "ID", token.UserID, "err", err)
+		return nil, err
+	}
+	if !revoked {
+		// another refresh used the token in between
+		return nil, s.revokeFamily(ctx, token, now)
+	}
+
+	user, err := s.users.GetActiveUser(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, users.ErrUserNotFound) {
+			err = ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	return s.issue(ctx, user, token.FamilyID, now)
+}
+
+func (s *Service) revokeFamily(ctx context.Context, token *RefreshToken, now time.Time) error {
+	slog.Warn("refresh token reused", "ID", token.UserID, "familyID", token.FamilyID)
+	if err := s.store.RevokeRefreshTokenFamily(ctx, token.FamilyID, now); err != nil {
+		slog.Error("revokeFamily RevokeRefreshTokenFamily", "ID", token.UserID, "err", err)
+		return err
+	}
+	return ErrInvalidRefreshToken
+}
+
+// Logout revokes the access token of claims until it expires, along with the session of refreshToken when given.
+func (s *Service) Logout(ctx context.Context, claims *Claims, refreshToken string) error {
+	now := time.Now().UTC()
+	ID, err := claims.UserID()
+	if err != nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return ErrInvalidClaims
+	}
+	if err = s.store.RevokeAccessToken(ctx, &RevokedToken{JTI: claims.ID, ExpiresAt: claims.ExpiresAt.Time}); err != nil {
+		slog.Error("Logout RevokeAccessToken", "ID", ID, "err", err)
+		return err
+	}
+	if refreshToken == "" {
+		return nil
+	}
+	token, err := s.store.GetRefreshToken(ctx, securetoken.Hash(refreshToken))
+	switch {
+	case errors.Is(err, ErrRefreshTokenNotFound):
+		return nil
+	case err != nil:
+		slog.Error("Logout GetRefreshToken", "ID", ID, "err", err)
+		return err
+	case token.UserID != ID:
+		return nil
+	}
+	if err = s.store.RevokeRefreshTokenFamily(ctx, token.FamilyID, now); err != nil {
+		slog.Error("Logout RevokeRefreshTokenFamily", "ID", ID, "err", err)
+		return err
+	}
+	return nil
+}
+
+// RevokeSessions revokes every refresh token of a user, like after a password reset. The access tokens already
+// issued stay valid until they expire.
+func (s *Service) RevokeSessions(ctx context.Context, ID int32) error {
+	if err := s.store.RevokeUserRefreshTokens(ctx, ID, time.Now().UTC()); err != nil {
+		slog.Error("RevokeSessions RevokeUserRefreshTokens", "ID", ID, "err", err)
+		return err
+	}
+	return nil
+}
+
+// Verify checks the claims of a token whose signature and expiry were already verified: the issuer, the audience
+// and the claims identifying the user and the token are required, and the token must not be revoked. The user
+// must still be allowed to log in, so a ban or a suspension applies to the tokens issued before it, and the roles
+// of claims are replaced by the current role of the user so a demotion applies at once as well.
+func (s *Service) Verify(ctx context.Context, claims *Claims) error {
+	validator := jwt.NewValidator(
+		jwt.WithIssuer(s.conf.Issuer),
+		jwt.WithAudience(s.conf.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err := validator.Validate(claims); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidClaims, err)
+	}
+	ID, err := claims.UserID()
+	if err != nil {
+		return err
+	}
+	if claims.ID == "" {
+		return ErrInvalidClaims
+	}
+	revoked, err := s.store.IsAccessTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		slog.Error("Verify IsAccessTokenRevoked", "jti", claims.ID, "err", err)
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	user, err := s.users.GetActiveUser(ctx, ID)
+	if err != nil {
+		// the user was deleted since the token was issued
+		if errors.Is(err, users.ErrUserNotFound) {
+			err = ErrTokenRevoked
+		}
+		return err
+	}
+	claims.Roles = []users.Role{user.Role}
+	return nil
+}
+
+func (s *Service) Keyfunc(token *jwt.Token) (interface{}, error) {
+	return s.keys.Keyfunc(token)
+}
+
+func (s *Service) JWKS() *JWKS {
+	return s.keys.JWKS()
+}
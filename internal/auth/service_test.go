@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/muzzapp/date-api/internal/securetoken"
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Issue(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	conf := testConfig()
+	keys, err := NewKeySet(conf)
+	require.NoError(t, err)
+	authService := NewService(conf, keys, store, NewMockUsers(controller))
+	ctx := context.Background()
+
+	t.Run("refresh token is stored hashed", func(t *testing.T) {
+		// given
+		user := &users.User{ID: 1, Name: "Jane", Role: users.RoleUser}
+		var stored *RefreshToken
+		store.EXPECT().CreateRefreshToken(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, token *RefreshToken) error {
+			stored = token
+			return nil
+		})
+
+		// when
+		tokens, err := authService.Issue(ctx, user)
+		require.NoError(t, err)
+
+		// then
+		require.Equal(t, securetoken.Hash(tokens.RefreshToken), stored.ID)
+		require.NotEqual(t, tokens.RefreshToken, stored.ID)
+		require.Equal(t, user.ID, stored.UserID)
+		require.NotEmpty(t, stored.FamilyID)
+		require.Equal(t, conf.AccessTokenTTL, tokens.ExpiresIn)
+
+		claims := &Claims{}
+		_, err = jwt.ParseWithClaims(tokens.AccessToken, claims, keys.Keyfunc)
+		require.NoError(t, err)
+		require.NotEmpty(t, claims.ID)
+		require.Equal(t, "1", claims.Subject)
+		require.Equal(t, "date-api", claims.Issuer)
+		require.Equal(t, jwt.ClaimStrings{"date-api"}, claims.Audience)
+		require.True(t, claims.HasRole(users.RoleUser))
+		require.False(t, claims.HasRole(users.RoleAdmin))
+	})
+}
+
+func TestService_Refresh(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	usersService := NewMockUsers(controller)
+	conf := testConfig()
+	keys, err := NewKeySet(conf)
+	require.NoError(t, err)
+	authService := NewService(conf, keys, store, usersService)
+	ctx := context.Background()
+
+	t.Run("unknown token", func(t *testing.T) {
+		// given
+		store.EXPECT().GetRefreshToken(ctx, securetoken.Hash("unknown")).Return(nil, ErrRefreshTokenNotFound)
+
+		// when
+		_, err := authService.Refresh(ctx, "unknown")
+
+		// then
+		require.ErrorIs(t, err, ErrInvalidRefreshToken)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		// given
+		token := &RefreshToken{ID: securetoken.Hash("expired"), FamilyID: "f", UserID: 1, ExpiresAt: time.Now().Add(-time.Minute)}
+		store.EXPECT().GetRefreshToken(ctx, token.ID).Return(token, nil)
+
+		// when
+		_, err := authService.Refresh(ctx, "expired")
+
+		// then
+		require.ErrorIs(t, err, ErrInvalidRefreshToken)
+	})
+
+	t.Run("reused token revokes the family", func(t *testing.T) {
+		// given
+		revokedAt := time.Now().Add(-time.Minute)
+		token := &RefreshToken{
+			ID: securetoken.Hash("reused"), FamilyID: "f", UserID: 1, ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &revokedAt,
+		}
+		store.EXPECT().GetRefreshToken(ctx, token.ID).Return(token, nil)
+		store.EXPECT().RevokeRefreshTokenFamily(ctx, "f", gomock.Any()).Return(nil)
+
+		// when
+		_, err := authService.Refresh(ctx, "reused")
+
+		// then
+		require.ErrorIs(t, err, ErrInvalidRefreshToken)
+	})
+
+	t.Run("concurrent refresh revokes the family", func(t *testing.T) {
+		// given
+		token := &RefreshToken{ID: securetoken.Hash("raced"), FamilyID: "f", UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+		store.EXPECT().GetRefreshToken(ctx, token.ID).Return(token, nil)
+		store.EXPECT().RevokeRefreshToken(ctx, token.ID, gomock.Any()).Return(false, nil)
+		store.EXPECT().RevokeRefreshTokenFamily(ctx, "f", gomock.Any()).Return(nil)
+
+		// when
+		_, err := authService.Refresh(ctx, "raced")
+
+		// then
+		require.ErrorIs(t, err, ErrInvalidRefreshToken)
+	})
+
+	t.Run("banned user cannot refresh", func(t *testing.T) {
+		// given
+		token := &RefreshToken{ID: securetoken.Hash("banned"), FamilyID: "f", UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+		store.EXPECT().GetRefreshToken(ctx, token.ID).Return(token, nil)
+		store.EXPECT().RevokeRefreshToken(ctx, token.ID, gomock.Any()).Return(true, nil)
+		usersService.EXPECT().GetActiveUser(ctx, int32(1)).Return(nil, users.ErrUserBanned)
+
+		// when
+		_, err := authService.Refresh(ctx, "banned")
+
+		// then
+		require.ErrorIs(t, err, users.ErrUserBanned)
+	})
+
+	t.Run("successful refresh rotates the token in the same family", func(t *testing.T) {
+		// given
+		token := &RefreshToken{ID: securetoken.Hash("valid"), FamilyID: "f", UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+		store.EXPECT().GetRefreshToken(ctx, token.ID).Return(token, nil)
+		store.EXPECT().RevokeRefreshToken(ctx, token.ID, gomock.Any()).Return(true, nil)
+		usersService.EXPECT().GetActiveUser(ctx, int32(1)).Return(&users.User{ID: 1, Role: users.RoleUser}, nil)
+		var stored *RefreshToken
+		store.EXPECT().CreateRefreshToken(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, token *RefreshToken) error {
+			stored = token
+			return nil
+		})
+
+		// when
+		tokens, err := authService.Refresh(ctx, "valid")
+		require.NoError(t, err)
+
+		// then
+		require.NotEqual(t, "valid", tokens.RefreshToken)
+		require.Equal(t, securetoken.Hash(tokens.RefreshToken), stored.ID)
+		require.Equal(t, "f", stored.FamilyID)
+	})
+}
+
+func TestService_Logout(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	conf := testConfig()
+	keys, err := NewKeySet(conf)
+	require.NoError(t, err)
+	authService := NewService(conf, keys, store, NewMockUsers(controller))
+	ctx := context.Background()
+	expiresAt := time.Now().Add(10 * time.Minute)
+	claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{
+		ID:        "jti",
+		Subject:   "1",
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}}
+
+	t.Run("access token only", func(t *testing.T) {
+		// given
+		store.EXPECT().RevokeAccessToken(ctx, &RevokedToken{JTI: "jti", ExpiresAt: claims.ExpiresAt.Time}).Return(nil)
+
+		// when
+		err := authService.Logout(ctx, claims, "")
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("refresh token of another user is left alone", func(t *testing.T) {
+		// given
+		store.EXPECT().RevokeAccessToken(ctx, gomock.Any()).Return(nil)
+		store.EXPECT().GetRefreshToken(ctx, securetoken.Hash("other")).Return(&RefreshToken{FamilyID: "f", UserID: 2}, nil)
+
+		// when
+		err := authService.Logout(ctx, claims, "other")
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("refresh token family is revoked", func(t *testing.T) {
+		// given
+		store.EXPECT().RevokeAccessToken(ctx, gomock.Any()).Return(nil)
+		store.EXPECT().GetRefreshToken(ctx, securetoken.Hash("mine")).Return(&RefreshToken{FamilyID: "f", UserID: 1}, nil)
+		store.EXPECT().RevokeRefreshTokenFamily(ctx, "f", gomock.Any()).Return(nil)
+
+		// when
+		err := authService.Logout(ctx, claims, "mine")
+
+		// then
+		require.NoError(t, err)
+	})
+}
+
+func TestService_Verify(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	conf := testConfig()
+	keys, err := NewKeySet(conf)
+	require.NoError(t, err)
+	userService := NewMockUsers(controller)
+	authService := NewService(conf, keys, store, userService)
+	ctx := context.Background()
+	validClaims := func() *Claims {
+		return &Claims{Roles: []users.Role{users.RoleAdmin}, RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti",
+			Subject:   "1",
+			Issuer:    "date-api",
+			Audience:  jwt.ClaimStrings{"date-api"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}}
+	}
+
+	invalid := map[string]func(c *Claims){
+		"other issuer":        func(c *Claims) { c.Issuer = "other" },
+		"other audience":      func(c *Claims) { c.Audience = jwt.ClaimStrings{"other"} },
+		"missing expiry":      func(c *Claims) { c.ExpiresAt = nil },
+		"missing subject":     func(c *Claims) { c.Subject = "" },
+		"non numeric subject": func(c *Claims) { c.Subject = "jane" },
+		"missing ID":          func(c *Claims) { c.ID = "" },
+	}
+	for name, mutate := range invalid {
+		t.Run(name, func(t *testing.T) {
+			// given
+			claims := validClaims()
+			mutate(claims)
+
+			// when
+			err := authService.Verify(ctx, claims)
+
+			// then
+			require.ErrorIs(t, err, ErrInvalidClaims)
+		})
+	}
+
+	t.Run("revoked token", func(t *testing.T) {
+		// given
+		store.EXPECT().IsAccessTokenRevoked(ctx, "jti").Return(true, nil)
+
+		// when
+		err := authService.Verify(ctx, validClaims())
+
+		// then
+		require.ErrorIs(t, err, ErrTokenRevoked)
+	})
+
+	t.Run("banned user", func(t *testing.T) {
+		// given
+		store.EXPECT().IsAccessTokenRevoked(ctx, "jti").Return(false, nil)
+		userService.EXPECT().GetActiveUser(ctx, int32(1)).Return(nil, users.ErrUserBanned)
+
+		// when
+		err := authService.Verify(ctx, validClaims())
+
+		// then
+		require.ErrorIs(t, err, users.ErrUserBanned)
+	})
+
+	t.Run("deleted user", func(t *testing.T) {
+		// given
+		store.EXPECT().IsAccessTokenRevoked(ctx, "jti").Return(false, nil)
+		userService.EXPECT().GetActiveUser(ctx, int32(1)).Return(nil, users.ErrUserNotFound)
+
+		// when
+		err := authService.Verify(ctx, validClaims())
+
+		// then
+		require.ErrorIs(t, err, ErrTokenRevoked)
+	})
+
+	t.Run("valid token gets the current role of the user", func(t *testing.T) {
+		// given
+		store.EXPECT().IsAccessTokenRevoked(ctx, "jti").Return(false, nil)
+		userService.EXPECT().GetActiveUser(ctx, int32(1)).Return(&users.User{ID: 1, Role: users.RoleUser}, nil)
+		claims := validClaims()
+
+		// when
+		err := authService.Verify(ctx, claims)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, []users.Role{users.RoleUser}, claims.Roles)
+	})
+}
+
+func testConfig() *Config {
+	return &Config{
+		Secret:          "secret",
+		Issuer:          "date-api",
+		Audience:        "date-api",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}
+}
@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// File writes every message to its own .eml file in a directory instead of sending it.
+type File struct {
+	dir   string
+	count atomic.Int64
+}
+
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &File{dir: dir}, nil
+}
+
+func (f *File) Send(_ context.Context, message *Message) error {
+	now := time.Now().UTC()
+	name := fmt.Sprintf("%s-%d-%s.eml", now.Format("20060102T150405"), f.count.Add(1), sanitize(message.To))
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		message.To, message.Subject, now.Format(time.RFC1123Z), message.Body)
+	return os.WriteFile(filepath.Join(f.dir, name), []byte(content), 0o644)
+}
+
+// sanitize keeps a recipient usable in a file name.
+func sanitize(to string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '@', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, to)
+}
@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile_Send(t *testing.T) {
+	// given
+	dir := filepath.Join(t.TempDir(), "mails")
+	mailer, err := NewFile(dir)
+	require.NoError(t, err)
+
+	// when
+	err = mailer.Send(context.Background(), &Message{To: "jane/../doe@example.com", Subject: "Hi", Body: "Hello"})
+	require.NoError(t, err)
+
+	// then
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Contains(t, files[0].Name(), "jane_.._doe@example.com.eml")
+	content, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	require.Contains(t, string(content), "Subject: Hi\r\n")
+	require.Contains(t, string(content), "\r\n\r\nHello")
+}
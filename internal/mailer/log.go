@@ -0,0 +1,18 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Log writes the messages to the logs instead of sending them.
+type Log struct{}
+
+func NewLog() *Log {
+	return &Log{}
+}
+
+func (l *Log) Send(_ context.Context, message *Message) error {
+	slog.Info("mail", "to", message.To, "subject", message.Subject, "body", message.Body)
+	return nil
+}
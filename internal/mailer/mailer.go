@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+)
+
+type Config struct {
+	// Mailer is log to write the messages to the logs or file to write them to Dir, both are meant for local runs
+	Mailer string `envconfig:"MAILER" default:"log"`
+	Dir    string `envconfig:"MAILER_DIR" default:"mails"`
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+func New(conf *Config) (Mailer, error) {
+	switch conf.Mailer {
+	case "log":
+		return NewLog(), nil
+	case "file":
+		return NewFile(conf.Dir)
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", conf.Mailer)
+	}
+}
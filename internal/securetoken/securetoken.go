@@ -0,0 +1,25 @@
+// Package securetoken creates the random tokens handed to the clients, like the refresh and one time tokens,
+// and hashes them for storage.
+package securetoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// New returns 32 random bytes encoded for URLs.
+func New() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Hash is how the tokens are stored, they are random enough for a plain SHA-256.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,25 @@
+package securetoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	// when
+	first, err := New()
+	require.NoError(t, err)
+	second, err := New()
+	require.NoError(t, err)
+
+	// then
+	require.Len(t, first, 43)
+	require.NotEqual(t, first, second)
+}
+
+func TestHash(t *testing.T) {
+	// then
+	require.Equal(t, "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", Hash("test"))
+	require.NotEqual(t, Hash("test"), Hash("Test"))
+}
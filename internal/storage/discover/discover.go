@@ -0,0 +1,71 @@
+// Package discover computes the discover distances and sort order for the backends that cannot do it in their
+// query language, the same way the $geoNear pipeline of persistence.User does.
+package discover
+
+import (
+	"cmp"
+	"math"
+
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+// EarthRadius is the radius MongoDB uses for the spherical distances of $geoNear, in meters.
+const EarthRadius = 6378100
+
+// Distance is the great circle distance between a and b in meters.
+func Distance(a, b *users.Coordinates) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// LatitudeRange returns the latitudes within distance meters of c, a cheap prefilter before Distance.
+func LatitudeRange(c *users.Coordinates, distance float64) (float64, float64) {
+	delta := distance / EarthRadius * 180 / math.Pi
+	return math.Max(-90, c.Latitude-delta), math.Min(90, c.Latitude+delta)
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// Position is the place of a candidate in the discover order, the gender and age ranks are only set when ranked.
+func Position(rank *users.Rank, ID int32, gender string, age int32, distance float64) users.DiscoverCursor {
+	position := users.DiscoverCursor{DistanceFromMe: distance, ID: ID}
+	if rank == nil {
+		return position
+	}
+	if rank.MostCommonGender != "" {
+		position.GenderSort = 2
+		if gender == rank.MostCommonGender {
+			position.GenderSort = 1
+		}
+	}
+	ageSort := age - rank.AvgAge
+	if ageSort < 0 {
+		ageSort = -ageSort
+	}
+	position.AgeSort = ageSort
+	return position
+}
+
+// Compare orders the profiles on the discover sort keys, the gender and age ranks first when ranked,
+// then the distance and the ID.
+func Compare(rank *users.Rank, a, b *users.DiscoverCursor) int {
+	if rank != nil {
+		if rank.MostCommonGender != "" {
+			if c := cmp.Compare(a.GenderSort, b.GenderSort); c != 0 {
+				return c
+			}
+		}
+		if c := cmp.Compare(a.AgeSort, b.AgeSort); c != 0 {
+			return c
+		}
+	}
+	if c := cmp.Compare(a.DistanceFromMe, b.DistanceFromMe); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
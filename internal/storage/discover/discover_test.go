@@ -0,0 +1,73 @@
+package discover
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistance(t *testing.T) {
+	// given
+	london := &users.Coordinates{Longitude: -0.1278, Latitude: 51.5074}
+	paris := &users.Coordinates{Longitude: 2.3522, Latitude: 48.8566}
+
+	// when
+	meters := Distance(london, paris)
+
+	// then
+	require.InDelta(t, 343_600, meters, 1_000)
+	require.Zero(t, Distance(london, london))
+}
+
+func TestLatitudeRange(t *testing.T) {
+	t.Run("a degree is about 111km", func(t *testing.T) {
+		// when
+		low, high := LatitudeRange(&users.Coordinates{Latitude: 10}, 111_319)
+
+		// then
+		require.InDelta(t, 9, low, 0.001)
+		require.InDelta(t, 11, high, 0.001)
+	})
+
+	t.Run("clamped at the poles", func(t *testing.T) {
+		// when
+		low, high := LatitudeRange(&users.Coordinates{Latitude: 89.5}, 500_000)
+
+		// then
+		require.Less(t, low, 89.5)
+		require.Equal(t, float64(90), high)
+	})
+}
+
+func TestCompare(t *testing.T) {
+	sorted := func(rank *users.Rank) []int32 {
+		positions := []users.DiscoverCursor{
+			Position(rank, 1, "male", 30, 300),
+			Position(rank, 2, "female", 50, 100),
+			Position(rank, 3, "female", 30, 200),
+			Position(rank, 4, "male", 30, 200),
+		}
+		slices.SortFunc(positions, func(a, b users.DiscoverCursor) int {
+			return Compare(rank, &a, &b)
+		})
+		IDs := make([]int32, len(positions))
+		for i, position := range positions {
+			IDs[i] = position.ID
+		}
+		return IDs
+	}
+
+	t.Run("not ranked sorts on distance then id", func(t *testing.T) {
+		require.Equal(t, []int32{2, 3, 4, 1}, sorted(nil))
+	})
+
+	t.Run("ranked sorts on gender then age first", func(t *testing.T) {
+		require.Equal(t, []int32{3, 2, 4, 1}, sorted(&users.Rank{AvgAge: 30, MostCommonGender: "female"}))
+	})
+
+	t.Run("ranked without a most common gender sorts on age first", func(t *testing.T) {
+		require.Equal(t, []int32{3, 4, 1, 2}, sorted(&users.Rank{AvgAge: 30}))
+	})
+}
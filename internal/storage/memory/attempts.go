@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+// Attempts keeps the failed logins in memory, it is meant for tests and single instance runs since every
+// instance counts its own failures.
+type Attempts struct {
+	mu       sync.Mutex
+	attempts map[string]users.LoginAttempts
+	lockouts []users.LoginLockout
+}
+
+var (
+	_ users.AttemptStore = (*Attempts)(nil)
+)
+
+func NewAttempts() *Attempts {
+	return &Attempts{
+		attempts: make(map[string]users.LoginAttempts),
+	}
+}
+
+func (a *Attempts) GetLoginAttempts(_ context.Context, key string) (*users.LoginAttempts, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	attempts, ok := a.attempts[key]
+	if !ok {
+		return &users.LoginAttempts{Key: key}, nil
+	}
+	return &attempts, nil
+}
+
+func (a *Attempts) IncrementLoginFailures(_ context.Context, key string, now time.Time, window time.Duration) (*users.LoginAttempts, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	attempts, ok := a.attempts[key]
+	if !ok || now.Sub(attempts.LastFailureAt) > window {
+		attempts = users.LoginAttempts{Key: key, LockedUntil: attempts.LockedUntil}
+	}
+	attempts.Failures++
+	attempts.LastFailureAt = now
+	a.attempts[key] = attempts
+	return &attempts, nil
+}
+
+func (a *Attempts) LockLogin(_ context.Context, key string, until time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	attempts, ok := a.attempts[key]
+	if !ok {
+		attempts = users.LoginAttempts{Key: key}
+	}
+	attempts.LockedUntil = &until
+	a.attempts[key] = attempts
+	return nil
+}
+
+func (a *Attempts) ResetLoginAttempts(_ context.Context, key string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.attempts, key)
+	return nil
+}
+
+func (a *Attempts) CreateLoginLockout(_ context.Context, lockout *users.LoginLockout) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.lockouts = append(a.lockouts, *lockout)
+	return nil
+}
+
+// Lockouts returns the lockouts recorded so far.
+func (a *Attempts) Lockouts() []users.LoginLockout {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	lockouts := make([]users.LoginLockout, len(a.lockouts))
+	copy(lockouts, a.lockouts)
+	return lockouts
+}
@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/auth"
+)
+
+// Auth keeps the refresh tokens and the revoked access tokens in memory.
+type Auth struct {
+	mu            sync.Mutex
+	refreshTokens map[string]*auth.RefreshToken
+	revokedTokens map[string]*auth.RevokedToken
+}
+
+var (
+	_ auth.Store = (*Auth)(nil)
+)
+
+func NewAuth() *Auth {
+	return &Auth{
+		refreshTokens: make(map[string]*auth.RefreshToken),
+		revokedTokens: make(map[string]*auth.RevokedToken),
+	}
+}
+
+func (a *Auth) CreateRefreshToken(_ context.Context, token *auth.RefreshToken) error {
+	stored, err := clone(token)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.refreshTokens[token.ID] = stored
+	return nil
+}
+
+func (a *Auth) GetRefreshToken(_ context.Context, ID string) (*auth.RefreshToken, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	token, ok := a.refreshTokens[ID]
+	if !ok {
+		return nil, auth.ErrRefreshTokenNotFound
+	}
+	return clone(token)
+}
+
+func (a *Auth) RevokeRefreshToken(_ context.Context, ID string, now time.Time) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	token, ok := a.refreshTokens[ID]
+	if !ok || token.RevokedAt != nil {
+		return false, nil
+	}
+	token.RevokedAt = &now
+	return true, nil
+}
+
+func (a *Auth) RevokeRefreshTokenFamily(_ context.Context, familyID string, now time.Time) error {
+	a.revokeWhere(func(token *auth.RefreshToken) bool { return token.FamilyID == familyID }, now)
+	return nil
+}
+
+func (a *Auth) RevokeUserRefreshTokens(_ context.Context, userID int32, now time.Time) error {
+	a.revokeWhere(func(token *auth.RefreshToken) bool { return token.UserID == userID }, now)
+	return nil
+}
+
+func (a *Auth) revokeWhere(match func(token *auth.RefreshToken) bool, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, token := range a.refreshTokens {
+		if token.RevokedAt == nil && match(token) {
+			revokedAt := now
+			token.RevokedAt = &revokedAt
+		}
+	}
+}
+
+// RevokeAccessToken is idempotent, revoking a token twice keeps the first revocation. The revocations of the
+// tokens which expired since are dropped, like the TTL index of the MongoDB store does.
+func (a *Auth) RevokeAccessToken(_ context.Context, token *auth.RevokedToken) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	for jti, revoked := range a.revokedTokens {
+		if !revoked.ExpiresAt.After(now) {
+			delete(a.revokedTokens, jti)
+		}
+	}
+	if _, ok := a.revokedTokens[token.JTI]; !ok {
+		a.revokedTokens[token.JTI] = &auth.RevokedToken{JTI: token.JTI, ExpiresAt: token.ExpiresAt}
+	}
+	return nil
+}
+
+// IsAccessTokenRevoked drops the revocation of an expired token, the token is rejected on its expiry anyway.
+func (a *Auth) IsAccessTokenRevoked(_ context.Context, jti string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	revoked, ok := a.revokedTokens[jti]
+	if ok && !revoked.ExpiresAt.After(time.Now()) {
+		delete(a.revokedTokens, jti)
+		return false, nil
+	}
+	return ok, nil
+}
+
+func (a *Auth) deleteUserTokens(userID int32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for ID, token := range a.refreshTokens {
+		if token.UserID == userID {
+			delete(a.refreshTokens, ID)
+		}
+	}
+}
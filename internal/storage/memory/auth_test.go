@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth_RevokeAccessToken(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("revoked token is reported until it expires", func(t *testing.T) {
+		// given
+		store := NewAuth()
+		require.NoError(t, store.RevokeAccessToken(ctx, &auth.RevokedToken{JTI: "live", ExpiresAt: time.Now().Add(time.Hour)}))
+
+		// when
+		revoked, err := store.IsAccessTokenRevoked(ctx, "live")
+
+		// then
+		require.NoError(t, err)
+		require.True(t, revoked)
+	})
+
+	t.Run("expired revocations are dropped on insert and on lookup", func(t *testing.T) {
+		// given
+		store := NewAuth()
+		expired := time.Now().Add(-time.Minute)
+		require.NoError(t, store.RevokeAccessToken(ctx, &auth.RevokedToken{JTI: "old", ExpiresAt: expired}))
+		require.NoError(t, store.RevokeAccessToken(ctx, &auth.RevokedToken{JTI: "older", ExpiresAt: expired}))
+
+		// when
+		require.NoError(t, store.RevokeAccessToken(ctx, &auth.RevokedToken{JTI: "live", ExpiresAt: time.Now().Add(time.Hour)}))
+		revoked, err := store.IsAccessTokenRevoked(ctx, "live")
+		require.NoError(t, err)
+
+		// then
+		require.True(t, revoked)
+		require.Len(t, store.revokedTokens, 1)
+		store.revokedTokens["live"].ExpiresAt = expired
+		revoked, err = store.IsAccessTokenRevoked(ctx, "live")
+		require.NoError(t, err)
+		require.False(t, revoked)
+		require.Empty(t, store.revokedTokens)
+	})
+}
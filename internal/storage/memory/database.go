@@ -0,0 +1,27 @@
+package memory
+
+import "context"
+
+// Database is every store kept in memory, the counterpart of persistence.Database to run without MongoDB.
+type Database struct {
+	*User
+	*Auth
+	*Attempts
+	*Tokens
+}
+
+func New() *Database {
+	return &Database{
+		User:     NewUser(),
+		Auth:     NewAuth(),
+		Attempts: NewAttempts(),
+		Tokens:   NewTokens(),
+	}
+}
+
+// PurgeUser erases the user from every store, User.PurgeUser alone keeps their refresh and one time tokens.
+func (d *Database) PurgeUser(ctx context.Context, ID int32) error {
+	d.Auth.deleteUserTokens(ID)
+	d.Tokens.deleteUserTokens(ID)
+	return d.User.PurgeUser(ctx, ID)
+}
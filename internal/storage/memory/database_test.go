@@ -0,0 +1,37 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/auth"
+	"github.com/muzzapp/date-api/internal/storage/storetest"
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabase_PurgeUser(t *testing.T) {
+	// given
+	ctx := context.Background()
+	db := New()
+	user, err := db.CreateUser(ctx, storetest.NewUser("me", "male", 30, 2))
+	require.NoError(t, err)
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, db.CreateRefreshToken(ctx, &auth.RefreshToken{ID: "refresh", UserID: user.ID, ExpiresAt: expiresAt}))
+	require.NoError(t, db.CreateOneTimeToken(ctx, &users.OneTimeToken{
+		ID: "reset", Purpose: users.TokenPurposePasswordReset, UserID: user.ID, ExpiresAt: expiresAt,
+	}))
+
+	// when
+	err = db.PurgeUser(ctx, user.ID)
+
+	// then
+	require.NoError(t, err)
+	_, err = db.GetUser(ctx, user.ID)
+	require.ErrorIs(t, err, users.ErrUserNotFound)
+	_, err = db.GetRefreshToken(ctx, "refresh")
+	require.ErrorIs(t, err, auth.ErrRefreshTokenNotFound)
+	_, err = db.UseOneTimeToken(ctx, "reset", users.TokenPurposePasswordReset, time.Now())
+	require.ErrorIs(t, err, users.ErrInvalidToken)
+}
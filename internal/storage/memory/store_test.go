@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/muzzapp/date-api/internal/storage/storetest"
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) users.Store {
+		return NewUser()
+	})
+}
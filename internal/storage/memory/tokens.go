@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+// Tokens keeps the one time tokens in memory.
+type Tokens struct {
+	mu     sync.Mutex
+	tokens map[string]*users.OneTimeToken
+}
+
+var (
+	_ users.TokenStore = (*Tokens)(nil)
+)
+
+func NewTokens() *Tokens {
+	return &Tokens{
+		tokens: make(map[string]*users.OneTimeToken),
+	}
+}
+
+func (t *Tokens) CreateOneTimeToken(_ context.Context, token *users.OneTimeToken) error {
+	stored, err := clone(token)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tokens[token.ID] = stored
+	return nil
+}
+
+// UseOneTimeToken marks the token used under the lock so a token cannot be used twice concurrently.
+func (t *Tokens) UseOneTimeToken(_ context.Context, ID string, purpose users.TokenPurpose, now time.Time) (*users.OneTimeToken, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	token, ok := t.tokens[ID]
+	if !ok || token.Purpose != purpose || token.UsedAt != nil || !token.ExpiresAt.After(now) {
+		return nil, users.ErrInvalidToken
+	}
+	token.UsedAt = &now
+	return clone(token)
+}
+
+func (t *Tokens) RevokeOneTimeTokens(_ context.Context, userID int32, purpose users.TokenPurpose, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, token := range t.tokens {
+		if token.UserID == userID && token.Purpose == purpose && token.UsedAt == nil {
+			usedAt := now
+			token.UsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+func (t *Tokens) deleteUserTokens(userID int32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for ID, token := range t.tokens {
+		if token.UserID == userID {
+			delete(t.tokens, ID)
+		}
+	}
+}
@@ -0,0 +1,742 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/storage/discover"
+	"github.com/muzzapp/date-api/internal/users"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var errMissingLocation = errors.New("discover requires the requester location")
+
+// User keeps the users and everything linked to them in memory, it is meant for tests and local runs.
+// Documents are copied through BSON on the way in and out, so callers never share memory with the store and
+// get the same precision as from MongoDB.
+type User struct {
+	mu         sync.RWMutex
+	users      map[int32]*users.User
+	lastUserID int32
+	swipes     map[swipeKey]*swipe
+	matches    map[string]*users.Match
+	unmatches  []*users.Unmatch
+	blocks     map[blockKey]*users.Block
+	reports    []*users.Report
+	// lastReportID keeps the report IDs unique once purged users' reports are deleted
+	lastReportID int32
+	moderations  []*users.Moderation
+}
+
+type swipeKey struct {
+	swiperID int32
+	swipedID int32
+}
+
+type swipe struct {
+	ok        bool
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+type blockKey struct {
+	blockerID int32
+	blockedID int32
+}
+
+var (
+	_ users.Store = (*User)(nil)
+)
+
+func NewUser() *User {
+	return &User{
+		users:   make(map[int32]*users.User),
+		swipes:  make(map[swipeKey]*swipe),
+		matches: make(map[string]*users.Match),
+		blocks:  make(map[blockKey]*users.Block),
+	}
+}
+
+func (u *User) CreateUser(_ context.Context, user *users.User) (*users.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, other := range u.users {
+		if other.Email == user.Email {
+			return nil, users.ErrEmailTaken
+		}
+	}
+	u.lastUserID++
+	user.ID = u.lastUserID
+	stored, err := clone(user)
+	if err != nil {
+		return nil, err
+	}
+	u.users[user.ID] = stored
+	return user, nil
+}
+
+func (u *User) GetUser(_ context.Context, ID int32) (*users.User, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	user, ok := u.users[ID]
+	if !ok {
+		return nil, users.ErrUserNotFound
+	}
+	return clone(user)
+}
+
+func (u *User) GetRankByIDs(_ context.Context, IDs []int32) (*users.Rank, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	var found bool
+	var ageSum float64
+	var ages int
+	genders := make(map[string]int32)
+	for _, ID := range uniqueIDs(IDs) {
+		user, ok := u.users[ID]
+		if !ok {
+			continue
+		}
+		found = true
+		if user.Age != nil {
+			ageSum += float64(user.Age.Value)
+			ages++
+		}
+		genders[user.Gender]++
+	}
+	if !found {
+		return nil, nil
+	}
+
+	rank := &users.Rank{}
+	if ages > 0 {
+		rank.AvgAge = int32(ageSum / float64(ages))
+	}
+	counts := make([]genderCount, 0, len(genders))
+	for gender, count := range genders {
+		counts = append(counts, genderCount{gender: gender, count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].count > counts[j].count
+	})
+	// a tie between the two most swiped genders ranks on age only
+	if len(counts) < 2 || counts[0].count != counts[1].count {
+		rank.MostCommonGender = counts[0].gender
+	}
+	return rank, nil
+}
+
+type genderCount struct {
+	gender string
+	count  int32
+}
+
+func (u *User) GetUserByEmail(_ context.Context, email string) (*users.User, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	for _, user := range u.users {
+		if user.Email == email {
+			return clone(user)
+		}
+	}
+	return nil, users.ErrUserNotFound
+}
+
+func (u *User) UpdateUser(_ context.Context, ID int32, update *users.UserUpdate) (*users.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	stored, ok := u.users[ID]
+	if !ok {
+		return nil, users.ErrUserNotFound
+	}
+	updated, err := clone(stored)
+	if err != nil {
+		return nil, err
+	}
+	applyUpdate(updated, update)
+	if stored, err = clone(updated); err != nil {
+		return nil, err
+	}
+	u.users[ID] = stored
+	return updated, nil
+}
+
+func applyUpdate(user *users.User, update *users.UserUpdate) {
+	if update.Password != nil {
+		user.Password = *update.Password
+	}
+	if update.EmailVerified != nil {
+		user.EmailVerified = *update.EmailVerified
+	}
+	if update.TwoFactor != nil {
+		user.TwoFactor = update.TwoFactor
+	}
+	if update.DeletedAt != nil {
+		user.DeletedAt = update.DeletedAt
+	}
+	if update.Name != nil {
+		user.Name = *update.Name
+	}
+	if update.Gender != nil {
+		user.Gender = *update.Gender
+	}
+	if update.Bio != nil {
+		user.Bio = *update.Bio
+	}
+	if update.Age != nil {
+		user.Age = update.Age
+	}
+	if update.Location != nil {
+		user.Location = update.Location
+	}
+	if update.Preferences != nil {
+		user.Preferences = update.Preferences
+	}
+}
+
+func (u *User) UseRecoveryCode(_ context.Context, ID int32, hashedCode string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	user, ok := u.users[ID]
+	if !ok || user.TwoFactor == nil {
+		return users.ErrInvalidTwoFactorCode
+	}
+	i := slices.Index(user.TwoFactor.RecoveryCodes, hashedCode)
+	if i == -1 {
+		return users.ErrInvalidTwoFactorCode
+	}
+	user.TwoFactor.RecoveryCodes = slices.Delete(user.TwoFactor.RecoveryCodes, i, i+1)
+	return nil
+}
+
+func (u *User) UseTOTPStep(_ context.Context, ID int32, step int64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	user, ok := u.users[ID]
+	if !ok || user.TwoFactor == nil || user.TwoFactor.LastStep >= step {
+		return users.ErrInvalidTwoFactorCode
+	}
+	user.TwoFactor.LastStep = step
+	return nil
+}
+
+// Discover filters, sorts and pages the candidates like the $geoNear pipeline of persistence.User.
+func (u *User) Discover(_ context.Context, filter *users.DiscoverFilter) ([]*users.Profile, *users.DiscoverCursor, error) {
+	if filter.Location == nil || filter.Location.Coordinates == nil {
+		return nil, nil, errMissingLocation
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	hidden := u.hidden(filter.ID)
+
+	var candidates []*candidate
+	for _, user := range u.users {
+		if hidden[user.ID] || !discoverable(user, filter) {
+			continue
+		}
+		if _, swiped := u.swipes[swipeKey{swiperID: filter.ID, swipedID: user.ID}]; swiped {
+			continue
+		}
+		if user.Location == nil || user.Location.Coordinates == nil {
+			continue
+		}
+		distance := discover.Distance(filter.Location.Coordinates, user.Location.Coordinates)
+		if filter.MaxDistance > 0 && distance > filter.MaxDistance {
+			continue
+		}
+		c := &candidate{user: user, position: discover.Position(filter.Rank, user.ID, user.Gender, age(user), distance)}
+		if filter.After != nil && discover.Compare(filter.Rank, &c.position, filter.After) <= 0 {
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	slices.SortFunc(candidates, func(a, b *candidate) int {
+		return discover.Compare(filter.Rank, &a.position, &b.position)
+	})
+
+	// one extra profile is looked at to know whether there is a next page
+	var next *users.DiscoverCursor
+	if filter.Limit > 0 && len(candidates) > int(filter.Limit) {
+		candidates = candidates[:filter.Limit]
+		position := candidates[len(candidates)-1].position
+		next = &position
+	}
+	profiles := make([]*users.Profile, len(candidates))
+	for i, c := range candidates {
+		profiles[i] = &users.Profile{
+			ID:             c.user.ID,
+			Name:           c.user.Name,
+			Gender:         c.user.Gender,
+			Age:            age(c.user),
+			DistanceFromMe: int32(c.position.DistanceFromMe),
+		}
+	}
+	return profiles, next, nil
+}
+
+type candidate struct {
+	user     *users.User
+	position users.DiscoverCursor
+}
+
+// discoverable applies the filters of persistence.matchFilter.
+func discoverable(user *users.User, filter *users.DiscoverFilter) bool {
+	if user.DeletedAt != nil || (filter.VerifiedOnly && !user.EmailVerified) {
+		return false
+	}
+	if m := user.Moderation; m != nil && (m.Status == users.ModerationStatusBanned ||
+		m.Status == users.ModerationStatusSuspended && (m.Until == nil || time.Now().Before(*m.Until))) {
+		return false
+	}
+	if filter.MinAge > 0 || filter.MaxAge > 0 {
+		if user.Age == nil {
+			return false
+		}
+		if filter.MinAge > 0 && user.Age.Value < filter.MinAge {
+			return false
+		}
+		if filter.MaxAge > 0 && user.Age.Value > filter.MaxAge {
+			return false
+		}
+	}
+	if len(filter.Genders) > 0 && !slices.Contains(filter.Genders, user.Gender) {
+		return false
+	}
+	return accepts(user.Preferences, filter.RequesterGender, filter.RequesterAge)
+}
+
+// accepts tells whether the saved preferences of a candidate accept the requester, missing or zero
+// preferences accept everyone.
+func accepts(p *users.Preferences, gender string, age int32) bool {
+	if p == nil {
+		return true
+	}
+	if gender != "" && len(p.Genders) > 0 && !slices.Contains(p.Genders, gender) {
+		return false
+	}
+	if age > 0 {
+		if p.MaxAge > 0 && p.MaxAge < age {
+			return false
+		}
+		if p.MinAge > age {
+			return false
+		}
+	}
+	return true
+}
+
+func age(user *users.User) int32 {
+	if user.Age == nil {
+		return 0
+	}
+	return user.Age.Value
+}
+
+func (u *User) GetYesSwipeIDs(_ context.Context, ID int32) ([]int32, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	IDs := make([]int32, 0)
+	for key, s := range u.swipes {
+		if key.swiperID == ID && s.ok {
+			IDs = append(IDs, key.swipedID)
+		}
+	}
+	slices.Sort(IDs)
+	return IDs, nil
+}
+
+// Swipe records the latest decision of ID about swipe.ID, swiping the same profile again only updates it.
+func (u *User) Swipe(_ context.Context, ID int32, s *users.Swipe) error {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := swipeKey{swiperID: ID, swipedID: s.ID}
+	stored, ok := u.swipes[key]
+	if !ok {
+		stored = &swipe{createdAt: now}
+		u.swipes[key] = stored
+	}
+	stored.ok = s.OK
+	stored.updatedAt = now
+	return nil
+}
+
+func (u *User) GetSwipes(_ context.Context, ID int32) ([]*users.SwipeRecord, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	swipes := make([]*users.SwipeRecord, 0)
+	for key, s := range u.swipes {
+		if key.swiperID == ID {
+			swipes = append(swipes, &users.SwipeRecord{
+				SwipedID:  key.swipedID,
+				OK:        s.ok,
+				CreatedAt: s.createdAt,
+				UpdatedAt: s.updatedAt,
+			})
+		}
+	}
+	slices.SortFunc(swipes, func(a, b *users.SwipeRecord) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.SwipedID, b.SwipedID)
+	})
+	return swipes, nil
+}
+
+func (u *User) Match(_ context.Context, ID, swipedID int32) (bool, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	s, ok := u.swipes[swipeKey{swiperID: swipedID, swipedID: ID}]
+	return ok && s.ok, nil
+}
+
+// CreateMatch stores the match unless it already exists, in which case the stored match is returned.
+func (u *User) CreateMatch(_ context.Context, match *users.Match) (*users.Match, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if stored, ok := u.matches[match.ID]; ok {
+		return clone(stored)
+	}
+	stored, err := clone(match)
+	if err != nil {
+		return nil, err
+	}
+	u.matches[match.ID] = stored
+	return clone(stored)
+}
+
+func (u *User) GetMatch(_ context.Context, matchID string) (*users.Match, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	match, ok := u.matches[matchID]
+	if !ok {
+		return nil, users.ErrMatchNotFound
+	}
+	return clone(match)
+}
+
+// GetMatches lists the matches of ID newest first with the other user profile, the matches with a deleted
+// or erased user are dropped.
+func (u *User) GetMatches(_ context.Context, ID, limit int32, after *users.MatchesCursor) ([]*users.Match, *users.MatchesCursor, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	matches := make([]*users.Match, 0)
+	for _, stored := range u.matches {
+		if !slices.Contains(stored.UserIDs, ID) {
+			continue
+		}
+		if after != nil && compareMatches(stored, after) <= 0 {
+			continue
+		}
+		others := otherIDs(ID, stored.UserIDs)
+		if len(others) == 0 {
+			continue
+		}
+		other, ok := u.users[others[0]]
+		if !ok || other.DeletedAt != nil {
+			continue
+		}
+		match, err := clone(stored)
+		if err != nil {
+			return nil, nil, err
+		}
+		match.Profile = &users.Profile{
+			ID:     other.ID,
+			Name:   other.Name,
+			Gender: other.Gender,
+			Age:    age(other),
+		}
+		matches = append(matches, match)
+	}
+	slices.SortFunc(matches, func(a, b *users.Match) int {
+		return compareMatches(a, &users.MatchesCursor{CreatedAt: b.CreatedAt, ID: b.ID})
+	})
+
+	var next *users.MatchesCursor
+	if limit > 0 && len(matches) > int(limit) {
+		matches = matches[:limit]
+		last := matches[len(matches)-1]
+		next = &users.MatchesCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	return matches, next, nil
+}
+
+// compareMatches is positive when m is listed after the cursor, matches are listed newest first.
+func compareMatches(m *users.Match, after *users.MatchesCursor) int {
+	if c := after.CreatedAt.Compare(m.CreatedAt); c != 0 {
+		return c
+	}
+	return cmp.Compare(after.ID, m.ID)
+}
+
+// Unmatch records the unmatch event and deletes the match.
+func (u *User) Unmatch(_ context.Context, unmatch *users.Unmatch) error {
+	stored, err := clone(unmatch)
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.unmatches = append(u.unmatches, stored)
+	delete(u.matches, unmatch.MatchID)
+	return nil
+}
+
+func (u *User) GetUnmatchedIDs(_ context.Context, ID int32) ([]int32, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	IDs := make([]int32, 0)
+	for _, unmatch := range u.unmatches {
+		if slices.Contains(unmatch.UserIDs, ID) {
+			IDs = append(IDs, otherIDs(ID, unmatch.UserIDs)...)
+		}
+	}
+	return IDs, nil
+}
+
+// hidden returns ID with the users ID unmatched, blocked or was blocked by, the lock must be held.
+func (u *User) hidden(ID int32) map[int32]bool {
+	hidden := map[int32]bool{ID: true}
+	for _, unmatch := range u.unmatches {
+		if slices.Contains(unmatch.UserIDs, ID) {
+			for _, other := range otherIDs(ID, unmatch.UserIDs) {
+				hidden[other] = true
+			}
+		}
+	}
+	for key := range u.blocks {
+		switch ID {
+		case key.blockerID:
+			hidden[key.blockedID] = true
+		case key.blockedID:
+			hidden[key.blockerID] = true
+		}
+	}
+	return hidden
+}
+
+// Block is idempotent, blocking the same user twice keeps the first block.
+func (u *User) Block(_ context.Context, block *users.Block) error {
+	stored, err := clone(block)
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := blockKey{blockerID: block.BlockerID, blockedID: block.BlockedID}
+	if _, ok := u.blocks[key]; !ok {
+		u.blocks[key] = stored
+	}
+	return nil
+}
+
+// GetBlockedIDs returns the users blocked by ID as well as the users who blocked ID.
+func (u *User) GetBlockedIDs(_ context.Context, ID int32) ([]int32, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	IDs := make([]int32, 0)
+	for key := range u.blocks {
+		switch ID {
+		case key.blockerID:
+			IDs = append(IDs, key.blockedID)
+		case key.blockedID:
+			IDs = append(IDs, key.blockerID)
+		}
+	}
+	return IDs, nil
+}
+
+func (u *User) CreateReport(_ context.Context, report *users.Report) (*users.Report, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	stored, err := clone(report)
+	if err != nil {
+		return nil, err
+	}
+	u.lastReportID++
+	report.ID, stored.ID = u.lastReportID, u.lastReportID
+	u.reports = append(u.reports, stored)
+	return report, nil
+}
+
+// ListReports lists the reports newest first, like persistence.User.
+func (u *User) ListReports(_ context.Context, filter *users.ReportFilter) ([]*users.Report, *users.ReportsCursor, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	reports := make([]*users.Report, 0)
+	// reports are appended with increasing IDs, going backwards lists them newest first
+	for i := len(u.reports) - 1; i >= 0; i-- {
+		stored := u.reports[i]
+		if !reportMatches(stored, filter) {
+			continue
+		}
+		report, err := clone(stored)
+		if err != nil {
+			return nil, nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	var next *users.ReportsCursor
+	if filter.Limit > 0 && len(reports) > int(filter.Limit) {
+		reports = reports[:filter.Limit]
+		next = &users.ReportsCursor{ID: reports[len(reports)-1].ID}
+	}
+	return reports, next, nil
+}
+
+func reportMatches(report *users.Report, filter *users.ReportFilter) bool {
+	switch {
+	case filter.Status != "" && report.Status != filter.Status,
+		filter.Reason != "" && report.Reason != filter.Reason,
+		filter.ReporterID > 0 && report.ReporterID != filter.ReporterID,
+		filter.ReportedID > 0 && report.ReportedID != filter.ReportedID,
+		filter.After != nil && report.ID >= filter.After.ID:
+		return false
+	}
+	return true
+}
+
+// Moderate keeps the decision on the user and appends it to the user history.
+func (u *User) Moderate(_ context.Context, moderation *users.Moderation) (*users.User, error) {
+	stored, err := clone(moderation)
+	if err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	user, ok := u.users[moderation.UserID]
+	if !ok {
+		return nil, users.ErrUserNotFound
+	}
+	if user.Moderation, err = clone(stored); err != nil {
+		return nil, err
+	}
+	u.moderations = append(u.moderations, stored)
+	return clone(user)
+}
+
+// GetModerations returns the moderation decisions taken on ID, newest first.
+func (u *User) GetModerations(_ context.Context, ID int32) ([]*users.Moderation, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	moderations := make([]*users.Moderation, 0)
+	for i := len(u.moderations) - 1; i >= 0; i-- {
+		if u.moderations[i].UserID != ID {
+			continue
+		}
+		moderation, err := clone(u.moderations[i])
+		if err != nil {
+			return nil, err
+		}
+		moderations = append(moderations, moderation)
+	}
+	slices.SortStableFunc(moderations, func(a, b *users.Moderation) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return moderations, nil
+}
+
+func (u *User) GetDeletedUserIDs(_ context.Context, deletedBefore time.Time) ([]int32, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	IDs := make([]int32, 0)
+	for _, user := range u.users {
+		if user.DeletedAt != nil && user.DeletedAt.Before(deletedBefore) {
+			IDs = append(IDs, user.ID)
+		}
+	}
+	slices.Sort(IDs)
+	return IDs, nil
+}
+
+func (u *User) PurgeUser(_ context.Context, ID int32) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for key := range u.swipes {
+		if key.swiperID == ID || key.swipedID == ID {
+			delete(u.swipes, key)
+		}
+	}
+	for matchID, match := range u.matches {
+		if slices.Contains(match.UserIDs, ID) {
+			delete(u.matches, matchID)
+		}
+	}
+	u.unmatches = slices.DeleteFunc(u.unmatches, func(unmatch *users.Unmatch) bool {
+		return slices.Contains(unmatch.UserIDs, ID)
+	})
+	for key := range u.blocks {
+		if key.blockerID == ID || key.blockedID == ID {
+			delete(u.blocks, key)
+		}
+	}
+	u.reports = slices.DeleteFunc(u.reports, func(report *users.Report) bool {
+		return report.ReporterID == ID || report.ReportedID == ID
+	})
+	u.moderations = slices.DeleteFunc(u.moderations, func(moderation *users.Moderation) bool {
+		return moderation.UserID == ID
+	})
+	delete(u.users, ID)
+	return nil
+}
+
+func otherIDs(ID int32, IDs []int32) []int32 {
+	others := make([]int32, 0, len(IDs))
+	for _, other := range IDs {
+		if other != ID {
+			others = append(others, other)
+		}
+	}
+	return others
+}
+
+func uniqueIDs(IDs []int32) []int32 {
+	unique := slices.Clone(IDs)
+	slices.Sort(unique)
+	return slices.Compact(unique)
+}
+
+// clone deep copies a document through BSON, the way MongoDB would store and return it.
+func clone[T any](v *T) (*T, error) {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	copied := new(T)
+	if err = bson.Unmarshal(data, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
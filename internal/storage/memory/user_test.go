@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/muzzapp/date-api/internal/storage/storetest"
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUser_Discover(t *testing.T) {
+	ctx := context.Background()
+	store := NewUser()
+	requester, err := store.CreateUser(ctx, storetest.NewUser("me", "male", 30, 0))
+	require.NoError(t, err)
+	_, err = store.CreateUser(ctx, storetest.NewUser("far", "female", 30, 1))
+	require.NoError(t, err)
+	near, err := store.CreateUser(ctx, storetest.NewUser("near", "male", 45, 0.1))
+	require.NoError(t, err)
+	filter := &users.DiscoverFilter{ID: requester.ID, Location: requester.Location}
+
+	t.Run("max distance and swipes exclude profiles", func(t *testing.T) {
+		// given
+		require.NoError(t, store.Swipe(ctx, requester.ID, &users.Swipe{ID: near.ID, OK: false}))
+		limited := *filter
+		limited.MaxDistance = 50_000
+
+		// when
+		profiles, _, err := store.Discover(ctx, &limited)
+
+		// then
+		require.NoError(t, err)
+		require.Empty(t, profiles)
+	})
+}
+
+func TestUser_GetUser(t *testing.T) {
+	// given
+	ctx := context.Background()
+	store := NewUser()
+	user, err := store.CreateUser(ctx, storetest.NewUser("me", "male", 30, 2))
+	require.NoError(t, err)
+
+	// when
+	got, err := store.GetUser(ctx, user.ID)
+	require.NoError(t, err)
+	got.Location.Coordinates.Latitude = 50
+	again, err := store.GetUser(ctx, user.ID)
+
+	// then
+	require.NoError(t, err)
+	require.Equal(t, float64(2), again.Location.Coordinates.Latitude)
+}
@@ -0,0 +1,96 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/users"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+type Attempts struct {
+	collLoginAttempts *mongo.Collection
+	collLoginLockouts *mongo.Collection
+}
+
+const (
+	loginAttemptsColl = "login_attempts"
+	loginLockoutsColl = "login_lockouts"
+)
+
+var (
+	_ users.AttemptStore = (*Attempts)(nil)
+)
+
+func NewAttemptsPersistence(db *mongo.Database) *Attempts {
+	return &Attempts{
+		collLoginAttempts: db.Collection(loginAttemptsColl,
+			options.Collection().SetReadPreference(readpref.Primary()),
+		),
+		collLoginLockouts: db.Collection(loginLockoutsColl,
+			options.Collection().SetReadPreference(readpref.PrimaryPreferred()),
+		),
+	}
+}
+
+func (a *Attempts) GetLoginAttempts(ctx context.Context, key string) (*users.LoginAttempts, error) {
+	attempts := new(users.LoginAttempts)
+	if err := a.collLoginAttempts.FindOne(ctx, bson.M{"_id": key}).Decode(attempts); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &users.LoginAttempts{Key: key}, nil
+		}
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// IncrementLoginFailures counts the failure in a single update so concurrent failures are all counted. The TTL
+// index on expiresAt deletes the attempts once the window is over, unless a lockout lasts longer.
+func (a *Attempts) IncrementLoginFailures(ctx context.Context, key string, now time.Time, window time.Duration) (*users.LoginAttempts, error) {
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "failures", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$lt", Value: bson.A{
+					bson.D{{Key: "$ifNull", Value: bson.A{"$lastFailureAt", time.Time{}}}},
+					now.Add(-window),
+				}}},
+				1,
+				bson.D{{Key: "$add", Value: bson.A{"$failures", 1}}},
+			}}}},
+			{Key: "lastFailureAt", Value: now},
+			{Key: "expiresAt", Value: bson.D{{Key: "$max", Value: bson.A{now.Add(window), "$lockedUntil"}}}},
+		}}},
+	}
+	attempts := new(users.LoginAttempts)
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := a.collLoginAttempts.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(attempts); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+func (a *Attempts) LockLogin(ctx context.Context, key string, until time.Time) error {
+	update := bson.M{"$set": bson.M{"lockedUntil": until}, "$max": bson.M{"expiresAt": until}}
+	if _, err := a.collLoginAttempts.UpdateOne(ctx, bson.M{"_id": key}, update, options.Update().SetUpsert(true)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a *Attempts) ResetLoginAttempts(ctx context.Context, key string) error {
+	if _, err := a.collLoginAttempts.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a *Attempts) CreateLoginLockout(ctx context.Context, lockout *users.LoginLockout) error {
+	if _, err := a.collLoginLockouts.InsertOne(ctx, lockout); err != nil {
+		return err
+	}
+	return nil
+}
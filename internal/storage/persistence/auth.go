@@ -0,0 +1,99 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+type Auth struct {
+	collRefreshTokens *mongo.Collection
+	collRevokedTokens *mongo.Collection
+}
+
+const (
+	refreshTokensColl = "refresh_tokens"
+	revokedTokensColl = "revoked_tokens"
+)
+
+var (
+	_ auth.Store = (*Auth)(nil)
+)
+
+func NewAuthPersistence(db *mongo.Database) *Auth {
+	return &Auth{
+		collRefreshTokens: db.Collection(refreshTokensColl,
+			options.Collection().SetReadPreference(readpref.PrimaryPreferred()),
+		),
+		collRevokedTokens: db.Collection(revokedTokensColl,
+			options.Collection().SetReadPreference(readpref.PrimaryPreferred()),
+		),
+	}
+}
+
+func (a *Auth) CreateRefreshToken(ctx context.Context, token *auth.RefreshToken) error {
+	if _, err := a.collRefreshTokens.InsertOne(ctx, token); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a *Auth) GetRefreshToken(ctx context.Context, ID string) (*auth.RefreshToken, error) {
+	token := new(auth.RefreshToken)
+	if err := a.collRefreshTokens.FindOne(ctx, bson.M{"_id": ID}).Decode(token); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			err = auth.ErrRefreshTokenNotFound
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+func (a *Auth) RevokeRefreshToken(ctx context.Context, ID string, now time.Time) (bool, error) {
+	filter := bson.M{"_id": ID, "revokedAt": bson.M{"$exists": false}}
+	res, err := a.collRefreshTokens.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revokedAt": now}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+func (a *Auth) RevokeRefreshTokenFamily(ctx context.Context, familyID string, now time.Time) error {
+	filter := bson.M{"familyID": familyID, "revokedAt": bson.M{"$exists": false}}
+	if _, err := a.collRefreshTokens.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revokedAt": now}}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a *Auth) RevokeUserRefreshTokens(ctx context.Context, userID int32, now time.Time) error {
+	filter := bson.M{"userID": userID, "revokedAt": bson.M{"$exists": false}}
+	if _, err := a.collRefreshTokens.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revokedAt": now}}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RevokeAccessToken is idempotent, revoking a token twice keeps the first revocation.
+func (a *Auth) RevokeAccessToken(ctx context.Context, token *auth.RevokedToken) error {
+	update := bson.M{"$setOnInsert": bson.M{"expiresAt": token.ExpiresAt}}
+	opts := options.Update().SetUpsert(true)
+	if _, err := a.collRevokedTokens.UpdateOne(ctx, bson.M{"_id": token.JTI}, update, opts); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a *Auth) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	count, err := a.collRevokedTokens.CountDocuments(ctx, bson.M{"_id": jti}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,92 @@
+package persistence
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/muzzapp/date-api/internal/users"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var coordinatesType = reflect.TypeOf(users.Coordinates{})
+
+// registry is the default registry with the codecs of the users types stored differently than their fields.
+var registry = newRegistry()
+
+func newRegistry() *bsoncodec.Registry {
+	reg := bson.NewRegistry()
+	reg.RegisterTypeEncoder(coordinatesType, bsoncodec.ValueEncoderFunc(encodeCoordinates))
+	reg.RegisterTypeDecoder(coordinatesType, bsoncodec.ValueDecoderFunc(decodeCoordinates))
+	return reg
+}
+
+// withCodecs returns db encoding and decoding with registry.
+func withCodecs(db *mongo.Database) *mongo.Database {
+	return db.Client().Database(db.Name(), options.Database().SetRegistry(registry))
+}
+
+// encodeCoordinates writes the coordinates as a GeoJSON [longitude, latitude] pair so the location can be used by
+// a 2dsphere index.
+func encodeCoordinates(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != coordinatesType {
+		return bsoncodec.ValueEncoderError{Name: "encodeCoordinates", Types: []reflect.Type{coordinatesType}, Received: val}
+	}
+	c := val.Interface().(users.Coordinates)
+	aw, err := vw.WriteArray()
+	if err != nil {
+		return err
+	}
+	for _, v := range []float64{c.Longitude, c.Latitude} {
+		ew, err := aw.WriteArrayElement()
+		if err != nil {
+			return err
+		}
+		if err = ew.WriteDouble(v); err != nil {
+			return err
+		}
+	}
+	return aw.WriteArrayEnd()
+}
+
+// decodeCoordinates reads GeoJSON pairs as well as the legacy {longitude, latitude} documents
+// written before the location migration.
+func decodeCoordinates(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != coordinatesType {
+		return bsoncodec.ValueDecoderError{Name: "decodeCoordinates", Types: []reflect.Type{coordinatesType}, Received: val}
+	}
+	t, data, err := bsonrw.Copier{}.CopyValueToBytes(vr)
+	if err != nil {
+		return err
+	}
+	raw := bson.RawValue{Type: t, Value: data}
+	var c users.Coordinates
+	switch t {
+	case bsontype.Array:
+		var pair []float64
+		if err = raw.Unmarshal(&pair); err != nil {
+			return err
+		}
+		if len(pair) != 2 {
+			return fmt.Errorf("coordinates: expected [longitude, latitude], got %d values", len(pair))
+		}
+		c.Longitude, c.Latitude = pair[0], pair[1]
+	case bsontype.EmbeddedDocument:
+		var legacy struct {
+			Longitude float64 `bson:"longitude"`
+			Latitude  float64 `bson:"latitude"`
+		}
+		if err = raw.Unmarshal(&legacy); err != nil {
+			return err
+		}
+		c.Longitude, c.Latitude = legacy.Longitude, legacy.Latitude
+	default:
+		return fmt.Errorf("coordinates: unexpected bson type %s", t)
+	}
+	val.Set(reflect.ValueOf(c))
+	return nil
+}
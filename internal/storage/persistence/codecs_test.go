@@ -0,0 +1,66 @@
+package persistence
+
+import (
+	"testing"
+
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCoordinatesCodec(t *testing.T) {
+	t.Run("coordinates are written as a GeoJSON pair", func(t *testing.T) {
+		// given
+		location := &users.Location{Type: "Point", Coordinates: &users.Coordinates{Longitude: -0.12, Latitude: 51.5}}
+
+		// when
+		data, err := bson.MarshalWithRegistry(registry, location)
+		require.NoError(t, err)
+
+		// then
+		var raw bson.M
+		require.NoError(t, bson.Unmarshal(data, &raw))
+		require.Equal(t, bson.M{"type": "Point", "coordinates": bson.A{-0.12, 51.5}}, raw)
+	})
+
+	t.Run("GeoJSON pairs are read back", func(t *testing.T) {
+		// given
+		data, err := bson.Marshal(bson.M{"type": "Point", "coordinates": bson.A{-0.12, 51.5}})
+		require.NoError(t, err)
+
+		// when
+		location := new(users.Location)
+		require.NoError(t, bson.UnmarshalWithRegistry(registry, data, location))
+
+		// then
+		require.Equal(t, []float64{-0.12, 51.5}, location.CoordinatesFloat64Slice())
+	})
+
+	t.Run("legacy coordinates documents are still readable", func(t *testing.T) {
+		// given
+		data, err := bson.Marshal(bson.M{
+			"type":        "Point",
+			"coordinates": bson.M{"longitude": -0.12, "latitude": 51.5},
+		})
+		require.NoError(t, err)
+
+		// when
+		location := new(users.Location)
+		require.NoError(t, bson.UnmarshalWithRegistry(registry, data, location))
+
+		// then
+		require.Equal(t, []float64{-0.12, 51.5}, location.CoordinatesFloat64Slice())
+	})
+
+	t.Run("malformed coordinates are rejected", func(t *testing.T) {
+		// given
+		data, err := bson.Marshal(bson.M{"type": "Point", "coordinates": bson.A{1.0}})
+		require.NoError(t, err)
+
+		// when
+		err = bson.UnmarshalWithRegistry(registry, data, new(users.Location))
+
+		// then
+		require.Error(t, err)
+	})
+}
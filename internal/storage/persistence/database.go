@@ -4,10 +4,16 @@ import "go.mongodb.org/mongo-driver/mongo"
 
 type Database struct {
 	*User
+	*Auth
+	*Attempts
+	*Tokens
 }
 
 func New(db *mongo.Database) *Database {
 	return &Database{
-		User: NewItemPersistence(db),
+		User:     NewItemPersistence(db),
+		Auth:     NewAuthPersistence(db),
+		Attempts: NewAttemptsPersistence(db),
+		Tokens:   NewTokensPersistence(db),
 	}
 }
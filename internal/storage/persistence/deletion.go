@@ -0,0 +1,68 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (u *User) GetDeletedUserIDs(ctx context.Context, deletedBefore time.Time) ([]int32, error) {
+	filter := bson.M{"deletedAt": bson.M{"$lt": deletedBefore}}
+	cursor, err := u.coll.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		ID int32 `bson:"_id"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	IDs := make([]int32, len(results))
+	for i, result := range results {
+		IDs[i] = result.ID
+	}
+	return IDs, nil
+}
+
+// PurgeUser deletes the user document last, so a failed purge is retried on the next run.
+func (u *User) PurgeUser(ctx context.Context, ID int32) error {
+	if _, err := u.collSwipes.DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"swiperID": ID},
+		bson.M{"swipedID": ID},
+	}}); err != nil {
+		return err
+	}
+	if _, err := u.collMatches.DeleteMany(ctx, bson.M{"userIDs": ID}); err != nil {
+		return err
+	}
+	if _, err := u.collUnmatches.DeleteMany(ctx, bson.M{"userIDs": ID}); err != nil {
+		return err
+	}
+	if _, err := u.collBlocks.DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"blockerID": ID},
+		bson.M{"blockedID": ID},
+	}}); err != nil {
+		return err
+	}
+	if _, err := u.collReports.DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"reporterID": ID},
+		bson.M{"reportedID": ID},
+	}}); err != nil {
+		return err
+	}
+	for _, coll := range []*mongo.Collection{u.collModerations, u.collRefreshTokens, u.collOneTimeTokens} {
+		if _, err := coll.DeleteMany(ctx, bson.M{"userID": ID}); err != nil {
+			return err
+		}
+	}
+	if _, err := u.coll.DeleteOne(ctx, bson.M{"_id": ID}); err != nil {
+		return err
+	}
+	return nil
+}
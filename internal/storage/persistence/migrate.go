@@ -0,0 +1,283 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const (
+	migrationsColl     = "migrations"
+	migrationLocksColl = "migration_locks"
+
+	// migrationLockID is the single lock document every migrator competes for
+	migrationLockID = "migrations"
+)
+
+var (
+	ErrIrreversibleMigration = errors.New("migration cannot be reverted")
+	ErrUnknownMigration      = errors.New("unknown migration version")
+)
+
+// Migration is a versioned change of the schema or the data. A step interrupted midway is not recorded and runs
+// again, so Up and Down must be safe to repeat. Down is nil when the step cannot be reverted.
+type Migration struct {
+	Version     int32
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+	Down        func(ctx context.Context, db *mongo.Database) error
+}
+
+// MigrationRecord is the document kept in the migrations collection for every applied version.
+type MigrationRecord struct {
+	Version     int32     `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+// MigrationStatus is a known migration and when it was applied, AppliedAt is nil while pending.
+type MigrationStatus struct {
+	Version     int32
+	Description string
+	AppliedAt   *time.Time
+}
+
+// Migrator applies and reverts the migrations, holding a lock document so concurrent runs wait for each other.
+type Migrator struct {
+	db             *mongo.Database
+	collMigrations *mongo.Collection
+	collLocks      *mongo.Collection
+	migrations     []Migration
+	owner          string
+	lockTTL        time.Duration
+	lockRetry      time.Duration
+}
+
+func NewMigrator(db *mongo.Database) *Migrator {
+	return newMigrator(db, migrations)
+}
+
+func newMigrator(db *mongo.Database, migrations []Migration) *Migrator {
+	return &Migrator{
+		db: db,
+		collMigrations: db.Collection(migrationsColl,
+			options.Collection().SetReadPreference(readpref.Primary()),
+		),
+		collLocks: db.Collection(migrationLocksColl,
+			options.Collection().SetReadPreference(readpref.Primary()),
+		),
+		migrations: migrations,
+		owner:      primitive.NewObjectID().Hex(),
+		lockTTL:    10 * time.Minute,
+		lockRetry:  time.Second,
+	}
+}
+
+// Status lists every known migration in version order.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = MigrationStatus{Version: migration.Version, Description: migration.Description}
+		if record, ok := applied[migration.Version]; ok {
+			statuses[i].AppliedAt = &record.AppliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// Up applies the pending migrations up to version to, every pending migration when to is zero.
+func (m *Migrator) Up(ctx context.Context, to int32) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		steps, err := planUp(m.migrations, applied, to)
+		if err != nil {
+			return err
+		}
+		for _, migration := range steps {
+			if err = m.refreshLock(ctx); err != nil {
+				return err
+			}
+			if err = migration.Up(ctx, m.db); err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Description, err)
+			}
+			record := &MigrationRecord{
+				Version:     migration.Version,
+				Description: migration.Description,
+				AppliedAt:   time.Now().UTC(),
+			}
+			if _, err = m.collMigrations.InsertOne(ctx, record); err != nil {
+				return err
+			}
+			slog.Info("mongodb migration applied", "version", migration.Version, "description", migration.Description)
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the applied migrations above version to, newest first, every migration when to is zero.
+// Nothing is reverted when one of them is irreversible.
+func (m *Migrator) Down(ctx context.Context, to int32) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		steps, err := planDown(m.migrations, applied, to)
+		if err != nil {
+			return err
+		}
+		for _, migration := range steps {
+			if err = m.refreshLock(ctx); err != nil {
+				return err
+			}
+			if err = migration.Down(ctx, m.db); err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Description, err)
+			}
+			if _, err = m.collMigrations.DeleteOne(ctx, bson.M{"_id": migration.Version}); err != nil {
+				return err
+			}
+			slog.Info("mongodb migration reverted", "version", migration.Version, "description", migration.Description)
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int32]MigrationRecord, error) {
+	cursor, err := m.collMigrations.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []MigrationRecord
+	if err = cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := make(map[int32]MigrationRecord, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// planUp returns the pending migrations up to version to, in version order.
+func planUp(migrations []Migration, applied map[int32]MigrationRecord, to int32) ([]Migration, error) {
+	if to != 0 && !known(migrations, to) {
+		return nil, fmt.Errorf("%w %d", ErrUnknownMigration, to)
+	}
+	var steps []Migration
+	for _, migration := range migrations {
+		if to != 0 && migration.Version > to {
+			break
+		}
+		if _, ok := applied[migration.Version]; !ok {
+			steps = append(steps, migration)
+		}
+	}
+	return steps, nil
+}
+
+// planDown returns the applied migrations above version to, newest first.
+func planDown(migrations []Migration, applied map[int32]MigrationRecord, to int32) ([]Migration, error) {
+	if to != 0 && !known(migrations, to) {
+		return nil, fmt.Errorf("%w %d", ErrUnknownMigration, to)
+	}
+	var steps []Migration
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version <= to {
+			break
+		}
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return nil, fmt.Errorf("%w: %d %s", ErrIrreversibleMigration, migration.Version, migration.Description)
+		}
+		steps = append(steps, migration)
+	}
+	return steps, nil
+}
+
+func known(migrations []Migration, version int32) bool {
+	return slices.ContainsFunc(migrations, func(migration Migration) bool {
+		return migration.Version == version
+	})
+}
+
+// locked runs fn while holding the lock document, waiting for the other migrators to release it. A lock left by
+// a crashed run expires after lockTTL, it is refreshed before every step so long migrations keep it.
+func (m *Migrator) locked(ctx context.Context, fn func() error) error {
+	for {
+		acquired, err := m.lock(ctx)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			break
+		}
+		slog.Info("waiting for the mongodb migration lock")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.lockRetry):
+		}
+	}
+	defer func() {
+		if _, err := m.collLocks.DeleteOne(context.WithoutCancel(ctx),
+			bson.M{"_id": migrationLockID, "owner": m.owner}); err != nil {
+			slog.Error("Migrator unlock", "err", err)
+		}
+	}()
+	return fn()
+}
+
+// lock takes the lock unless another migrator holds it, the upsert of a held lock is a duplicate key.
+func (m *Migrator) lock(ctx context.Context) (bool, error) {
+	now := time.Now().UTC()
+	filter := bson.D{
+		{Key: "_id", Value: migrationLockID},
+		{Key: "lockedUntil", Value: bson.D{{Key: "$lt", Value: now}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "owner", Value: m.owner},
+		{Key: "lockedUntil", Value: now.Add(m.lockTTL)},
+	}}}
+	_, err := m.collLocks.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (m *Migrator) refreshLock(ctx context.Context) error {
+	update := bson.M{"$set": bson.M{"lockedUntil": time.Now().UTC().Add(m.lockTTL)}}
+	result, err := m.collLocks.UpdateOne(ctx, bson.M{"_id": migrationLockID, "owner": m.owner}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("the mongodb migration lock expired")
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/storage/mongoclient"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func testMigrations() []Migration {
+	noop := func(context.Context, *mongo.Database) error { return nil }
+	return []Migration{
+		{Version: 1, Description: "one", Up: noop},
+		{Version: 2, Description: "two", Up: noop, Down: noop},
+		{Version: 3, Description: "three", Up: noop, Down: noop},
+	}
+}
+
+func versions(migrations []Migration) []int32 {
+	var versions []int32
+	for _, migration := range migrations {
+		versions = append(versions, migration.Version)
+	}
+	return versions
+}
+
+func TestPlanUp(t *testing.T) {
+	applied := map[int32]MigrationRecord{1: {Version: 1}}
+
+	t.Run("every pending migration in order", func(t *testing.T) {
+		// when
+		steps, err := planUp(testMigrations(), applied, 0)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, []int32{2, 3}, versions(steps))
+	})
+
+	t.Run("up to a version", func(t *testing.T) {
+		// when
+		steps, err := planUp(testMigrations(), applied, 2)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, []int32{2}, versions(steps))
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		// when
+		_, err := planUp(testMigrations(), applied, 7)
+
+		// then
+		require.ErrorIs(t, err, ErrUnknownMigration)
+	})
+}
+
+func TestPlanDown(t *testing.T) {
+	applied := map[int32]MigrationRecord{1: {Version: 1}, 3: {Version: 3}}
+
+	t.Run("applied migrations above the version, newest first", func(t *testing.T) {
+		// when
+		steps, err := planDown(testMigrations(), applied, 1)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, []int32{3}, versions(steps))
+	})
+
+	t.Run("nothing is reverted past an irreversible migration", func(t *testing.T) {
+		// when
+		steps, err := planDown(testMigrations(), applied, 0)
+
+		// then
+		require.ErrorIs(t, err, ErrIrreversibleMigration)
+		require.Empty(t, steps)
+	})
+}
+
+func TestIndexName(t *testing.T) {
+	require.Equal(t, "location_2dsphere", indexName(bson.D{{Key: "location", Value: "2dsphere"}}))
+	require.Equal(t, "userIDs_1_createdAt_-1__id_-1", indexName(matchesIndex.Keys.(bson.D)))
+}
+
+// TestMigrator runs against the MongoDB of MONGODB_URI in a throwaway database.
+func TestMigrator(t *testing.T) {
+	if os.Getenv("MONGODB_URI") == "" {
+		t.Skip("MONGODB_URI is not set")
+	}
+	ctx := context.Background()
+	db, err := mongoclient.GetDatabase(mongoclient.WithDatabaseName(fmt.Sprintf("date_migrate_%d", time.Now().UnixNano())))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Drop(ctx)
+		_ = db.Client().Disconnect(ctx)
+	})
+	_, err = db.Collection(usersColl).InsertOne(ctx, bson.M{
+		"_id":      int32(1),
+		"email":    "legacy@test.com",
+		"location": bson.M{"type": "Point", "coordinates": bson.M{"longitude": -0.1, "latitude": 51.5}},
+	})
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	_, err = db.Collection(swipesColl).InsertMany(ctx, []any{
+		bson.M{"swiperID": int32(1), "swipedID": int32(2), "ok": true, "createdAt": now, "updatedAt": now},
+		bson.M{"swiperID": int32(2), "swipedID": int32(1), "ok": true, "createdAt": now, "updatedAt": now},
+		bson.M{"swiperID": int32(1), "swipedID": int32(3), "ok": true, "createdAt": now, "updatedAt": now},
+		bson.M{"swiperID": int32(3), "swipedID": int32(1), "ok": true, "createdAt": now, "updatedAt": now},
+	})
+	require.NoError(t, err)
+	_, err = db.Collection(unmatchesColl).InsertOne(ctx, bson.M{
+		"matchID": "1-3", "userIDs": bson.A{int32(1), int32(3)}, "initiatorID": int32(1), "createdAt": now,
+	})
+	require.NoError(t, err)
+
+	t.Run("up fixes the data then creates the indexes", func(t *testing.T) {
+		// when
+		done, err := NewMigrator(db).Up(ctx, 0)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, []int32{1, 2, 3, 4, 5, 6}, versions(done))
+		var user bson.M
+		require.NoError(t, db.Collection(usersColl).FindOne(ctx, bson.M{"_id": 1}).Decode(&user))
+		require.Equal(t, bson.A{-0.1, 51.5}, user["location"].(bson.M)["coordinates"])
+		require.Equal(t, true, user["emailVerified"])
+		specs, err := db.Collection(usersColl).Indexes().ListSpecifications(ctx)
+		require.NoError(t, err)
+		var names []string
+		for _, spec := range specs {
+			names = append(names, spec.Name)
+		}
+		require.Subset(t, names, []string{"location_2dsphere", "email_1", "age.value_1", "gender_1"})
+		matchIDs, err := db.Collection(matchesColl).Distinct(ctx, "_id", bson.M{})
+		require.NoError(t, err)
+		require.Equal(t, []any{"1-2"}, matchIDs)
+	})
+
+	t.Run("up again has nothing to do", func(t *testing.T) {
+		// when
+		done, err := NewMigrator(db).Up(ctx, 0)
+
+		// then
+		require.NoError(t, err)
+		require.Empty(t, done)
+	})
+
+	t.Run("down reverts the indexes and stops at the irreversible data migrations", func(t *testing.T) {
+		// when
+		done, err := NewMigrator(db).Down(ctx, 4)
+		require.NoError(t, err)
+		_, err = NewMigrator(db).Down(ctx, 0)
+
+		// then
+		require.Equal(t, []int32{6, 5}, versions(done))
+		require.ErrorIs(t, err, ErrIrreversibleMigration)
+		statuses, err := NewMigrator(db).Status(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, statuses[3].AppliedAt)
+		require.Nil(t, statuses[4].AppliedAt)
+		require.Nil(t, statuses[5].AppliedAt)
+	})
+
+	t.Run("a held lock makes the other migrators wait", func(t *testing.T) {
+		// given
+		holder := NewMigrator(db)
+		acquired, err := holder.lock(ctx)
+		require.NoError(t, err)
+		require.True(t, acquired)
+		waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		waiter := NewMigrator(db)
+		waiter.lockRetry = 10 * time.Millisecond
+
+		// when
+		_, err = waiter.Up(waitCtx, 0)
+
+		// then
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
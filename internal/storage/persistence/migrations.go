@@ -0,0 +1,268 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrations are applied in this order, 1 to 4 were the mongosh scripts of the migrations directory and keep their
+// numbers. The data is fixed before the indexes are created since the 2dsphere index refuses the legacy locations.
+var migrations = []Migration{
+	{Version: 1, Description: "rewrite legacy locations as GeoJSON points", Up: migrateLocationGeoJSON},
+	{Version: 2, Description: "move the embedded swipes to the swipes collection", Up: migrateSwipesCollection},
+	{Version: 3, Description: "record the matches made before the matches collection", Up: migrateMatchesBackfill},
+	{Version: 4, Description: "mark the users registered before email verification as verified", Up: migrateEmailVerified},
+	{Version: 5, Description: "create the indexes", Up: createIndexes, Down: dropIndexes},
+	{Version: 6, Description: "expire the login attempts at their expiresAt", Up: migrateLoginAttemptsExpiry,
+		Down: keepLoginAttemptsExpiry},
+}
+
+// migrateLocationGeoJSON rewrites the legacy {longitude, latitude} coordinates as [longitude, latitude] pairs.
+func migrateLocationGeoJSON(ctx context.Context, db *mongo.Database) error {
+	filter := bson.M{"location.coordinates.longitude": bson.M{"$exists": true}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "location.coordinates", Value: bson.A{
+				"$location.coordinates.longitude", "$location.coordinates.latitude",
+			}},
+		}}},
+	}
+	_, err := db.Collection(usersColl).UpdateMany(ctx, filter, update)
+	return err
+}
+
+// migrateSwipesCollection moves the swipes embedded in users into the swipes collection, a swipe already in the
+// collection is newer and wins.
+func migrateSwipesCollection(ctx context.Context, db *mongo.Database) error {
+	collUsers, collSwipes := db.Collection(usersColl), db.Collection(swipesColl)
+	if _, err := collSwipes.Indexes().CreateOne(ctx, swipesIndex); err != nil {
+		return err
+	}
+
+	filter := bson.M{"swipes": bson.M{"$exists": true, "$ne": bson.A{}}}
+	cursor, err := collUsers.Find(ctx, filter, options.Find().SetProjection(bson.M{"swipes": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	now := time.Now().UTC()
+	for cursor.Next(ctx) {
+		var user struct {
+			ID     int32 `bson:"_id"`
+			Swipes []struct {
+				ID int32 `bson:"id"`
+				OK bool  `bson:"ok"`
+			} `bson:"swipes"`
+		}
+		if err = cursor.Decode(&user); err != nil {
+			return err
+		}
+		operations := make([]mongo.WriteModel, len(user.Swipes))
+		for i, swipe := range user.Swipes {
+			operations[i] = mongo.NewUpdateOneModel().
+				SetFilter(bson.D{{Key: "swiperID", Value: user.ID}, {Key: "swipedID", Value: swipe.ID}}).
+				SetUpdate(bson.M{"$setOnInsert": bson.M{"ok": swipe.OK, "createdAt": now, "updatedAt": now}}).
+				SetUpsert(true)
+		}
+		if _, err = collSwipes.BulkWrite(ctx, operations, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+	_, err = collUsers.UpdateMany(ctx, bson.M{"swipes": bson.M{"$exists": true}}, bson.M{"$unset": bson.M{"swipes": ""}})
+	return err
+}
+
+// migrateMatchesBackfill records the mutual yes swipes as matches, the existing matches are kept as they are.
+// Unmatching keeps the swipes so the unmatched pairs are skipped, or running it again would match them back.
+func migrateMatchesBackfill(ctx context.Context, db *mongo.Database) error {
+	if _, err := db.Collection(matchesColl).Indexes().CreateOne(ctx, matchesIndex); err != nil {
+		return err
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "ok", Value: true}}}},
+		{{Key: "$match", Value: bson.D{
+			{Key: "$expr", Value: bson.D{{Key: "$lt", Value: bson.A{"$swiperID", "$swipedID"}}}},
+		}}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: swipesColl},
+			{Key: "let", Value: bson.D{{Key: "swiperID", Value: "$swiperID"}, {Key: "swipedID", Value: "$swipedID"}}},
+			{Key: "pipeline", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.D{
+					{Key: "ok", Value: true},
+					{Key: "$expr", Value: bson.D{{Key: "$and", Value: bson.A{
+						bson.D{{Key: "$eq", Value: bson.A{"$swiperID", "$$swipedID"}}},
+						bson.D{{Key: "$eq", Value: bson.A{"$swipedID", "$$swiperID"}}},
+					}}}},
+				}}},
+			}},
+			{Key: "as", Value: "back"},
+		}}},
+		{{Key: "$unwind", Value: "$back"}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$concat", Value: bson.A{
+				bson.D{{Key: "$toString", Value: "$swiperID"}}, "-", bson.D{{Key: "$toString", Value: "$swipedID"}},
+			}}}},
+			{Key: "userIDs", Value: bson.A{"$swiperID", "$swipedID"}},
+			{Key: "createdAt", Value: bson.D{{Key: "$max", Value: bson.A{"$updatedAt", "$back.updatedAt"}}}},
+		}}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: unmatchesColl},
+			{Key: "localField", Value: "_id"},
+			{Key: "foreignField", Value: "matchID"},
+			{Key: "as", Value: "unmatches"},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "unmatches", Value: bson.A{}}}}},
+		{{Key: "$unset", Value: "unmatches"}},
+		{{Key: "$merge", Value: bson.D{
+			{Key: "into", Value: matchesColl},
+			{Key: "on", Value: "_id"},
+			{Key: "whenMatched", Value: "keepExisting"},
+			{Key: "whenNotMatched", Value: "insert"},
+		}}},
+	}
+	cursor, err := db.Collection(swipesColl).Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.Close(ctx)
+}
+
+// migrateEmailVerified trusts the users registered before email verification existed.
+func migrateEmailVerified(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection(usersColl).UpdateMany(ctx, bson.M{"emailVerified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"emailVerified": true}})
+	return err
+}
+
+// migrateLoginAttemptsExpiry replaces the TTL of a day after the last failure, which ignored LOGIN_FAILURE_WINDOW
+// and could delete a longer lockout, with the expiresAt written by persistence.Attempts.
+func migrateLoginAttemptsExpiry(ctx context.Context, db *mongo.Database) error {
+	coll := db.Collection(loginAttemptsColl)
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "expiresAt", Value: bson.D{{Key: "$max", Value: bson.A{
+				bson.D{{Key: "$add", Value: bson.A{"$lastFailureAt", int64(24 * time.Hour / time.Millisecond)}}},
+				"$lockedUntil",
+			}}}},
+		}}},
+	}
+	if _, err := coll.UpdateMany(ctx, bson.M{"expiresAt": bson.M{"$exists": false}}, update); err != nil {
+		return err
+	}
+	_, err := coll.Indexes().DropOne(ctx, indexName(bson.D{{Key: "lastFailureAt", Value: 1}}))
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	_, err = coll.Indexes().CreateMany(ctx, indexes[loginAttemptsColl])
+	return err
+}
+
+// keepLoginAttemptsExpiry has nothing to revert, the expiresAt index is dropped with the others by migration 5.
+func keepLoginAttemptsExpiry(context.Context, *mongo.Database) error {
+	return nil
+}
+
+var (
+	swipesIndex = mongo.IndexModel{
+		Keys:    bson.D{{Key: "swiperID", Value: 1}, {Key: "swipedID", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	matchesIndex = mongo.IndexModel{
+		Keys: bson.D{{Key: "userIDs", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
+	}
+)
+
+// indexes are the indexes of every collection, the TTL indexes delete the expired documents.
+var indexes = map[string][]mongo.IndexModel{
+	usersColl: {
+		{Keys: bson.D{{Key: "location", Value: "2dsphere"}}},
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "age.value", Value: 1}}},
+		{Keys: bson.D{{Key: "gender", Value: 1}}},
+		{Keys: bson.D{{Key: "deletedAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+	},
+	swipesColl: {
+		swipesIndex,
+		{Keys: bson.D{{Key: "swipedID", Value: 1}}},
+	},
+	matchesColl: {matchesIndex},
+	unmatchesColl: {
+		{Keys: bson.D{{Key: "userIDs", Value: 1}}},
+	},
+	blocksColl: {
+		{Keys: bson.D{{Key: "blockerID", Value: 1}, {Key: "blockedID", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "blockedID", Value: 1}}},
+	},
+	reportsColl: {
+		{Keys: bson.D{{Key: "reportedID", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: -1}}},
+	},
+	moderationsColl: {
+		{Keys: bson.D{{Key: "userID", Value: 1}, {Key: "createdAt", Value: -1}}},
+	},
+	refreshTokensColl: {
+		{Keys: bson.D{{Key: "familyID", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	revokedTokensColl: {
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	loginAttemptsColl: {
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	loginLockoutsColl: {
+		{Keys: bson.D{{Key: "key", Value: 1}, {Key: "createdAt", Value: -1}}},
+	},
+	oneTimeTokensColl: {
+		{Keys: bson.D{{Key: "userID", Value: 1}, {Key: "purpose", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+}
+
+// createIndexes creates the missing indexes, the ones created by the former createIndex.js script are kept.
+func createIndexes(ctx context.Context, db *mongo.Database) error {
+	for coll, models := range indexes {
+		if _, err := db.Collection(coll).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("%s indexes: %w", coll, err)
+		}
+	}
+	return nil
+}
+
+func dropIndexes(ctx context.Context, db *mongo.Database) error {
+	for coll, models := range indexes {
+		for _, model := range models {
+			_, err := db.Collection(coll).Indexes().DropOne(ctx, indexName(model.Keys.(bson.D)))
+			if err != nil && !isNotFound(err) {
+				return fmt.Errorf("%s indexes: %w", coll, err)
+			}
+		}
+	}
+	return nil
+}
+
+// indexName is the name MongoDB gives an index created without one, like email_1 or userIDs_1_createdAt_-1__id_-1.
+func indexName(keys bson.D) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s_%v", key.Key, key.Value)
+	}
+	return strings.Join(parts, "_")
+}
+
+// isNotFound tells whether the index or its collection is already gone.
+func isNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound")
+}
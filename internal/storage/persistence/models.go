@@ -1,6 +1,8 @@
 package persistence
 
 import (
+	"time"
+
 	"github.com/muzzapp/date-api/internal/users"
 	"go.mongodb.org/mongo-driver/bson"
 )
@@ -10,17 +12,98 @@ type Counter struct {
 	Value int32  `bson:"value"`
 }
 
-func matchFilter(ID, minAge, maxAge int32, gender string, IDs []int32) map[string]interface{} {
+type Swipe struct {
+	SwiperID  int32     `bson:"swiperID"`
+	SwipedID  int32     `bson:"swipedID"`
+	OK        bool      `bson:"ok"`
+	CreatedAt time.Time `bson:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// MatchWithUser is a match joined with the other user of the pair.
+type MatchWithUser struct {
+	users.Match `bson:",inline"`
+	User        *users.User `bson:"user"`
+}
+
+func (m *MatchWithUser) toMatch() *users.Match {
+	match := m.Match
+	match.Profile = &users.Profile{
+		ID:     m.User.ID,
+		Name:   m.User.Name,
+		Gender: m.User.Gender,
+	}
+	if m.User.Age != nil {
+		match.Profile.Age = m.User.Age.Value
+	}
+	return &match
+}
+
+func otherIDs(ID int32, IDs []int32) []int32 {
+	others := make([]int32, 0, len(IDs))
+	for _, other := range IDs {
+		if other != ID {
+			others = append(others, other)
+		}
+	}
+	return others
+}
+
+// notHiddenStage keeps the candidates none of hiddenLookupStages joined.
+var notHiddenStage = bson.D{{Key: "$match", Value: bson.D{
+	{Key: "swiped", Value: bson.D{{Key: "$size", Value: 0}}},
+	{Key: "unmatched", Value: bson.D{{Key: "$size", Value: 0}}},
+	{Key: "blocked", Value: bson.D{{Key: "$size", Value: 0}}},
+	{Key: "blocking", Value: bson.D{{Key: "$size", Value: 0}}},
+}}}
+
+// hiddenLookupStages join on every candidate the swipe of ID, their unmatch and the blocks between them, it is the
+// first half of the anti-join that excludes the swiped, unmatched and blocked profiles without loading them in memory.
+func hiddenLookupStages(ID int32) []bson.D {
+	return []bson.D{
+		existsLookupStage(swipesColl, "swipedID", bson.D{{Key: "swiperID", Value: ID}}, "swiped"),
+		existsLookupStage(unmatchesColl, "userIDs", bson.D{{Key: "userIDs", Value: ID}}, "unmatched"),
+		existsLookupStage(blocksColl, "blockedID", bson.D{{Key: "blockerID", Value: ID}}, "blocked"),
+		existsLookupStage(blocksColl, "blockerID", bson.D{{Key: "blockedID", Value: ID}}, "blocking"),
+	}
+}
+
+// existsLookupStage joins as the ID of at most one document of from whose foreignField is the candidate and
+// matching match.
+func existsLookupStage(from, foreignField string, match bson.D, as string) bson.D {
+	return bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: from},
+		{Key: "localField", Value: "_id"},
+		{Key: "foreignField", Value: foreignField},
+		{Key: "pipeline", Value: bson.A{
+			bson.D{{Key: "$match", Value: match}},
+			bson.D{{Key: "$limit", Value: 1}},
+			bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: 1}}}},
+		}},
+		{Key: "as", Value: as},
+	}}}
+}
+
+func matchFilter(filter *users.DiscoverFilter, now time.Time) map[string]interface{} {
 	filters := make(map[string]interface{})
-	idsFilter(ID, IDs, filters)
-	ageFilter(minAge, maxAge, filters)
-	genderFilter(gender, filters)
+	filters["_id"] = bson.D{{Key: "$ne", Value: filter.ID}}
+	ageFilter(filter.MinAge, filter.MaxAge, filters)
+	genderFilter(filter.Genders, filters)
+	mutualFilter(filter.RequesterGender, filter.RequesterAge, filters)
+	moderationFilter(now, filters)
+	if filter.VerifiedOnly {
+		filters["emailVerified"] = true
+	}
 	return filters
 }
 
-func idsFilter(ID int32, IDs []int32, filters map[string]interface{}) {
-	IDs = append(IDs, ID)
-	filters["_id"] = bson.D{{Key: "$nin", Value: IDs}}
+// moderationFilter hides banned and deleted users as well as suspended users until the end of their suspension.
+func moderationFilter(now time.Time, filters map[string]interface{}) {
+	filters["$or"] = bson.A{
+		bson.M{"moderation.status": bson.M{"$nin": bson.A{users.ModerationStatusBanned, users.ModerationStatusSuspended}}},
+		bson.M{"moderation.status": users.ModerationStatusSuspended, "moderation.until": bson.M{"$lte": now}},
+	}
+	filters["deletedAt"] = bson.M{"$exists": false}
 }
 
 func ageFilter(minAge, maxAge int32, filters map[string]interface{}) {
@@ -37,35 +120,169 @@ func ageFilter(minAge, maxAge int32, filters map[string]interface{}) {
 	}
 }
 
-func genderFilter(gender string, filters map[string]interface{}) {
+func genderFilter(genders []string, filters map[string]interface{}) {
+	switch len(genders) {
+	case 0:
+	case 1:
+		filters["gender"] = genders[0]
+	default:
+		filters["gender"] = bson.M{"$in": genders}
+	}
+}
+
+func userUpdateSet(update *users.UserUpdate) bson.M {
+	set := bson.M{}
+	if update.Password != nil {
+		set["password"] = *update.Password
+	}
+	if update.EmailVerified != nil {
+		set["emailVerified"] = *update.EmailVerified
+	}
+	if update.TwoFactor != nil {
+		set["twoFactor"] = update.TwoFactor
+	}
+	if update.DeletedAt != nil {
+		set["deletedAt"] = *update.DeletedAt
+	}
+	if update.Name != nil {
+		set["name"] = *update.Name
+	}
+	if update.Gender != nil {
+		set["gender"] = *update.Gender
+	}
+	if update.Bio != nil {
+		set["bio"] = *update.Bio
+	}
+	if update.Age != nil {
+		set["age"] = update.Age
+	}
+	if update.Location != nil {
+		set["location"] = update.Location
+	}
+	if update.Preferences != nil {
+		set["preferences"] = update.Preferences
+	}
+	return set
+}
+
+// mutualFilter only keeps the candidates whose saved preferences accept the requester,
+// missing or zero preferences accept everyone.
+func mutualFilter(gender string, age int32, filters map[string]interface{}) {
+	and := bson.A{}
 	if gender != "" {
-		filters["gender"] = gender
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"preferences.genders": bson.M{"$in": bson.A{nil, gender}}},
+			bson.M{"preferences.genders": bson.M{"$size": 0}},
+		}})
+	}
+	if age > 0 {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"preferences.maxAge": bson.M{"$in": bson.A{nil, 0}}},
+			bson.M{"preferences.maxAge": bson.M{"$gte": age}},
+		}})
+		filters["preferences.minAge"] = bson.M{"$not": bson.M{"$gt": age}}
+	}
+	if len(and) > 0 {
+		filters["$and"] = and
 	}
 }
 
 func rankStages(rank *users.Rank) (bson.D, bson.D) {
 	addFields := bson.D{}
-	sort := bson.D{}
 	if rank.MostCommonGender != "" {
 		genderField := bson.E{Key: "genderSort", Value: bson.D{
-			{"$cond", bson.A{
-				bson.D{{"$eq", bson.A{"$gender", rank.MostCommonGender}}},
+			{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$eq", Value: bson.A{"$gender", rank.MostCommonGender}}},
 				1,
 				2,
 			}},
 		}}
 		addFields = append(addFields, genderField)
-		sort = append(sort, bson.E{Key: "genderSort", Value: 1})
 	}
 
 	ageSortField := bson.E{Key: "ageSort", Value: bson.D{
 		{Key: "$abs", Value: bson.D{
-			{"$subtract", bson.A{"$age.value", rank.AvgAge}},
+			{Key: "$subtract", Value: bson.A{"$age.value", rank.AvgAge}},
 		}},
 	}}
 	addFields = append(addFields, ageSortField)
-	sort = append(sort, bson.E{Key: "ageSort", Value: 1})
-	sort = append(sort, bson.E{Key: "distanceFromMe", Value: 1})
 
-	return bson.D{{"$addFields", addFields}}, bson.D{{"$sort", sort}}
+	return bson.D{{Key: "$addFields", Value: addFields}}, bson.D{{Key: "$sort", Value: sortKeys(rank)}}
+}
+
+// sortKeys returns the discover sort order, _id is always last so every profile has a unique position to page from.
+func sortKeys(rank *users.Rank) bson.D {
+	sort := bson.D{}
+	if rank != nil {
+		if rank.MostCommonGender != "" {
+			sort = append(sort, bson.E{Key: "genderSort", Value: 1})
+		}
+		sort = append(sort, bson.E{Key: "ageSort", Value: 1})
+	}
+	sort = append(sort, bson.E{Key: "distanceFromMe", Value: 1}, bson.E{Key: "_id", Value: 1})
+	return sort
+}
+
+// afterCursorStage matches the profiles sorted after the cursor, comparing the sort keys lexicographically:
+// (k1 > v1) or (k1 == v1 and k2 > v2) or ...
+func afterCursorStage(rank *users.Rank, after *users.DiscoverCursor) bson.D {
+	values := map[string]interface{}{
+		"genderSort":     after.GenderSort,
+		"ageSort":        after.AgeSort,
+		"distanceFromMe": after.DistanceFromMe,
+		"_id":            after.ID,
+	}
+	keys := sortKeys(rank)
+	or := bson.A{}
+	for i, key := range keys {
+		clause := bson.D{}
+		for _, equal := range keys[:i] {
+			clause = append(clause, bson.E{Key: equal.Key, Value: values[equal.Key]})
+		}
+		clause = append(clause, bson.E{Key: key.Key, Value: bson.D{{Key: "$gt", Value: values[key.Key]}}})
+		or = append(or, clause)
+	}
+	return bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: or}}}}
+}
+
+func toDiscoverCursor(result bson.M) *users.DiscoverCursor {
+	return &users.DiscoverCursor{
+		GenderSort:     int32(toFloat64(result["genderSort"])),
+		AgeSort:        int32(toFloat64(result["ageSort"])),
+		DistanceFromMe: toFloat64(result["distanceFromMe"]),
+		ID:             result["_id"].(int32),
+	}
+}
+
+func toFloat64(v interface{}) float64 {
+	switch n := v.(type) {
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	default:
+		return 0
+	}
+}
+
+func reportsFilter(filter *users.ReportFilter) bson.D {
+	filters := bson.D{}
+	if filter.Status != "" {
+		filters = append(filters, bson.E{Key: "status", Value: filter.Status})
+	}
+	if filter.Reason != "" {
+		filters = append(filters, bson.E{Key: "reason", Value: filter.Reason})
+	}
+	if filter.ReporterID > 0 {
+		filters = append(filters, bson.E{Key: "reporterID", Value: filter.ReporterID})
+	}
+	if filter.ReportedID > 0 {
+		filters = append(filters, bson.E{Key: "reportedID", Value: filter.ReportedID})
+	}
+	if filter.After != nil {
+		filters = append(filters, bson.E{Key: "_id", Value: bson.D{{Key: "$lt", Value: filter.After.ID}}})
+	}
+	return filters
 }
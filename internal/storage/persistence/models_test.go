@@ -0,0 +1,289 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMatchFilter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	notModerated := bson.A{
+		bson.M{"moderation.status": bson.M{"$nin": bson.A{users.ModerationStatusBanned, users.ModerationStatusSuspended}}},
+		bson.M{"moderation.status": users.ModerationStatusSuspended, "moderation.until": bson.M{"$lte": now}},
+	}
+	notDeleted := bson.M{"$exists": false}
+
+	t.Run("requester filters and mutual preferences", func(t *testing.T) {
+		// given
+		filter := &users.DiscoverFilter{
+			ID:              1,
+			RequesterGender: "male",
+			RequesterAge:    30,
+			MinAge:          25,
+			MaxAge:          35,
+			Genders:         []string{"female"},
+		}
+
+		// when
+		filters := matchFilter(filter, now)
+
+		// then
+		require.Equal(t, map[string]interface{}{
+			"_id":       bson.D{{Key: "$ne", Value: int32(1)}},
+			"age.value": bson.M{"$gte": int32(25), "$lte": int32(35)},
+			"gender":    "female",
+			"$and": bson.A{
+				bson.M{"$or": bson.A{
+					bson.M{"preferences.genders": bson.M{"$in": bson.A{nil, "male"}}},
+					bson.M{"preferences.genders": bson.M{"$size": 0}},
+				}},
+				bson.M{"$or": bson.A{
+					bson.M{"preferences.maxAge": bson.M{"$in": bson.A{nil, 0}}},
+					bson.M{"preferences.maxAge": bson.M{"$gte": int32(30)}},
+				}},
+			},
+			"preferences.minAge": bson.M{"$not": bson.M{"$gt": int32(30)}},
+			"$or":                notModerated,
+			"deletedAt":          notDeleted,
+		}, filters)
+	})
+
+	t.Run("several genders are matched with $in", func(t *testing.T) {
+		// when
+		filters := matchFilter(&users.DiscoverFilter{ID: 1, Genders: []string{"female", "male"}}, now)
+
+		// then
+		require.Equal(t, bson.M{"$in": []string{"female", "male"}}, filters["gender"])
+	})
+
+	t.Run("requester without gender nor age skips the mutual filter", func(t *testing.T) {
+		// when
+		filters := matchFilter(&users.DiscoverFilter{ID: 1}, now)
+
+		// then
+		require.Equal(t, map[string]interface{}{
+			"_id":       bson.D{{Key: "$ne", Value: int32(1)}},
+			"$or":       notModerated,
+			"deletedAt": notDeleted,
+		}, filters)
+	})
+
+	t.Run("verified only hides unverified emails", func(t *testing.T) {
+		// when
+		filters := matchFilter(&users.DiscoverFilter{ID: 1, VerifiedOnly: true}, now)
+
+		// then
+		require.Equal(t, true, filters["emailVerified"])
+	})
+}
+
+func TestAfterCursorStage(t *testing.T) {
+	after := &users.DiscoverCursor{GenderSort: 1, AgeSort: 3, DistanceFromMe: 120.5, ID: 9}
+
+	t.Run("not ranked continues on distance and id", func(t *testing.T) {
+		// when
+		stage := afterCursorStage(nil, after)
+
+		// then
+		require.Equal(t, bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "distanceFromMe", Value: bson.D{{Key: "$gt", Value: 120.5}}}},
+			bson.D{{Key: "distanceFromMe", Value: 120.5}, {Key: "_id", Value: bson.D{{Key: "$gt", Value: int32(9)}}}},
+		}}}}}, stage)
+	})
+
+	t.Run("ranked continues on every sort key", func(t *testing.T) {
+		// when
+		stage := afterCursorStage(&users.Rank{AvgAge: 30, MostCommonGender: "female"}, after)
+
+		// then
+		require.Equal(t, bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "genderSort", Value: bson.D{{Key: "$gt", Value: int32(1)}}}},
+			bson.D{{Key: "genderSort", Value: int32(1)}, {Key: "ageSort", Value: bson.D{{Key: "$gt", Value: int32(3)}}}},
+			bson.D{{Key: "genderSort", Value: int32(1)}, {Key: "ageSort", Value: int32(3)},
+				{Key: "distanceFromMe", Value: bson.D{{Key: "$gt", Value: 120.5}}}},
+			bson.D{{Key: "genderSort", Value: int32(1)}, {Key: "ageSort", Value: int32(3)},
+				{Key: "distanceFromMe", Value: 120.5}, {Key: "_id", Value: bson.D{{Key: "$gt", Value: int32(9)}}}},
+		}}}}}, stage)
+	})
+}
+
+func TestDiscoverPipeline(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	location := &users.Location{Type: "Point", Coordinates: &users.Coordinates{Longitude: 1, Latitude: 2}}
+
+	t.Run("swiped, unmatched and blocked profiles are excluded with anti-joins", func(t *testing.T) {
+		// given
+		lookup := func(from, foreignField string, match bson.D, as string) bson.D {
+			return bson.D{{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: from},
+				{Key: "localField", Value: "_id"},
+				{Key: "foreignField", Value: foreignField},
+				{Key: "pipeline", Value: bson.A{
+					bson.D{{Key: "$match", Value: match}},
+					bson.D{{Key: "$limit", Value: 1}},
+					bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: 1}}}},
+				}},
+				{Key: "as", Value: as},
+			}}}
+		}
+
+		// when
+		pipeline := discoverPipeline(&users.DiscoverFilter{ID: 7, Location: location}, now)
+
+		// then
+		require.Equal(t, []bson.D{
+			lookup("swipes", "swipedID", bson.D{{Key: "swiperID", Value: int32(7)}}, "swiped"),
+			lookup("unmatches", "userIDs", bson.D{{Key: "userIDs", Value: int32(7)}}, "unmatched"),
+			lookup("blocks", "blockedID", bson.D{{Key: "blockerID", Value: int32(7)}}, "blocked"),
+			lookup("blocks", "blockerID", bson.D{{Key: "blockedID", Value: int32(7)}}, "blocking"),
+		}, []bson.D(pipeline[1:5]))
+		require.Equal(t, notHiddenStage, pipeline[5])
+	})
+
+	t.Run("limit fetches one extra profile after sorting", func(t *testing.T) {
+		// when
+		pipeline := discoverPipeline(&users.DiscoverFilter{ID: 1, Location: location, Limit: 20}, now)
+
+		// then
+		require.Len(t, pipeline, 9)
+		require.Equal(t, bson.D{{Key: "$sort", Value: sortKeys(nil)}}, pipeline[6])
+		require.Equal(t, bson.D{{Key: "$limit", Value: int32(21)}}, pipeline[7])
+	})
+
+	t.Run("mutual preferences are part of the $geoNear query", func(t *testing.T) {
+		// given
+		filter := &users.DiscoverFilter{ID: 1, RequesterGender: "female", RequesterAge: 40, Location: location}
+
+		// when
+		pipeline := discoverPipeline(filter, now)
+
+		// then
+		geoNear := pipeline[0][0].Value.(bson.D)
+		require.Equal(t, bson.E{Key: "query", Value: matchFilter(filter, now)}, geoNear[3])
+		query := geoNear[3].Value.(map[string]interface{})
+		require.Contains(t, query, "$and")
+		require.Contains(t, query, "preferences.minAge")
+	})
+
+	t.Run("max distance is passed to $geoNear", func(t *testing.T) {
+		// when
+		pipeline := discoverPipeline(&users.DiscoverFilter{ID: 1, Location: location, MaxDistance: 5000}, now)
+
+		// then
+		geoNear := pipeline[0][0].Value.(bson.D)
+		require.Equal(t, bson.E{Key: "maxDistance", Value: float64(5000)}, geoNear[len(geoNear)-1])
+	})
+
+	t.Run("cursor match runs before the hidden lookups", func(t *testing.T) {
+		// given
+		rank := &users.Rank{AvgAge: 30}
+		after := &users.DiscoverCursor{AgeSort: 2, DistanceFromMe: 10, ID: 4}
+
+		// when
+		pipeline := discoverPipeline(&users.DiscoverFilter{ID: 1, Location: location, Rank: rank, After: after}, now)
+
+		// then
+		require.Len(t, pipeline, 10)
+		require.Equal(t, "$addFields", pipeline[1][0].Key)
+		require.Equal(t, afterCursorStage(rank, after), pipeline[2])
+		require.Equal(t, "$lookup", pipeline[3][0].Key)
+		require.Equal(t, notHiddenStage, pipeline[7])
+		require.Equal(t, "$sort", pipeline[8][0].Key)
+		require.Equal(t, "$project", pipeline[9][0].Key)
+		geoNear := pipeline[0][0].Value.(bson.D)
+		require.NotEqual(t, "minDistance", geoNear[len(geoNear)-1].Key)
+	})
+
+	t.Run("unranked pages start $geoNear at the cursor distance", func(t *testing.T) {
+		// given
+		after := &users.DiscoverCursor{DistanceFromMe: 10, ID: 4}
+
+		// when
+		pipeline := discoverPipeline(&users.DiscoverFilter{ID: 1, Location: location, After: after}, now)
+
+		// then
+		geoNear := pipeline[0][0].Value.(bson.D)
+		require.Equal(t, bson.E{Key: "minDistance", Value: float64(10)}, geoNear[len(geoNear)-1])
+		require.Equal(t, afterCursorStage(nil, after), pipeline[1])
+		require.Equal(t, "$lookup", pipeline[2][0].Key)
+	})
+}
+
+func TestMatchesPipeline(t *testing.T) {
+	t.Run("first page is limited after the matches with a deleted user are dropped", func(t *testing.T) {
+		// when
+		pipeline := matchesPipeline(3, 20, nil)
+
+		// then
+		require.Len(t, pipeline, 6)
+		require.Equal(t, bson.D{{Key: "$match", Value: bson.D{{Key: "userIDs", Value: int32(3)}}}}, pipeline[0])
+		require.Equal(t, bson.D{{Key: "$unwind", Value: "$user"}}, pipeline[4])
+		require.Equal(t, bson.D{{Key: "$limit", Value: int32(21)}}, pipeline[5])
+	})
+
+	t.Run("deleted users are not joined", func(t *testing.T) {
+		// when
+		pipeline := matchesPipeline(3, 20, nil)
+
+		// then
+		lookup := pipeline[3][0].Value.(bson.D)
+		require.Equal(t, "pipeline", lookup[3].Key)
+		require.Equal(t, bson.D{{Key: "$match", Value: bson.D{{Key: "deletedAt", Value: bson.D{{Key: "$exists", Value: false}}}}}},
+			lookup[3].Value.(bson.A)[0])
+	})
+
+	t.Run("next page continues before the cursor", func(t *testing.T) {
+		// given
+		after := &users.MatchesCursor{CreatedAt: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), ID: "3-9"}
+
+		// when
+		pipeline := matchesPipeline(3, 0, after)
+
+		// then
+		require.Len(t, pipeline, 5)
+		require.Equal(t, bson.D{{Key: "$match", Value: bson.D{
+			{Key: "userIDs", Value: int32(3)},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "createdAt", Value: bson.D{{Key: "$lt", Value: after.CreatedAt}}}},
+				bson.D{{Key: "createdAt", Value: after.CreatedAt}, {Key: "_id", Value: bson.D{{Key: "$lt", Value: "3-9"}}}},
+			}},
+		}}}, pipeline[0])
+	})
+}
+
+func TestReportsFilter(t *testing.T) {
+	t.Run("zero fields are ignored", func(t *testing.T) {
+		// when
+		filters := reportsFilter(&users.ReportFilter{Limit: 20})
+
+		// then
+		require.Equal(t, bson.D{}, filters)
+	})
+
+	t.Run("every field is filtered on", func(t *testing.T) {
+		// given
+		filter := &users.ReportFilter{
+			Status:     users.ReportStatusOpen,
+			Reason:     users.ReportReasonSpam,
+			ReporterID: 3,
+			ReportedID: 4,
+			After:      &users.ReportsCursor{ID: 50},
+		}
+
+		// when
+		filters := reportsFilter(filter)
+
+		// then
+		require.Equal(t, bson.D{
+			{Key: "status", Value: users.ReportStatusOpen},
+			{Key: "reason", Value: users.ReportReasonSpam},
+			{Key: "reporterID", Value: int32(3)},
+			{Key: "reportedID", Value: int32(4)},
+			{Key: "_id", Value: bson.D{{Key: "$lt", Value: int32(50)}}},
+		}, filters)
+	})
+}
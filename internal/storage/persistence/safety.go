@@ -0,0 +1,127 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+
+	"github.com/muzzapp/date-api/internal/users"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Block is idempotent, blocking the same user twice keeps the first block.
+func (u *User) Block(ctx context.Context, block *users.Block) error {
+	filter := bson.M{"blockerID": block.BlockerID, "blockedID": block.BlockedID}
+	update := bson.M{"$setOnInsert": block}
+	if _, err := u.collBlocks.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetBlockedIDs returns the users blocked by ID as well as the users who blocked ID.
+func (u *User) GetBlockedIDs(ctx context.Context, ID int32) ([]int32, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"blockerID": ID},
+		bson.M{"blockedID": ID},
+	}}
+	cursor, err := u.collBlocks.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var blocks []*users.Block
+	if err = cursor.All(ctx, &blocks); err != nil {
+		return nil, err
+	}
+	IDs := make([]int32, 0, len(blocks))
+	for _, block := range blocks {
+		IDs = append(IDs, otherIDs(ID, []int32{block.BlockerID, block.BlockedID})...)
+	}
+	return IDs, nil
+}
+
+func (u *User) CreateReport(ctx context.Context, report *users.Report) (*users.Report, error) {
+	nextID, err := u.nextID(ctx, reportsColl)
+	if err != nil {
+		return nil, err
+	}
+	report.ID = nextID
+	if _, err = u.collReports.InsertOne(ctx, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (u *User) ListReports(ctx context.Context, filter *users.ReportFilter) ([]*users.Report, *users.ReportsCursor, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit) + 1)
+	}
+	cursor, err := u.collReports.Find(ctx, reportsFilter(filter), opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	reports := make([]*users.Report, 0)
+	if err = cursor.All(ctx, &reports); err != nil {
+		return nil, nil, err
+	}
+	// one extra report is requested to know whether there is a next page
+	var next *users.ReportsCursor
+	if filter.Limit > 0 && len(reports) > int(filter.Limit) {
+		reports = reports[:filter.Limit]
+		next = &users.ReportsCursor{ID: reports[len(reports)-1].ID}
+	}
+	return reports, next, nil
+}
+
+// Moderate keeps the decision on the user and appends it to the moderations collection, the user history, in a
+// transaction so the user is never moderated without a trace in their history.
+func (u *User) Moderate(ctx context.Context, moderation *users.Moderation) (*users.User, error) {
+	session, err := u.coll.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		user := new(users.User)
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		update := bson.M{"$set": bson.M{"moderation": moderation}}
+		err := u.coll.FindOneAndUpdate(ctx, bson.M{"_id": moderation.UserID}, update, opts).Decode(user)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				err = users.ErrUserNotFound
+			}
+			return nil, err
+		}
+		if _, err = u.collModerations.InsertOne(ctx, moderation); err != nil {
+			return nil, err
+		}
+		return user, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*users.User), nil
+}
+
+// GetModerations returns the moderation decisions taken on ID, newest first.
+func (u *User) GetModerations(ctx context.Context, ID int32) ([]*users.Moderation, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := u.collModerations.Find(ctx, bson.M{"userID": ID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	moderations := make([]*users.Moderation, 0)
+	if err = cursor.All(ctx, &moderations); err != nil {
+		return nil, err
+	}
+	return moderations, nil
+}
@@ -0,0 +1,34 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/storage/mongoclient"
+	"github.com/muzzapp/date-api/internal/storage/storetest"
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStoreConformance runs against the MongoDB of MONGODB_URI, every test gets its own database.
+func TestStoreConformance(t *testing.T) {
+	if os.Getenv("MONGODB_URI") == "" {
+		t.Skip("MONGODB_URI is not set")
+	}
+	storetest.Run(t, func(t *testing.T) users.Store {
+		name := fmt.Sprintf("date_storetest_%d", time.Now().UnixNano())
+		db, err := mongoclient.GetDatabase(mongoclient.WithDatabaseName(name))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			ctx := context.Background()
+			_ = db.Drop(ctx)
+			_ = db.Client().Disconnect(ctx)
+		})
+		_, err = NewMigrator(db).Up(context.Background(), 0)
+		require.NoError(t, err)
+		return NewItemPersistence(db)
+	})
+}
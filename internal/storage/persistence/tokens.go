@@ -0,0 +1,68 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/users"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+type Tokens struct {
+	collOneTimeTokens *mongo.Collection
+}
+
+const (
+	oneTimeTokensColl = "one_time_tokens"
+)
+
+var (
+	_ users.TokenStore = (*Tokens)(nil)
+)
+
+func NewTokensPersistence(db *mongo.Database) *Tokens {
+	return &Tokens{
+		collOneTimeTokens: db.Collection(oneTimeTokensColl,
+			options.Collection().SetReadPreference(readpref.Primary()),
+		),
+	}
+}
+
+func (t *Tokens) CreateOneTimeToken(ctx context.Context, token *users.OneTimeToken) error {
+	if _, err := t.collOneTimeTokens.InsertOne(ctx, token); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UseOneTimeToken finds and marks the token in a single update so a token cannot be used twice concurrently.
+func (t *Tokens) UseOneTimeToken(ctx context.Context, ID string, purpose users.TokenPurpose, now time.Time) (*users.OneTimeToken, error) {
+	filter := bson.M{
+		"_id":       ID,
+		"purpose":   purpose,
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"usedAt": now}}
+	token := new(users.OneTimeToken)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := t.collOneTimeTokens.FindOneAndUpdate(ctx, filter, update, opts).Decode(token); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			err = users.ErrInvalidToken
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+func (t *Tokens) RevokeOneTimeTokens(ctx context.Context, userID int32, purpose users.TokenPurpose, now time.Time) error {
+	filter := bson.M{"userID": userID, "purpose": purpose, "usedAt": bson.M{"$exists": false}}
+	if _, err := t.collOneTimeTokens.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"usedAt": now}}); err != nil {
+		return err
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package persistence
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/muzzapp/date-api/internal/users"
 	"go.mongodb.org/mongo-driver/bson"
@@ -12,14 +13,29 @@ import (
 )
 
 type User struct {
-	coll          *mongo.Collection
-	collSecondary *mongo.Collection
-	collCounters  *mongo.Collection
+	coll            *mongo.Collection
+	collSecondary   *mongo.Collection
+	collCounters    *mongo.Collection
+	collSwipes      *mongo.Collection
+	collMatches     *mongo.Collection
+	collUnmatches   *mongo.Collection
+	collBlocks      *mongo.Collection
+	collReports     *mongo.Collection
+	collModerations *mongo.Collection
+	// collRefreshTokens and collOneTimeTokens are only used to purge a user
+	collRefreshTokens *mongo.Collection
+	collOneTimeTokens *mongo.Collection
 }
 
 const (
-	usersColl    = "users"
-	countersColl = "counters"
+	usersColl       = "users"
+	countersColl    = "counters"
+	swipesColl      = "swipes"
+	matchesColl     = "matches"
+	unmatchesColl   = "unmatches"
+	blocksColl      = "blocks"
+	reportsColl     = "reports"
+	moderationsColl = "moderations"
 )
 
 var (
@@ -27,6 +43,7 @@ var (
 )
 
 func NewItemPersistence(db *mongo.Database) *User {
+	db = withCodecs(db)
 	return &User{
 		coll: db.Collection(usersColl,
 			options.Collection().SetReadPreference(readpref.PrimaryPreferred()),
@@ -37,12 +54,33 @@ func NewItemPersistence(db *mongo.Database) *User {
 		collCounters: db.Collection(countersColl,
 			options.Collection().SetReadPreference(readpref.PrimaryPreferred()),
 		),
+		collSwipes: db.Collection(swipesColl,
+			options.Collection().SetReadPreference(readpref.PrimaryPreferred()),
+		),
+		collMatches: db.Collection(matchesColl,
+			options.Collection().SetReadPreference(readpref.PrimaryPreferred()),
+		),
+		collUnmatches: db.Collection(unmatchesColl,
+			options.Collection().SetReadPreference(readpref.PrimaryPreferred()),
+		),
+		collBlocks: db.Collection(blocksColl,
+			options.Collection().SetReadPreference(readpref.PrimaryPreferred()),
+		),
+		collReports: db.Collection(reportsColl,
+			options.Collection().SetReadPreference(readpref.PrimaryPreferred()),
+		),
+		collModerations: db.Collection(moderationsColl,
+			options.Collection().SetReadPreference(readpref.PrimaryPreferred()),
+		),
+		collRefreshTokens: db.Collection(refreshTokensColl),
+		collOneTimeTokens: db.Collection(oneTimeTokensColl),
 	}
 }
 
-func (u *User) nextID(ctx context.Context) (int32, error) {
+// nextID returns the next sequential ID of the documents of coll.
+func (u *User) nextID(ctx context.Context, coll string) (int32, error) {
 	var counter Counter
-	filter := bson.M{"_id": usersColl}
+	filter := bson.M{"_id": coll}
 	update := bson.M{"$inc": bson.M{"value": 1}}
 
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(true)
@@ -53,13 +91,16 @@ func (u *User) nextID(ctx context.Context) (int32, error) {
 }
 
 func (u *User) CreateUser(ctx context.Context, user *users.User) (*users.User, error) {
-	nextID, err := u.nextID(ctx)
+	nextID, err := u.nextID(ctx, usersColl)
 	if err != nil {
 		return nil, err
 	}
 	user.ID = nextID
 	res, err := u.coll.InsertOne(ctx, user)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			err = users.ErrEmailTaken
+		}
 		return nil, err
 	}
 	user.ID = res.InsertedID.(int32)
@@ -146,84 +187,319 @@ func (u *User) GetUserByEmail(ctx context.Context, email string) (*users.User, e
 	return user, nil
 }
 
-func (u *User) Discover(ctx context.Context, ID, minAge, maxAge int32, gender string, IDs []int32,
-	location *users.Location, rank *users.Rank) ([]*users.Profile, error) {
+func (u *User) UpdateUser(ctx context.Context, ID int32, update *users.UserUpdate) (*users.User, error) {
+	set := userUpdateSet(update)
+	if len(set) == 0 {
+		return u.GetUser(ctx, ID)
+	}
 
-	pipeline := discoverPipeline(ID, minAge, maxAge, gender, IDs, location, rank)
-	cursor, err := u.collSecondary.Aggregate(ctx, pipeline)
+	user := new(users.User)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := u.coll.FindOneAndUpdate(ctx, bson.M{"_id": ID}, bson.M{"$set": set}, opts).Decode(user)
 	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			err = users.ErrUserNotFound
+		}
 		return nil, err
 	}
+	return user, nil
+}
+
+func (u *User) UseRecoveryCode(ctx context.Context, ID int32, hashedCode string) error {
+	filter := bson.M{"_id": ID, "twoFactor.recoveryCodes": hashedCode}
+	update := bson.M{"$pull": bson.M{"twoFactor.recoveryCodes": hashedCode}}
+	result, err := u.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return users.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (u *User) UseTOTPStep(ctx context.Context, ID int32, step int64) error {
+	filter := bson.M{
+		"_id":                ID,
+		"twoFactor":          bson.M{"$ne": nil},
+		"twoFactor.lastStep": bson.M{"$not": bson.M{"$gte": step}},
+	}
+	update := bson.M{"$set": bson.M{"twoFactor.lastStep": step}}
+	result, err := u.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return users.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (u *User) Discover(ctx context.Context, filter *users.DiscoverFilter) ([]*users.Profile, *users.DiscoverCursor, error) {
+	pipeline := discoverPipeline(filter, time.Now())
+	cursor, err := u.collSecondary.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer cursor.Close(ctx)
 
-	profiles := make([]*users.Profile, 0)
-	for cursor.Next(ctx) {
-		var result bson.M
-		if err = cursor.Decode(&result); err != nil {
-			return nil, err
-		}
-		profiles = append(profiles, &users.Profile{
+	var results []bson.M
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, nil, err
+	}
+	// one extra profile is requested to know whether there is a next page
+	var next *users.DiscoverCursor
+	if filter.Limit > 0 && len(results) > int(filter.Limit) {
+		results = results[:filter.Limit]
+		next = toDiscoverCursor(results[len(results)-1])
+	}
+
+	profiles := make([]*users.Profile, len(results))
+	for i, result := range results {
+		profiles[i] = &users.Profile{
 			ID:             result["_id"].(int32),
 			Name:           result["name"].(string),
 			Gender:         result["gender"].(string),
 			Age:            result["age"].(bson.M)["value"].(int32),
 			DistanceFromMe: int32(result["distanceFromMe"].(float64)),
-		})
+		}
 	}
-	return profiles, nil
+	return profiles, next, nil
 }
 
-func discoverPipeline(ID, minAge, maxAge int32, gender string, IDs []int32, location *users.Location, rank *users.Rank) mongo.Pipeline {
+func discoverPipeline(filter *users.DiscoverFilter, now time.Time) mongo.Pipeline {
 	nearCoordinates := bson.D{
-		{"type", "Point"},
-		{"coordinates", location.CoordinatesFloat64Slice()},
+		{Key: "type", Value: "Point"},
+		{Key: "coordinates", Value: filter.Location.CoordinatesFloat64Slice()},
+	}
+	geoNear := bson.D{
+		{Key: "near", Value: nearCoordinates},
+		{Key: "key", Value: "location"},
+		{Key: "distanceField", Value: "distanceFromMe"},
+		{Key: "query", Value: matchFilter(filter, now)},
+	}
+	if filter.MaxDistance > 0 {
+		geoNear = append(geoNear, bson.E{Key: "maxDistance", Value: filter.MaxDistance})
+	}
+	// unranked pages are sorted on the distance first, the profiles closer than the cursor are never scanned
+	if filter.Rank == nil && filter.After != nil {
+		geoNear = append(geoNear, bson.E{Key: "minDistance", Value: filter.After.DistanceFromMe})
+	}
+	geoNearStage := bson.D{{Key: "$geoNear", Value: geoNear}}
+	projectFields := bson.D{
+		{Key: "_id", Value: 1},
+		{Key: "name", Value: 1},
+		{Key: "gender", Value: 1},
+		{Key: "age.value", Value: 1},
+		{Key: "distanceFromMe", Value: 1},
+	}
+
+	pipeline := mongo.Pipeline{geoNearStage}
+	sortStage := bson.D{{Key: "$sort", Value: sortKeys(nil)}}
+	if filter.Rank != nil {
+		var addFieldsStage bson.D
+		addFieldsStage, sortStage = rankStages(filter.Rank)
+		pipeline = append(pipeline, addFieldsStage)
+		projectFields = append(projectFields, bson.E{Key: "genderSort", Value: 1}, bson.E{Key: "ageSort", Value: 1})
 	}
-	geoNearStage := bson.D{
-		{"$geoNear", bson.D{
-			{"near", nearCoordinates},
-			{"key", "location"},
-			{"distanceField", "distanceFromMe"},
-			{"query", matchFilter(ID, minAge, maxAge, gender, IDs)},
-		}},
+	// the cursor is matched before the lookups so they only run on the profiles of the next pages
+	if filter.After != nil {
+		pipeline = append(pipeline, afterCursorStage(filter.Rank, filter.After))
 	}
-	projectStage := bson.D{
-		{"$project", bson.D{
-			{"_id", 1},
-			{"name", 1},
-			{"gender", 1},
-			{"age.value", 1},
-			{"distanceFromMe", 1},
-		}},
+	pipeline = append(pipeline, hiddenLookupStages(filter.ID)...)
+	pipeline = append(pipeline, notHiddenStage, sortStage)
+	if filter.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: filter.Limit + 1}})
+	}
+	return append(pipeline, bson.D{{Key: "$project", Value: projectFields}})
+}
+
+func (u *User) GetYesSwipeIDs(ctx context.Context, ID int32) ([]int32, error) {
+	filter := bson.M{"swiperID": ID, "ok": true}
+	opts := options.Find().SetProjection(bson.M{"swipedID": 1})
+	cursor, err := u.collSwipes.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var swipes []*Swipe
+	if err = cursor.All(ctx, &swipes); err != nil {
+		return nil, err
 	}
-	if rank == nil {
-		return mongo.Pipeline{geoNearStage, projectStage}
+	IDs := make([]int32, len(swipes))
+	for i, swipe := range swipes {
+		IDs[i] = swipe.SwipedID
 	}
-	addFieldsStage, sortStage := rankStages(rank)
-	return mongo.Pipeline{geoNearStage, addFieldsStage, sortStage, projectStage}
+	return IDs, nil
 }
 
+// Swipe records the latest decision of ID about swipe.ID, swiping the same profile again only updates it.
 func (u *User) Swipe(ctx context.Context, ID int32, swipe *users.Swipe) error {
-	filter := bson.M{"_id": ID}
-	update := bson.M{"$addToSet": bson.M{"swipes": swipe}}
-	if _, err := u.coll.UpdateOne(ctx, filter, update); err != nil {
+	now := time.Now().UTC()
+	filter := bson.M{"swiperID": ID, "swipedID": swipe.ID}
+	update := bson.M{
+		"$set":         bson.M{"ok": swipe.OK, "updatedAt": now},
+		"$setOnInsert": bson.M{"createdAt": now},
+	}
+	if _, err := u.collSwipes.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
 		return err
 	}
 	return nil
 }
 
+func (u *User) GetSwipes(ctx context.Context, ID int32) ([]*users.SwipeRecord, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := u.collSwipes.Find(ctx, bson.M{"swiperID": ID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	swipes := make([]*users.SwipeRecord, 0)
+	if err = cursor.All(ctx, &swipes); err != nil {
+		return nil, err
+	}
+	return swipes, nil
+}
+
 func (u *User) Match(ctx context.Context, ID, swipedID int32) (bool, error) {
 	filter := bson.M{
-		"_id": swipedID,
-		"swipes": bson.M{
-			"$elemMatch": bson.M{
-				"id": ID,
-				"ok": true,
-			},
-		},
+		"swiperID": swipedID,
+		"swipedID": ID,
+		"ok":       true,
 	}
-	count, err := u.collSecondary.CountDocuments(ctx, filter)
+	// read from the primary, a lagging secondary could miss a swipe made at the same time
+	count, err := u.collSwipes.CountDocuments(ctx, filter, options.Count().SetLimit(1))
 	if err != nil {
 		return false, err
 	}
 	return count > 0, nil
 }
+
+// CreateMatch stores the match unless it already exists, in which case the stored match is returned.
+func (u *User) CreateMatch(ctx context.Context, match *users.Match) (*users.Match, error) {
+	filter := bson.M{"_id": match.ID}
+	update := bson.M{"$setOnInsert": bson.M{"userIDs": match.UserIDs, "createdAt": match.CreatedAt}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	stored := new(users.Match)
+	err := u.collMatches.FindOneAndUpdate(ctx, filter, update, opts).Decode(stored)
+	if mongo.IsDuplicateKeyError(err) {
+		// lost the upsert race against the other user swipe
+		err = u.collMatches.FindOne(ctx, filter).Decode(stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+func (u *User) GetMatch(ctx context.Context, matchID string) (*users.Match, error) {
+	match := new(users.Match)
+	if err := u.collMatches.FindOne(ctx, bson.M{"_id": matchID}).Decode(match); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			err = users.ErrMatchNotFound
+		}
+		return nil, err
+	}
+	return match, nil
+}
+
+func (u *User) GetMatches(ctx context.Context, ID, limit int32, after *users.MatchesCursor) ([]*users.Match, *users.MatchesCursor, error) {
+	cursor, err := u.collMatches.Aggregate(ctx, matchesPipeline(ID, limit, after))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []*MatchWithUser
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, nil, err
+	}
+	// one extra match is requested to know whether there is a next page
+	var next *users.MatchesCursor
+	if limit > 0 && len(results) > int(limit) {
+		results = results[:limit]
+		last := results[len(results)-1]
+		next = &users.MatchesCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	matches := make([]*users.Match, len(results))
+	for i, result := range results {
+		matches[i] = result.toMatch()
+	}
+	return matches, next, nil
+}
+
+func matchesPipeline(ID, limit int32, after *users.MatchesCursor) mongo.Pipeline {
+	match := bson.D{{Key: "userIDs", Value: ID}}
+	if after != nil {
+		match = append(match, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "createdAt", Value: bson.D{{Key: "$lt", Value: after.CreatedAt}}}},
+			bson.D{{Key: "createdAt", Value: after.CreatedAt}, {Key: "_id", Value: bson.D{{Key: "$lt", Value: after.ID}}}},
+		}})
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}}},
+	}
+	otherID := bson.D{{Key: "$arrayElemAt", Value: bson.A{
+		bson.D{{Key: "$setDifference", Value: bson.A{"$userIDs", bson.A{ID}}}},
+		0,
+	}}}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$addFields", Value: bson.D{{Key: "otherID", Value: otherID}}}},
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: usersColl},
+			{Key: "localField", Value: "otherID"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "pipeline", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.D{{Key: "deletedAt", Value: bson.D{{Key: "$exists", Value: false}}}}}},
+				bson.D{{Key: "$project", Value: bson.D{
+					{Key: "name", Value: 1},
+					{Key: "gender", Value: 1},
+					{Key: "age.value", Value: 1},
+				}}},
+			}},
+			{Key: "as", Value: "user"},
+		}}},
+		// matches with a deleted or erased user are dropped before the limit so a page is never short
+		bson.D{{Key: "$unwind", Value: "$user"}},
+	)
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit + 1}})
+	}
+	return pipeline
+}
+
+// Unmatch records the unmatch event before deleting the match, so a failed delete can be retried without
+// losing the event.
+func (u *User) Unmatch(ctx context.Context, unmatch *users.Unmatch) error {
+	if _, err := u.collUnmatches.InsertOne(ctx, unmatch); err != nil {
+		return err
+	}
+	if _, err := u.collMatches.DeleteOne(ctx, bson.M{"_id": unmatch.MatchID}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (u *User) GetUnmatchedIDs(ctx context.Context, ID int32) ([]int32, error) {
+	opts := options.Find().SetProjection(bson.M{"userIDs": 1})
+	cursor, err := u.collUnmatches.Find(ctx, bson.M{"userIDs": ID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var unmatches []*users.Unmatch
+	if err = cursor.All(ctx, &unmatches); err != nil {
+		return nil, err
+	}
+	IDs := make([]int32, 0, len(unmatches))
+	for _, unmatch := range unmatches {
+		IDs = append(IDs, otherIDs(ID, unmatch.UserIDs)...)
+	}
+	return IDs, nil
+}
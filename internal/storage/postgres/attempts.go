@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+type Attempts struct {
+	pool *pgxpool.Pool
+}
+
+var (
+	_ users.AttemptStore = (*Attempts)(nil)
+)
+
+func NewAttempts(pool *pgxpool.Pool) *Attempts {
+	return &Attempts{pool: pool}
+}
+
+func scanLoginAttempts(row pgx.Row) (*users.LoginAttempts, error) {
+	attempts := new(users.LoginAttempts)
+	var lastFailureAt *time.Time
+	if err := row.Scan(&attempts.Key, &attempts.Failures, &lastFailureAt, &attempts.LockedUntil); err != nil {
+		return nil, err
+	}
+	if lastFailureAt != nil {
+		attempts.LastFailureAt = *lastFailureAt
+	}
+	return attempts, nil
+}
+
+func (a *Attempts) GetLoginAttempts(ctx context.Context, key string) (*users.LoginAttempts, error) {
+	attempts, err := scanLoginAttempts(a.pool.QueryRow(ctx, "SELECT key, failures, last_failure_at, locked_until "+
+		"FROM login_attempts WHERE key = $1", key))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &users.LoginAttempts{Key: key}, nil
+	}
+	return attempts, err
+}
+
+// IncrementLoginFailures counts the failure in a single upsert so concurrent failures are all counted.
+func (a *Attempts) IncrementLoginFailures(ctx context.Context, key string, now time.Time, window time.Duration) (*users.LoginAttempts, error) {
+	return scanLoginAttempts(a.pool.QueryRow(ctx, "INSERT INTO login_attempts (key, failures, last_failure_at) "+
+		"VALUES ($1, 1, $2) ON CONFLICT (key) DO UPDATE SET "+
+		"failures = CASE WHEN coalesce(login_attempts.last_failure_at, '-infinity') < $3 THEN 1 "+
+		"ELSE login_attempts.failures + 1 END, last_failure_at = EXCLUDED.last_failure_at "+
+		"RETURNING key, failures, last_failure_at, locked_until", key, now, now.Add(-window)))
+}
+
+func (a *Attempts) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := a.pool.Exec(ctx, "INSERT INTO login_attempts (key, locked_until) VALUES ($1, $2) "+
+		"ON CONFLICT (key) DO UPDATE SET locked_until = EXCLUDED.locked_until", key, until)
+	return err
+}
+
+func (a *Attempts) ResetLoginAttempts(ctx context.Context, key string) error {
+	_, err := a.pool.Exec(ctx, "DELETE FROM login_attempts WHERE key = $1", key)
+	return err
+}
+
+func (a *Attempts) CreateLoginLockout(ctx context.Context, lockout *users.LoginLockout) error {
+	_, err := a.pool.Exec(ctx, "INSERT INTO login_lockouts (key, failures, locked_until, created_at) "+
+		"VALUES ($1, $2, $3, $4)", lockout.Key, lockout.Failures, lockout.LockedUntil, lockout.CreatedAt)
+	return err
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/muzzapp/date-api/internal/auth"
+)
+
+type Auth struct {
+	pool *pgxpool.Pool
+}
+
+var (
+	_ auth.Store = (*Auth)(nil)
+)
+
+func NewAuth(pool *pgxpool.Pool) *Auth {
+	return &Auth{pool: pool}
+}
+
+func (a *Auth) CreateRefreshToken(ctx context.Context, token *auth.RefreshToken) error {
+	_, err := a.pool.Exec(ctx, "INSERT INTO refresh_tokens (id, family_id, user_id, expires_at, created_at, revoked_at) "+
+		"VALUES ($1, $2, $3, $4, $5, $6)", token.ID, token.FamilyID, token.UserID, token.ExpiresAt, token.CreatedAt,
+		token.RevokedAt)
+	return err
+}
+
+func (a *Auth) GetRefreshToken(ctx context.Context, ID string) (*auth.RefreshToken, error) {
+	token := new(auth.RefreshToken)
+	err := a.pool.QueryRow(ctx, "SELECT id, family_id, user_id, expires_at, created_at, revoked_at "+
+		"FROM refresh_tokens WHERE id = $1", ID).
+		Scan(&token.ID, &token.FamilyID, &token.UserID, &token.ExpiresAt, &token.CreatedAt, &token.RevokedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = auth.ErrRefreshTokenNotFound
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+func (a *Auth) RevokeRefreshToken(ctx context.Context, ID string, now time.Time) (bool, error) {
+	tag, err := a.pool.Exec(ctx, "UPDATE refresh_tokens SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL",
+		ID, now)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (a *Auth) RevokeRefreshTokenFamily(ctx context.Context, familyID string, now time.Time) error {
+	_, err := a.pool.Exec(ctx, "UPDATE refresh_tokens SET revoked_at = $2 WHERE family_id = $1 AND revoked_at IS NULL",
+		familyID, now)
+	return err
+}
+
+func (a *Auth) RevokeUserRefreshTokens(ctx context.Context, userID int32, now time.Time) error {
+	_, err := a.pool.Exec(ctx, "UPDATE refresh_tokens SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL",
+		userID, now)
+	return err
+}
+
+// RevokeAccessToken is idempotent, revoking a token twice keeps the first revocation.
+func (a *Auth) RevokeAccessToken(ctx context.Context, token *auth.RevokedToken) error {
+	_, err := a.pool.Exec(ctx, "INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) "+
+		"ON CONFLICT (jti) DO NOTHING", token.JTI, token.ExpiresAt)
+	return err
+}
+
+func (a *Auth) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := a.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)", jti).Scan(&revoked)
+	return revoked, err
+}
@@ -0,0 +1,118 @@
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+CREATE TABLE users (
+    id             serial PRIMARY KEY,
+    email          text NOT NULL UNIQUE,
+    password       text NOT NULL,
+    name           text NOT NULL DEFAULT '',
+    gender         text NOT NULL DEFAULT '',
+    bio            text NOT NULL DEFAULT '',
+    age_value      integer,
+    dob            timestamptz,
+    location       geography(Point, 4326),
+    preferences    jsonb,
+    email_verified boolean NOT NULL DEFAULT false,
+    two_factor     jsonb,
+    role           text NOT NULL DEFAULT '',
+    moderation     jsonb,
+    deleted_at     timestamptz
+);
+CREATE INDEX users_location_idx ON users USING gist (location);
+CREATE INDEX users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE swipes (
+    swiper_id  integer NOT NULL,
+    swiped_id  integer NOT NULL,
+    ok         boolean NOT NULL,
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL,
+    PRIMARY KEY (swiper_id, swiped_id)
+);
+CREATE INDEX swipes_swiped_id_idx ON swipes (swiped_id);
+
+CREATE TABLE matches (
+    id         text PRIMARY KEY,
+    user_ids   integer[] NOT NULL,
+    created_at timestamptz NOT NULL
+);
+CREATE INDEX matches_user_ids_idx ON matches USING gin (user_ids);
+
+CREATE TABLE unmatches (
+    match_id     text NOT NULL,
+    user_ids     integer[] NOT NULL,
+    initiator_id integer NOT NULL,
+    created_at   timestamptz NOT NULL
+);
+CREATE INDEX unmatches_user_ids_idx ON unmatches USING gin (user_ids);
+
+CREATE TABLE blocks (
+    blocker_id integer NOT NULL,
+    blocked_id integer NOT NULL,
+    created_at timestamptz NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id)
+);
+CREATE INDEX blocks_blocked_id_idx ON blocks (blocked_id);
+
+CREATE TABLE reports (
+    id          serial PRIMARY KEY,
+    reporter_id integer NOT NULL,
+    reported_id integer NOT NULL,
+    reason      text NOT NULL,
+    details     text NOT NULL DEFAULT '',
+    status      text NOT NULL,
+    created_at  timestamptz NOT NULL
+);
+CREATE INDEX reports_reported_id_idx ON reports (reported_id);
+CREATE INDEX reports_status_idx ON reports (status, created_at DESC);
+
+CREATE TABLE moderations (
+    id           bigserial PRIMARY KEY,
+    user_id      integer NOT NULL,
+    moderator_id integer NOT NULL,
+    status       text NOT NULL,
+    reason       text NOT NULL DEFAULT '',
+    until        timestamptz,
+    created_at   timestamptz NOT NULL
+);
+CREATE INDEX moderations_user_id_idx ON moderations (user_id, created_at DESC);
+
+CREATE TABLE refresh_tokens (
+    id         text PRIMARY KEY,
+    family_id  text NOT NULL,
+    user_id    integer NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL,
+    revoked_at timestamptz
+);
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+CREATE TABLE revoked_tokens (
+    jti        text PRIMARY KEY,
+    expires_at timestamptz NOT NULL
+);
+
+CREATE TABLE login_attempts (
+    key             text PRIMARY KEY,
+    failures        integer NOT NULL DEFAULT 0,
+    last_failure_at timestamptz,
+    locked_until    timestamptz
+);
+
+CREATE TABLE login_lockouts (
+    key          text NOT NULL,
+    failures     integer NOT NULL,
+    locked_until timestamptz NOT NULL,
+    created_at   timestamptz NOT NULL
+);
+CREATE INDEX login_lockouts_key_idx ON login_lockouts (key, created_at DESC);
+
+CREATE TABLE one_time_tokens (
+    id         text PRIMARY KEY,
+    purpose    text NOT NULL,
+    user_id    integer NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL,
+    used_at    timestamptz
+);
+CREATE INDEX one_time_tokens_user_id_idx ON one_time_tokens (user_id, purpose);
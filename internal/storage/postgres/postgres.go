@@ -0,0 +1,65 @@
+// Package postgres stores the users in PostgreSQL, PostGIS computes the discover distances.
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Config struct {
+	PostgresURL            string        `envconfig:"POSTGRES_URL" default:"postgres://localhost:5432/date"`
+	PostgresConnectTimeout time.Duration `envconfig:"POSTGRES_CONNECT_TIMEOUT" default:"5s"`
+}
+
+// uniqueViolation is the SQLSTATE of a duplicate key.
+const uniqueViolation = "23505"
+
+// Database is every store backed by PostgreSQL, the counterpart of persistence.Database.
+type Database struct {
+	*User
+	*Auth
+	*Attempts
+	*Tokens
+}
+
+func New(pool *pgxpool.Pool) *Database {
+	return &Database{
+		User:     NewUser(pool),
+		Auth:     NewAuth(pool),
+		Attempts: NewAttempts(pool),
+		Tokens:   NewTokens(pool),
+	}
+}
+
+// Connect opens a pool on the database and checks it is usable.
+func Connect(ctx context.Context, conf *Config) (*pgxpool.Pool, error) {
+	poolConf, err := pgxpool.ParseConfig(conf.PostgresURL)
+	if err != nil {
+		return nil, err
+	}
+	return connect(ctx, poolConf, conf.PostgresConnectTimeout)
+}
+
+func connect(ctx context.Context, poolConf *pgxpool.Config, timeout time.Duration) (*pgxpool.Pool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConf)
+	if err != nil {
+		return nil, err
+	}
+	if err = pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
@@ -0,0 +1,248 @@
+package postgres
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+// query collects the conditions of a WHERE clause and their positional arguments.
+type query struct {
+	conditions []string
+	args       []any
+}
+
+// arg adds an argument and returns its placeholder.
+func (q *query) arg(v any) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+func (q *query) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// whereClause joins the conditions, it is empty without any.
+func (q *query) whereClause() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// discoverQuery is the SQL counterpart of the $geoNear pipeline of persistence.User, the candidates are filtered
+// like matchFilter, ranked like rankStages and paged like afterCursorStage.
+func discoverQuery(filter *users.DiscoverFilter) (string, []any) {
+	q := &query{}
+	point := "ST_SetSRID(ST_MakePoint(" + q.arg(filter.Location.Coordinates.Longitude) + ", " +
+		q.arg(filter.Location.Coordinates.Latitude) + "), 4326)::geography"
+	q.where("u.location IS NOT NULL")
+	matchFilter(filter, q)
+	if filter.MaxDistance > 0 {
+		q.where("ST_DWithin(u.location, " + point + ", " + q.arg(filter.MaxDistance) + ", false)")
+	}
+	hiddenFilter(filter.ID, q)
+
+	genderSort, ageSort := "0", "0"
+	if filter.Rank != nil {
+		genderSort, ageSort = rankColumns(filter.Rank, q)
+	}
+	candidates := "SELECT u.id, u.name, u.gender, coalesce(u.age_value, 0) AS age, " +
+		"ST_Distance(u.location, " + point + ", false) AS distance_from_me, " +
+		genderSort + " AS gender_sort, " + ageSort + " AS age_sort FROM users u" + q.whereClause()
+
+	keys := sortKeys(filter.Rank)
+	sql := "SELECT id, name, gender, age, distance_from_me, gender_sort, age_sort FROM (" + candidates + ") candidates"
+	if filter.After != nil {
+		sql += " WHERE " + afterCursorCondition(filter.Rank, filter.After, q)
+	}
+	sql += " ORDER BY " + strings.Join(keys, ", ")
+	if filter.Limit > 0 {
+		sql += " LIMIT " + q.arg(filter.Limit+1)
+	}
+	return sql, q.args
+}
+
+func matchFilter(filter *users.DiscoverFilter, q *query) {
+	q.where("u.id <> " + q.arg(filter.ID))
+	ageFilter(filter.MinAge, filter.MaxAge, q)
+	genderFilter(filter.Genders, q)
+	mutualFilter(filter.RequesterGender, filter.RequesterAge, q)
+	moderationFilter(q)
+	if filter.VerifiedOnly {
+		q.where("u.email_verified")
+	}
+}
+
+// moderationFilter hides banned and deleted users as well as suspended users until the end of their suspension.
+func moderationFilter(q *query) {
+	statuses := []string{string(users.ModerationStatusBanned), string(users.ModerationStatusSuspended)}
+	q.where("(coalesce(u.moderation->>'status', '') <> ALL(" + q.arg(statuses) + ") OR (u.moderation->>'status' = " +
+		q.arg(string(users.ModerationStatusSuspended)) + " AND (u.moderation->>'until')::timestamptz <= now()))")
+	q.where("u.deleted_at IS NULL")
+}
+
+// hiddenFilter excludes the users ID swiped, unmatched, blocked or was blocked by with anti-joins, like the
+// hiddenLookupStages of persistence.User.
+func hiddenFilter(ID int32, q *query) {
+	me := q.arg(ID)
+	q.where("NOT EXISTS (SELECT 1 FROM swipes s WHERE s.swiper_id = " + me + " AND s.swiped_id = u.id)")
+	q.where("NOT EXISTS (SELECT 1 FROM unmatches m WHERE m.user_ids @> ARRAY[" + me + "::integer, u.id])")
+	q.where("NOT EXISTS (SELECT 1 FROM blocks b WHERE (b.blocker_id = " + me + " AND b.blocked_id = u.id) OR " +
+		"(b.blocker_id = u.id AND b.blocked_id = " + me + "))")
+}
+
+func ageFilter(minAge, maxAge int32, q *query) {
+	if minAge > 0 {
+		q.where("u.age_value >= " + q.arg(minAge))
+	}
+	if maxAge > 0 {
+		q.where("u.age_value <= " + q.arg(maxAge))
+	}
+}
+
+func genderFilter(genders []string, q *query) {
+	switch len(genders) {
+	case 0:
+	case 1:
+		q.where("u.gender = " + q.arg(genders[0]))
+	default:
+		q.where("u.gender = ANY(" + q.arg(genders) + ")")
+	}
+}
+
+// mutualFilter only keeps the candidates whose saved preferences accept the requester,
+// missing or zero preferences accept everyone.
+func mutualFilter(gender string, age int32, q *query) {
+	if gender != "" {
+		q.where("(u.preferences IS NULL OR u.preferences->'genders' = '[]'::jsonb OR u.preferences->'genders' ? " +
+			q.arg(gender) + ")")
+	}
+	if age > 0 {
+		placeholder := q.arg(age)
+		q.where("(coalesce((u.preferences->>'maxAge')::integer, 0) = 0 OR (u.preferences->>'maxAge')::integer >= " +
+			placeholder + ")")
+		q.where("coalesce((u.preferences->>'minAge')::integer, 0) <= " + placeholder)
+	}
+}
+
+// rankColumns returns the genderSort and ageSort expressions of rankStages.
+func rankColumns(rank *users.Rank, q *query) (string, string) {
+	genderSort := "0"
+	if rank.MostCommonGender != "" {
+		genderSort = "CASE WHEN u.gender = " + q.arg(rank.MostCommonGender) + " THEN 1 ELSE 2 END"
+	}
+	return genderSort, "abs(coalesce(u.age_value, 0) - " + q.arg(rank.AvgAge) + ")"
+}
+
+// sortKeys returns the discover sort order, id is always last so every profile has a unique position to page from.
+func sortKeys(rank *users.Rank) []string {
+	var keys []string
+	if rank != nil {
+		if rank.MostCommonGender != "" {
+			keys = append(keys, "gender_sort")
+		}
+		keys = append(keys, "age_sort")
+	}
+	return append(keys, "distance_from_me", "id")
+}
+
+// afterCursorCondition keeps the profiles sorted after the cursor, comparing the sort keys as a row.
+func afterCursorCondition(rank *users.Rank, after *users.DiscoverCursor, q *query) string {
+	var values []string
+	if rank != nil {
+		if rank.MostCommonGender != "" {
+			values = append(values, q.arg(after.GenderSort))
+		}
+		values = append(values, q.arg(after.AgeSort))
+	}
+	values = append(values, q.arg(after.DistanceFromMe), q.arg(after.ID))
+	return "(" + strings.Join(sortKeys(rank), ", ") + ") > (" + strings.Join(values, ", ") + ")"
+}
+
+// userUpdateSet returns the SET assignments of the non nil fields of update.
+func userUpdateSet(update *users.UserUpdate, q *query) []string {
+	var set []string
+	assign := func(column string, v any) {
+		set = append(set, column+" = "+q.arg(v))
+	}
+	if update.Password != nil {
+		assign("password", *update.Password)
+	}
+	if update.EmailVerified != nil {
+		assign("email_verified", *update.EmailVerified)
+	}
+	if update.TwoFactor != nil {
+		assign("two_factor", toTwoFactor(update.TwoFactor))
+	}
+	if update.DeletedAt != nil {
+		assign("deleted_at", *update.DeletedAt)
+	}
+	if update.Name != nil {
+		assign("name", *update.Name)
+	}
+	if update.Gender != nil {
+		assign("gender", *update.Gender)
+	}
+	if update.Bio != nil {
+		assign("bio", *update.Bio)
+	}
+	if update.Age != nil {
+		assign("age_value", update.Age.Value)
+		assign("dob", update.Age.DOB)
+	}
+	if update.Location != nil {
+		set = append(set, "location = "+pointColumn(update.Location, q))
+	}
+	if update.Preferences != nil {
+		assign("preferences", toPreferences(update.Preferences))
+	}
+	return set
+}
+
+// pointColumn returns the geography value of a location, NULL without coordinates.
+func pointColumn(location *users.Location, q *query) string {
+	if location == nil || location.Coordinates == nil {
+		return "NULL"
+	}
+	return "ST_SetSRID(ST_MakePoint(" + q.arg(location.Coordinates.Longitude) + ", " +
+		q.arg(location.Coordinates.Latitude) + "), 4326)::geography"
+}
+
+// reportsFilter is the WHERE clause of the reports listed to moderators.
+func reportsFilter(filter *users.ReportFilter, q *query) {
+	if filter.Status != "" {
+		q.where("status = " + q.arg(string(filter.Status)))
+	}
+	if filter.Reason != "" {
+		q.where("reason = " + q.arg(string(filter.Reason)))
+	}
+	if filter.ReporterID > 0 {
+		q.where("reporter_id = " + q.arg(filter.ReporterID))
+	}
+	if filter.ReportedID > 0 {
+		q.where("reported_id = " + q.arg(filter.ReportedID))
+	}
+	if filter.After != nil {
+		q.where("id < " + q.arg(filter.After.ID))
+	}
+}
+
+// matchesQuery lists the matches of ID newest first joined with the other user, the matches with a deleted
+// user are dropped like in persistence.matchesPipeline.
+func matchesQuery(ID, limit int32, after *users.MatchesCursor) (string, []any) {
+	q := &query{}
+	placeholder := q.arg(ID)
+	q.where("m.user_ids @> ARRAY[" + placeholder + "::integer]")
+	if after != nil {
+		q.where("(m.created_at, m.id) < (" + q.arg(after.CreatedAt) + ", " + q.arg(after.ID) + ")")
+	}
+	sql := "SELECT m.id, m.user_ids, m.created_at, u.id, u.name, u.gender, coalesce(u.age_value, 0) FROM matches m " +
+		"JOIN users u ON u.id = ANY(m.user_ids) AND u.id <> " + placeholder + " AND u.deleted_at IS NULL" +
+		q.whereClause() + " ORDER BY m.created_at DESC, m.id DESC"
+	if limit > 0 {
+		sql += " LIMIT " + q.arg(limit+1)
+	}
+	return sql, q.args
+}
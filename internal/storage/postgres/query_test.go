@@ -0,0 +1,209 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchFilter(t *testing.T) {
+	statuses := []string{string(users.ModerationStatusBanned), string(users.ModerationStatusSuspended)}
+
+	t.Run("requester filters and mutual preferences", func(t *testing.T) {
+		// given
+		filter := &users.DiscoverFilter{
+			ID:              1,
+			RequesterGender: "male",
+			RequesterAge:    30,
+			MinAge:          25,
+			MaxAge:          35,
+			Genders:         []string{"female"},
+		}
+		q := &query{}
+
+		// when
+		matchFilter(filter, q)
+
+		// then
+		require.Equal(t, []string{
+			"u.id <> $1",
+			"u.age_value >= $2",
+			"u.age_value <= $3",
+			"u.gender = $4",
+			"(u.preferences IS NULL OR u.preferences->'genders' = '[]'::jsonb OR u.preferences->'genders' ? $5)",
+			"(coalesce((u.preferences->>'maxAge')::integer, 0) = 0 OR (u.preferences->>'maxAge')::integer >= $6)",
+			"coalesce((u.preferences->>'minAge')::integer, 0) <= $6",
+			"(coalesce(u.moderation->>'status', '') <> ALL($7) OR (u.moderation->>'status' = $8 AND " +
+				"(u.moderation->>'until')::timestamptz <= now()))",
+			"u.deleted_at IS NULL",
+		}, q.conditions)
+		require.Equal(t, []any{int32(1), int32(25), int32(35), "female", "male", int32(30), statuses, "suspended"}, q.args)
+	})
+
+	t.Run("several genders are matched with ANY", func(t *testing.T) {
+		// given
+		q := &query{}
+
+		// when
+		matchFilter(&users.DiscoverFilter{ID: 1, Genders: []string{"female", "male"}}, q)
+
+		// then
+		require.Contains(t, q.conditions, "u.gender = ANY($2)")
+		require.Equal(t, []string{"female", "male"}, q.args[1])
+	})
+
+	t.Run("verified only hides unverified emails", func(t *testing.T) {
+		// given
+		q := &query{}
+
+		// when
+		matchFilter(&users.DiscoverFilter{ID: 1, VerifiedOnly: true}, q)
+
+		// then
+		require.Equal(t, "u.email_verified", q.conditions[len(q.conditions)-1])
+	})
+}
+
+func TestAfterCursorCondition(t *testing.T) {
+	after := &users.DiscoverCursor{GenderSort: 1, AgeSort: 3, DistanceFromMe: 120.5, ID: 9}
+
+	t.Run("not ranked continues on distance and id", func(t *testing.T) {
+		// given
+		q := &query{}
+
+		// when
+		condition := afterCursorCondition(nil, after, q)
+
+		// then
+		require.Equal(t, "(distance_from_me, id) > ($1, $2)", condition)
+		require.Equal(t, []any{120.5, int32(9)}, q.args)
+	})
+
+	t.Run("ranked continues on every sort key", func(t *testing.T) {
+		// given
+		q := &query{}
+
+		// when
+		condition := afterCursorCondition(&users.Rank{AvgAge: 30, MostCommonGender: "female"}, after, q)
+
+		// then
+		require.Equal(t, "(gender_sort, age_sort, distance_from_me, id) > ($1, $2, $3, $4)", condition)
+		require.Equal(t, []any{int32(1), int32(3), 120.5, int32(9)}, q.args)
+	})
+}
+
+func TestDiscoverQuery(t *testing.T) {
+	location := &users.Location{Type: "Point", Coordinates: &users.Coordinates{Longitude: 1, Latitude: 2}}
+
+	t.Run("swiped, unmatched and blocked profiles are excluded with anti-joins", func(t *testing.T) {
+		// when
+		sql, args := discoverQuery(&users.DiscoverFilter{ID: 7, Location: location})
+
+		// then
+		require.Contains(t, sql, "NOT EXISTS (SELECT 1 FROM swipes s WHERE s.swiper_id = $6 AND s.swiped_id = u.id)")
+		require.Contains(t, sql, "NOT EXISTS (SELECT 1 FROM unmatches m WHERE m.user_ids @> ARRAY[$6::integer, u.id])")
+		require.Contains(t, sql, "NOT EXISTS (SELECT 1 FROM blocks b WHERE (b.blocker_id = $6 AND b.blocked_id = u.id) OR "+
+			"(b.blocker_id = u.id AND b.blocked_id = $6))")
+		require.Equal(t, int32(7), args[5])
+	})
+
+	t.Run("limit fetches one extra profile after sorting", func(t *testing.T) {
+		// when
+		sql, args := discoverQuery(&users.DiscoverFilter{ID: 1, Location: location, Limit: 20})
+
+		// then
+		require.Contains(t, sql, " ORDER BY distance_from_me, id LIMIT $7")
+		require.Equal(t, int32(21), args[len(args)-1])
+	})
+
+	t.Run("max distance is filtered on the sphere", func(t *testing.T) {
+		// when
+		sql, args := discoverQuery(&users.DiscoverFilter{ID: 1, Location: location, MaxDistance: 5000})
+
+		// then
+		require.Contains(t, sql, "ST_DWithin(u.location, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, $6, false)")
+		require.Equal(t, float64(5000), args[5])
+	})
+
+	t.Run("ranked sorts on the rank columns before the distance", func(t *testing.T) {
+		// given
+		rank := &users.Rank{AvgAge: 30, MostCommonGender: "female"}
+
+		// when
+		sql, _ := discoverQuery(&users.DiscoverFilter{ID: 1, Location: location, Rank: rank})
+
+		// then
+		require.Contains(t, sql, "CASE WHEN u.gender = $7 THEN 1 ELSE 2 END AS gender_sort")
+		require.Contains(t, sql, "abs(coalesce(u.age_value, 0) - $8) AS age_sort")
+		require.Contains(t, sql, " ORDER BY gender_sort, age_sort, distance_from_me, id")
+	})
+
+	t.Run("cursor is matched after the rank columns are computed", func(t *testing.T) {
+		// given
+		after := &users.DiscoverCursor{AgeSort: 2, DistanceFromMe: 10, ID: 4}
+
+		// when
+		sql, args := discoverQuery(&users.DiscoverFilter{ID: 1, Location: location, Rank: &users.Rank{AvgAge: 30}, After: after})
+
+		// then
+		require.Contains(t, sql, ") candidates WHERE (age_sort, distance_from_me, id) > ($8, $9, $10) ORDER BY")
+		require.Equal(t, []any{int32(2), float64(10), int32(4)}, args[7:])
+	})
+}
+
+func TestMatchesQuery(t *testing.T) {
+	t.Run("first page", func(t *testing.T) {
+		// when
+		sql, args := matchesQuery(3, 20, nil)
+
+		// then
+		require.Contains(t, sql, "u.id <> $1 AND u.deleted_at IS NULL WHERE m.user_ids @> ARRAY[$1::integer] ORDER BY")
+		require.Equal(t, []any{int32(3), int32(21)}, args)
+	})
+
+	t.Run("next page continues before the cursor", func(t *testing.T) {
+		// given
+		after := &users.MatchesCursor{CreatedAt: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), ID: "3-9"}
+
+		// when
+		sql, args := matchesQuery(3, 0, after)
+
+		// then
+		require.Contains(t, sql, "AND (m.created_at, m.id) < ($2, $3) ORDER BY m.created_at DESC, m.id DESC")
+		require.NotContains(t, sql, "LIMIT")
+		require.Equal(t, []any{int32(3), after.CreatedAt, "3-9"}, args)
+	})
+}
+
+func TestUserUpdateSet(t *testing.T) {
+	t.Run("empty update sets nothing", func(t *testing.T) {
+		// when
+		set := userUpdateSet(&users.UserUpdate{}, &query{})
+
+		// then
+		require.Empty(t, set)
+	})
+
+	t.Run("age and location set several columns", func(t *testing.T) {
+		// given
+		dob := time.Date(1990, 1, 2, 0, 0, 0, 0, time.UTC)
+		update := &users.UserUpdate{
+			Age:      &users.Age{Value: 34, DOB: dob},
+			Location: &users.Location{Type: "Point", Coordinates: &users.Coordinates{Longitude: 1, Latitude: 2}},
+		}
+		q := &query{}
+
+		// when
+		set := userUpdateSet(update, q)
+
+		// then
+		require.Equal(t, []string{
+			"age_value = $1",
+			"dob = $2",
+			"location = ST_SetSRID(ST_MakePoint($3, $4), 4326)::geography",
+		}, set)
+		require.Equal(t, []any{int32(34), dob, float64(1), float64(2)}, q.args)
+	})
+}
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+// Block is idempotent, blocking the same user twice keeps the first block.
+func (u *User) Block(ctx context.Context, block *users.Block) error {
+	_, err := u.pool.Exec(ctx, "INSERT INTO blocks (blocker_id, blocked_id, created_at) VALUES ($1, $2, $3) "+
+		"ON CONFLICT (blocker_id, blocked_id) DO NOTHING", block.BlockerID, block.BlockedID, block.CreatedAt)
+	return err
+}
+
+// GetBlockedIDs returns the users blocked by ID as well as the users who blocked ID.
+func (u *User) GetBlockedIDs(ctx context.Context, ID int32) ([]int32, error) {
+	return u.queryIDs(ctx, "SELECT blocked_id FROM blocks WHERE blocker_id = $1 "+
+		"UNION ALL SELECT blocker_id FROM blocks WHERE blocked_id = $1", ID)
+}
+
+func (u *User) CreateReport(ctx context.Context, report *users.Report) (*users.Report, error) {
+	err := u.pool.QueryRow(ctx, "INSERT INTO reports (reporter_id, reported_id, reason, details, status, created_at) "+
+		"VALUES ($1, $2, $3, $4, $5, $6) RETURNING id", report.ReporterID, report.ReportedID, string(report.Reason),
+		report.Details, string(report.Status), report.CreatedAt).Scan(&report.ID)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (u *User) ListReports(ctx context.Context, filter *users.ReportFilter) ([]*users.Report, *users.ReportsCursor, error) {
+	q := &query{}
+	reportsFilter(filter, q)
+	sql := "SELECT id, reporter_id, reported_id, reason, details, status, created_at FROM reports" +
+		q.whereClause() + " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		sql += " LIMIT " + q.arg(filter.Limit+1)
+	}
+	rows, err := u.pool.Query(ctx, sql, q.args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	reports := make([]*users.Report, 0)
+	for rows.Next() {
+		report := new(users.Report)
+		err = rows.Scan(&report.ID, &report.ReporterID, &report.ReportedID, &report.Reason, &report.Details,
+			&report.Status, &report.CreatedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		reports = append(reports, report)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	// one extra report is requested to know whether there is a next page
+	var next *users.ReportsCursor
+	if filter.Limit > 0 && len(reports) > int(filter.Limit) {
+		reports = reports[:filter.Limit]
+		next = &users.ReportsCursor{ID: reports[len(reports)-1].ID}
+	}
+	return reports, next, nil
+}
+
+// Moderate keeps the decision on the user and appends it to the moderations table, the user history, in one
+// transaction.
+func (u *User) Moderate(ctx context.Context, moderation *users.Moderation) (*users.User, error) {
+	var user *users.User
+	err := pgx.BeginFunc(ctx, u.pool, func(tx pgx.Tx) error {
+		var err error
+		user, err = scanUser(tx.QueryRow(ctx, "UPDATE users SET moderation = $1 WHERE id = $2 RETURNING "+userColumns,
+			toModeration(moderation), moderation.UserID))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "INSERT INTO moderations (user_id, moderator_id, status, reason, until, created_at) "+
+			"VALUES ($1, $2, $3, $4, $5, $6)", moderation.UserID, moderation.ModeratorID, string(moderation.Status),
+			moderation.Reason, moderation.Until, moderation.CreatedAt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetModerations returns the moderation decisions taken on ID, newest first.
+func (u *User) GetModerations(ctx context.Context, ID int32) ([]*users.Moderation, error) {
+	rows, err := u.pool.Query(ctx, "SELECT user_id, moderator_id, status, reason, until, created_at "+
+		"FROM moderations WHERE user_id = $1 ORDER BY created_at DESC, id DESC", ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	moderations := make([]*users.Moderation, 0)
+	for rows.Next() {
+		moderation := new(users.Moderation)
+		err = rows.Scan(&moderation.UserID, &moderation.ModeratorID, &moderation.Status, &moderation.Reason,
+			&moderation.Until, &moderation.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		moderations = append(moderations, moderation)
+	}
+	return moderations, rows.Err()
+}
@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/muzzapp/date-api/internal/storage/storetest"
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// postgisImage is started by the tests when POSTGRES_URL is not set, it has the PostGIS extension.
+const postgisImage = "postgis/postgis:16-3.4"
+
+// testURL returns POSTGRES_URL, or the URL of a throwaway PostGIS container when it is not set. The test is skipped
+// without a Docker daemon to run the container.
+func testURL(t *testing.T) string {
+	t.Helper()
+	if url := os.Getenv("POSTGRES_URL"); url != "" {
+		return url
+	}
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+	container, err := tcpostgres.RunContainer(ctx,
+		testcontainers.WithImage(postgisImage),
+		tcpostgres.WithDatabase("date"),
+		tcpostgres.WithUsername("date"),
+		tcpostgres.WithPassword("date"),
+		// the server restarts once the init scripts ran
+		testcontainers.WithWaitStrategy(wait.ForLog("database system is ready to accept connections").
+			WithOccurrence(2).WithStartupTimeout(2*time.Minute)),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = container.Terminate(ctx)
+	})
+	url, err := container.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+	return url
+}
+
+// TestStoreConformance runs against the PostgreSQL of POSTGRES_URL, which needs the PostGIS extension available,
+// or a PostGIS container when it is not set, every test gets its own schema.
+func TestStoreConformance(t *testing.T) {
+	url := testURL(t)
+	storetest.Run(t, func(t *testing.T) users.Store {
+		ctx := context.Background()
+		schema := fmt.Sprintf("date_storetest_%d", time.Now().UnixNano())
+		admin, err := pgxpool.New(ctx, url)
+		require.NoError(t, err)
+		t.Cleanup(admin.Close)
+		_, err = admin.Exec(ctx, "CREATE SCHEMA "+schema)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, _ = admin.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE")
+		})
+
+		poolConf, err := pgxpool.ParseConfig(url)
+		require.NoError(t, err)
+		// PostGIS stays in public, the tables of the test go to its schema
+		poolConf.ConnConfig.RuntimeParams["search_path"] = schema + ",public"
+		pool, err := connect(ctx, poolConf, 5*time.Second)
+		require.NoError(t, err)
+		t.Cleanup(pool.Close)
+		require.NoError(t, Migrate(ctx, pool))
+		return NewUser(pool)
+	})
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+type Tokens struct {
+	pool *pgxpool.Pool
+}
+
+var (
+	_ users.TokenStore = (*Tokens)(nil)
+)
+
+func NewTokens(pool *pgxpool.Pool) *Tokens {
+	return &Tokens{pool: pool}
+}
+
+func (t *Tokens) CreateOneTimeToken(ctx context.Context, token *users.OneTimeToken) error {
+	_, err := t.pool.Exec(ctx, "INSERT INTO one_time_tokens (id, purpose, user_id, expires_at, created_at, used_at) "+
+		"VALUES ($1, $2, $3, $4, $5, $6)", token.ID, string(token.Purpose), token.UserID, token.ExpiresAt,
+		token.CreatedAt, token.UsedAt)
+	return err
+}
+
+// UseOneTimeToken finds and marks the token in a single update so a token cannot be used twice concurrently.
+func (t *Tokens) UseOneTimeToken(ctx context.Context, ID string, purpose users.TokenPurpose, now time.Time) (*users.OneTimeToken, error) {
+	token := new(users.OneTimeToken)
+	err := t.pool.QueryRow(ctx, "UPDATE one_time_tokens SET used_at = $3 "+
+		"WHERE id = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3 "+
+		"RETURNING id, purpose, user_id, expires_at, created_at, used_at", ID, string(purpose), now).
+		Scan(&token.ID, &token.Purpose, &token.UserID, &token.ExpiresAt, &token.CreatedAt, &token.UsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = users.ErrInvalidToken
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+func (t *Tokens) RevokeOneTimeTokens(ctx context.Context, userID int32, purpose users.TokenPurpose, now time.Time) error {
+	_, err := t.pool.Exec(ctx, "UPDATE one_time_tokens SET used_at = $3 "+
+		"WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL", userID, string(purpose), now)
+	return err
+}
@@ -0,0 +1,367 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+var errMissingLocation = errors.New("discover requires the requester location")
+
+type User struct {
+	pool *pgxpool.Pool
+}
+
+var (
+	_ users.Store = (*User)(nil)
+)
+
+func NewUser(pool *pgxpool.Pool) *User {
+	return &User{pool: pool}
+}
+
+// userColumns are the columns read by scanUser, in order.
+const userColumns = "id, email, password, name, gender, bio, age_value, dob, " +
+	"ST_X(location::geometry), ST_Y(location::geometry), preferences, email_verified, two_factor, role, " +
+	"moderation, deleted_at"
+
+func scanUser(row pgx.Row) (*users.User, error) {
+	user := new(users.User)
+	var age *int32
+	var dob *time.Time
+	var longitude, latitude *float64
+	var preferences *Preferences
+	var twoFactor *TwoFactor
+	var moderation *Moderation
+	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.Gender, &user.Bio, &age, &dob,
+		&longitude, &latitude, &preferences, &user.EmailVerified, &twoFactor, &user.Role, &moderation, &user.DeletedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = users.ErrUserNotFound
+		}
+		return nil, err
+	}
+	if age != nil {
+		user.Age = &users.Age{Value: *age}
+		if dob != nil {
+			user.Age.DOB = *dob
+		}
+	}
+	if longitude != nil && latitude != nil {
+		user.Location = &users.Location{
+			Type:        "Point",
+			Coordinates: &users.Coordinates{Longitude: *longitude, Latitude: *latitude},
+		}
+	}
+	user.Preferences = preferences.toPreferences()
+	user.TwoFactor = twoFactor.toTwoFactor()
+	user.Moderation = moderation.toModeration()
+	return user, nil
+}
+
+func (u *User) CreateUser(ctx context.Context, user *users.User) (*users.User, error) {
+	q := &query{}
+	var age *int32
+	var dob *time.Time
+	if user.Age != nil {
+		age, dob = &user.Age.Value, &user.Age.DOB
+	}
+	values := []string{
+		q.arg(user.Email), q.arg(user.Password), q.arg(user.Name), q.arg(user.Gender), q.arg(user.Bio),
+		q.arg(age), q.arg(dob), pointColumn(user.Location, q), q.arg(toPreferences(user.Preferences)),
+		q.arg(user.EmailVerified), q.arg(toTwoFactor(user.TwoFactor)), q.arg(string(user.Role)),
+		q.arg(toModeration(user.Moderation)), q.arg(user.DeletedAt),
+	}
+	sql := "INSERT INTO users (email, password, name, gender, bio, age_value, dob, location, preferences, " +
+		"email_verified, two_factor, role, moderation, deleted_at) VALUES (" + strings.Join(values, ", ") + ") RETURNING id"
+	if err := u.pool.QueryRow(ctx, sql, q.args...).Scan(&user.ID); err != nil {
+		if isUniqueViolation(err) {
+			err = users.ErrEmailTaken
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (u *User) GetUser(ctx context.Context, ID int32) (*users.User, error) {
+	return scanUser(u.pool.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", ID))
+}
+
+// GetRankByIDs counts the genders and sums the ages of the users in one query, the rank is computed like
+// persistence.User does from its $facet.
+func (u *User) GetRankByIDs(ctx context.Context, IDs []int32) (*users.Rank, error) {
+	rows, err := u.pool.Query(ctx, "SELECT gender, count(*), coalesce(sum(age_value), 0), count(age_value) "+
+		"FROM users WHERE id = ANY($1) GROUP BY gender ORDER BY count(*) DESC", IDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []int64
+	var genders []string
+	var ageSum, ages int64
+	for rows.Next() {
+		var gender string
+		var count, sum, withAge int64
+		if err = rows.Scan(&gender, &count, &sum, &withAge); err != nil {
+			return nil, err
+		}
+		genders = append(genders, gender)
+		counts = append(counts, count)
+		ageSum += sum
+		ages += withAge
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(counts) == 0 {
+		return nil, nil
+	}
+
+	rank := &users.Rank{}
+	if ages > 0 {
+		rank.AvgAge = int32(float64(ageSum) / float64(ages))
+	}
+	// a tie between the two most swiped genders ranks on age only
+	if len(counts) < 2 || counts[0] != counts[1] {
+		rank.MostCommonGender = genders[0]
+	}
+	return rank, nil
+}
+
+func (u *User) GetUserByEmail(ctx context.Context, email string) (*users.User, error) {
+	return scanUser(u.pool.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE email = $1", email))
+}
+
+func (u *User) UpdateUser(ctx context.Context, ID int32, update *users.UserUpdate) (*users.User, error) {
+	q := &query{}
+	set := userUpdateSet(update, q)
+	if len(set) == 0 {
+		return u.GetUser(ctx, ID)
+	}
+	sql := "UPDATE users SET " + strings.Join(set, ", ") + " WHERE id = " + q.arg(ID) + " RETURNING " + userColumns
+	return scanUser(u.pool.QueryRow(ctx, sql, q.args...))
+}
+
+func (u *User) UseRecoveryCode(ctx context.Context, ID int32, hashedCode string) error {
+	tag, err := u.pool.Exec(ctx, "UPDATE users "+
+		"SET two_factor = jsonb_set(two_factor, '{recoveryCodes}', (two_factor->'recoveryCodes') - $2::text) "+
+		"WHERE id = $1 AND two_factor->'recoveryCodes' ? $2", ID, hashedCode)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return users.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (u *User) UseTOTPStep(ctx context.Context, ID int32, step int64) error {
+	tag, err := u.pool.Exec(ctx, "UPDATE users "+
+		"SET two_factor = jsonb_set(two_factor, '{lastStep}', to_jsonb($2::bigint)) "+
+		"WHERE id = $1 AND two_factor IS NOT NULL AND COALESCE((two_factor->>'lastStep')::bigint, 0) < $2",
+		ID, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return users.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (u *User) Discover(ctx context.Context, filter *users.DiscoverFilter) ([]*users.Profile, *users.DiscoverCursor, error) {
+	if filter.Location == nil || filter.Location.Coordinates == nil {
+		return nil, nil, errMissingLocation
+	}
+	sql, args := discoverQuery(filter)
+	rows, err := u.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	profiles := make([]*users.Profile, 0)
+	var positions []users.DiscoverCursor
+	for rows.Next() {
+		profile := new(users.Profile)
+		var position users.DiscoverCursor
+		err = rows.Scan(&profile.ID, &profile.Name, &profile.Gender, &profile.Age, &position.DistanceFromMe,
+			&position.GenderSort, &position.AgeSort)
+		if err != nil {
+			return nil, nil, err
+		}
+		position.ID = profile.ID
+		profile.DistanceFromMe = int32(position.DistanceFromMe)
+		profiles = append(profiles, profile)
+		positions = append(positions, position)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// one extra profile is requested to know whether there is a next page
+	var next *users.DiscoverCursor
+	if filter.Limit > 0 && len(profiles) > int(filter.Limit) {
+		profiles = profiles[:filter.Limit]
+		next = &positions[filter.Limit-1]
+	}
+	return profiles, next, nil
+}
+
+func (u *User) GetYesSwipeIDs(ctx context.Context, ID int32) ([]int32, error) {
+	return u.queryIDs(ctx, "SELECT swiped_id FROM swipes WHERE swiper_id = $1 AND ok", ID)
+}
+
+// Swipe records the latest decision of ID about swipe.ID, swiping the same profile again only updates it.
+func (u *User) Swipe(ctx context.Context, ID int32, swipe *users.Swipe) error {
+	_, err := u.pool.Exec(ctx, "INSERT INTO swipes (swiper_id, swiped_id, ok, created_at, updated_at) "+
+		"VALUES ($1, $2, $3, $4, $4) "+
+		"ON CONFLICT (swiper_id, swiped_id) DO UPDATE SET ok = EXCLUDED.ok, updated_at = EXCLUDED.updated_at",
+		ID, swipe.ID, swipe.OK, time.Now().UTC())
+	return err
+}
+
+func (u *User) GetSwipes(ctx context.Context, ID int32) ([]*users.SwipeRecord, error) {
+	rows, err := u.pool.Query(ctx, "SELECT swiped_id, ok, created_at, updated_at FROM swipes "+
+		"WHERE swiper_id = $1 ORDER BY created_at, swiped_id", ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	swipes := make([]*users.SwipeRecord, 0)
+	for rows.Next() {
+		swipe := new(users.SwipeRecord)
+		if err = rows.Scan(&swipe.SwipedID, &swipe.OK, &swipe.CreatedAt, &swipe.UpdatedAt); err != nil {
+			return nil, err
+		}
+		swipes = append(swipes, swipe)
+	}
+	return swipes, rows.Err()
+}
+
+func (u *User) Match(ctx context.Context, ID, swipedID int32) (bool, error) {
+	var matched bool
+	err := u.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM swipes WHERE swiper_id = $1 AND swiped_id = $2 AND ok)",
+		swipedID, ID).Scan(&matched)
+	return matched, err
+}
+
+// CreateMatch stores the match unless it already exists, in which case the stored match is returned.
+func (u *User) CreateMatch(ctx context.Context, match *users.Match) (*users.Match, error) {
+	_, err := u.pool.Exec(ctx, "INSERT INTO matches (id, user_ids, created_at) VALUES ($1, $2, $3) "+
+		"ON CONFLICT (id) DO NOTHING", match.ID, match.UserIDs, match.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return u.GetMatch(ctx, match.ID)
+}
+
+func (u *User) GetMatch(ctx context.Context, matchID string) (*users.Match, error) {
+	match := new(users.Match)
+	err := u.pool.QueryRow(ctx, "SELECT id, user_ids, created_at FROM matches WHERE id = $1", matchID).
+		Scan(&match.ID, &match.UserIDs, &match.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = users.ErrMatchNotFound
+		}
+		return nil, err
+	}
+	return match, nil
+}
+
+func (u *User) GetMatches(ctx context.Context, ID, limit int32, after *users.MatchesCursor) ([]*users.Match, *users.MatchesCursor, error) {
+	sql, args := matchesQuery(ID, limit, after)
+	rows, err := u.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	matches := make([]*users.Match, 0)
+	for rows.Next() {
+		match := &users.Match{Profile: new(users.Profile)}
+		err = rows.Scan(&match.ID, &match.UserIDs, &match.CreatedAt,
+			&match.Profile.ID, &match.Profile.Name, &match.Profile.Gender, &match.Profile.Age)
+		if err != nil {
+			return nil, nil, err
+		}
+		matches = append(matches, match)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *users.MatchesCursor
+	if limit > 0 && len(matches) > int(limit) {
+		matches = matches[:limit]
+		last := matches[len(matches)-1]
+		next = &users.MatchesCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	return matches, next, nil
+}
+
+// Unmatch records the unmatch event and deletes the match in one transaction.
+func (u *User) Unmatch(ctx context.Context, unmatch *users.Unmatch) error {
+	return pgx.BeginFunc(ctx, u.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "INSERT INTO unmatches (match_id, user_ids, initiator_id, created_at) "+
+			"VALUES ($1, $2, $3, $4)", unmatch.MatchID, unmatch.UserIDs, unmatch.InitiatorID, unmatch.CreatedAt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM matches WHERE id = $1", unmatch.MatchID)
+		return err
+	})
+}
+
+func (u *User) GetUnmatchedIDs(ctx context.Context, ID int32) ([]int32, error) {
+	return u.queryIDs(ctx, "SELECT other FROM unmatches, unnest(user_ids) other "+
+		"WHERE user_ids @> ARRAY[$1::integer] AND other <> $1", ID)
+}
+
+func (u *User) GetDeletedUserIDs(ctx context.Context, deletedBefore time.Time) ([]int32, error) {
+	return u.queryIDs(ctx, "SELECT id FROM users WHERE deleted_at < $1", deletedBefore)
+}
+
+// PurgeUser deletes the user and everything linked to them in one transaction.
+func (u *User) PurgeUser(ctx context.Context, ID int32) error {
+	return pgx.BeginFunc(ctx, u.pool, func(tx pgx.Tx) error {
+		for _, sql := range []string{
+			"DELETE FROM swipes WHERE swiper_id = $1 OR swiped_id = $1",
+			"DELETE FROM matches WHERE user_ids @> ARRAY[$1::integer]",
+			"DELETE FROM unmatches WHERE user_ids @> ARRAY[$1::integer]",
+			"DELETE FROM blocks WHERE blocker_id = $1 OR blocked_id = $1",
+			"DELETE FROM reports WHERE reporter_id = $1 OR reported_id = $1",
+			"DELETE FROM moderations WHERE user_id = $1",
+			"DELETE FROM refresh_tokens WHERE user_id = $1",
+			"DELETE FROM one_time_tokens WHERE user_id = $1",
+			"DELETE FROM users WHERE id = $1",
+		} {
+			if _, err := tx.Exec(ctx, sql, ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (u *User) queryIDs(ctx context.Context, sql string, args ...any) ([]int32, error) {
+	rows, err := u.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	IDs, err := pgx.CollectRows(rows, pgx.RowTo[int32])
+	if err != nil {
+		return nil, err
+	}
+	if IDs == nil {
+		IDs = make([]int32, 0)
+	}
+	return IDs, nil
+}
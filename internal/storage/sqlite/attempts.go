@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+type Attempts struct {
+	db *sql.DB
+}
+
+var (
+	_ users.AttemptStore = (*Attempts)(nil)
+)
+
+func NewAttempts(db *sql.DB) *Attempts {
+	return &Attempts{db: db}
+}
+
+func scanLoginAttempts(row row) (*users.LoginAttempts, error) {
+	attempts := new(users.LoginAttempts)
+	var lastFailureAt, lockedUntil sql.NullInt64
+	if err := row.Scan(&attempts.Key, &attempts.Failures, &lastFailureAt, &lockedUntil); err != nil {
+		return nil, err
+	}
+	if lastFailureAt.Valid {
+		attempts.LastFailureAt = fromMicros(lastFailureAt.Int64)
+	}
+	attempts.LockedUntil = fromNullMicros(lockedUntil)
+	return attempts, nil
+}
+
+func (a *Attempts) GetLoginAttempts(ctx context.Context, key string) (*users.LoginAttempts, error) {
+	attempts, err := scanLoginAttempts(a.db.QueryRowContext(ctx, "SELECT key, failures, last_failure_at, "+
+		"locked_until FROM login_attempts WHERE key = ?", key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return &users.LoginAttempts{Key: key}, nil
+	}
+	return attempts, err
+}
+
+// IncrementLoginFailures counts the failure in a single upsert so every failure is counted.
+func (a *Attempts) IncrementLoginFailures(ctx context.Context, key string, now time.Time, window time.Duration) (*users.LoginAttempts, error) {
+	return scanLoginAttempts(a.db.QueryRowContext(ctx, "INSERT INTO login_attempts (key, failures, last_failure_at) "+
+		"VALUES (?1, 1, ?2) ON CONFLICT (key) DO UPDATE SET "+
+		"failures = CASE WHEN coalesce(login_attempts.last_failure_at, ?3 - 1) < ?3 THEN 1 "+
+		"ELSE login_attempts.failures + 1 END, last_failure_at = excluded.last_failure_at "+
+		"RETURNING key, failures, last_failure_at, locked_until", key, micros(now), micros(now.Add(-window))))
+}
+
+func (a *Attempts) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := a.db.ExecContext(ctx, "INSERT INTO login_attempts (key, locked_until) VALUES (?, ?) "+
+		"ON CONFLICT (key) DO UPDATE SET locked_until = excluded.locked_until", key, micros(until))
+	return err
+}
+
+func (a *Attempts) ResetLoginAttempts(ctx context.Context, key string) error {
+	_, err := a.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE key = ?", key)
+	return err
+}
+
+func (a *Attempts) CreateLoginLockout(ctx context.Context, lockout *users.LoginLockout) error {
+	_, err := a.db.ExecContext(ctx, "INSERT INTO login_lockouts (key, failures, locked_until, created_at) "+
+		"VALUES (?, ?, ?, ?)", lockout.Key, lockout.Failures, micros(lockout.LockedUntil), micros(lockout.CreatedAt))
+	return err
+}
@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttempts_IncrementLoginFailures(t *testing.T) {
+	ctx := context.Background()
+	store := newTestDB(t).Attempts
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	t.Run("failures within the window are counted", func(t *testing.T) {
+		// when
+		_, err := store.IncrementLoginFailures(ctx, "email:a", now, time.Hour)
+		require.NoError(t, err)
+		attempts, err := store.IncrementLoginFailures(ctx, "email:a", now.Add(time.Minute), time.Hour)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, int32(2), attempts.Failures)
+		require.Equal(t, now.Add(time.Minute), attempts.LastFailureAt)
+	})
+
+	t.Run("count restarts after the window and keeps the lock", func(t *testing.T) {
+		// given
+		until := now.Add(time.Hour)
+		require.NoError(t, store.LockLogin(ctx, "email:a", until))
+
+		// when
+		attempts, err := store.IncrementLoginFailures(ctx, "email:a", now.Add(2*time.Hour), time.Hour)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, int32(1), attempts.Failures)
+		require.Equal(t, &until, attempts.LockedUntil)
+	})
+
+	t.Run("reset forgets the failures", func(t *testing.T) {
+		// when
+		require.NoError(t, store.ResetLoginAttempts(ctx, "email:a"))
+		attempts, err := store.GetLoginAttempts(ctx, "email:a")
+
+		// then
+		require.NoError(t, err)
+		require.Zero(t, attempts.Failures)
+		require.Nil(t, attempts.LockedUntil)
+	})
+}
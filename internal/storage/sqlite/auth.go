@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/auth"
+)
+
+type Auth struct {
+	db *sql.DB
+}
+
+var (
+	_ auth.Store = (*Auth)(nil)
+)
+
+func NewAuth(db *sql.DB) *Auth {
+	return &Auth{db: db}
+}
+
+func (a *Auth) CreateRefreshToken(ctx context.Context, token *auth.RefreshToken) error {
+	_, err := a.db.ExecContext(ctx, "INSERT INTO refresh_tokens (id, family_id, user_id, expires_at, created_at, "+
+		"revoked_at) VALUES (?, ?, ?, ?, ?, ?)", token.ID, token.FamilyID, token.UserID, micros(token.ExpiresAt),
+		micros(token.CreatedAt), nullMicros(token.RevokedAt))
+	return err
+}
+
+func (a *Auth) GetRefreshToken(ctx context.Context, ID string) (*auth.RefreshToken, error) {
+	token := new(auth.RefreshToken)
+	var expiresAt, createdAt int64
+	var revokedAt sql.NullInt64
+	err := a.db.QueryRowContext(ctx, "SELECT id, family_id, user_id, expires_at, created_at, revoked_at "+
+		"FROM refresh_tokens WHERE id = ?", ID).
+		Scan(&token.ID, &token.FamilyID, &token.UserID, &expiresAt, &createdAt, &revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = auth.ErrRefreshTokenNotFound
+		}
+		return nil, err
+	}
+	token.ExpiresAt, token.CreatedAt, token.RevokedAt = fromMicros(expiresAt), fromMicros(createdAt),
+		fromNullMicros(revokedAt)
+	return token, nil
+}
+
+func (a *Auth) RevokeRefreshToken(ctx context.Context, ID string, now time.Time) (bool, error) {
+	result, err := a.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+		micros(now), ID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+func (a *Auth) RevokeRefreshTokenFamily(ctx context.Context, familyID string, now time.Time) error {
+	_, err := a.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL",
+		micros(now), familyID)
+	return err
+}
+
+func (a *Auth) RevokeUserRefreshTokens(ctx context.Context, userID int32, now time.Time) error {
+	_, err := a.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		micros(now), userID)
+	return err
+}
+
+// RevokeAccessToken is idempotent, revoking a token twice keeps the first revocation.
+func (a *Auth) RevokeAccessToken(ctx context.Context, token *auth.RevokedToken) error {
+	_, err := a.db.ExecContext(ctx, "INSERT INTO revoked_tokens (jti, expires_at) VALUES (?, ?) "+
+		"ON CONFLICT (jti) DO NOTHING", token.JTI, micros(token.ExpiresAt))
+	return err
+}
+
+func (a *Auth) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := a.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?)", jti).Scan(&revoked)
+	return revoked, err
+}
@@ -0,0 +1,121 @@
+CREATE TABLE users (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    email          TEXT NOT NULL UNIQUE,
+    password       TEXT NOT NULL,
+    name           TEXT NOT NULL DEFAULT '',
+    gender         TEXT NOT NULL DEFAULT '',
+    bio            TEXT NOT NULL DEFAULT '',
+    age_value      INTEGER,
+    dob            INTEGER,
+    longitude      REAL,
+    latitude       REAL,
+    preferences    TEXT,
+    email_verified INTEGER NOT NULL DEFAULT 0,
+    two_factor     TEXT,
+    role           TEXT NOT NULL DEFAULT '',
+    moderation     TEXT,
+    deleted_at     INTEGER
+);
+CREATE INDEX users_latitude_idx ON users (latitude);
+CREATE INDEX users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE swipes (
+    swiper_id  INTEGER NOT NULL,
+    swiped_id  INTEGER NOT NULL,
+    ok         INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    PRIMARY KEY (swiper_id, swiped_id)
+);
+CREATE INDEX swipes_swiped_id_idx ON swipes (swiped_id);
+
+CREATE TABLE matches (
+    id         TEXT PRIMARY KEY,
+    user_id1   INTEGER NOT NULL,
+    user_id2   INTEGER NOT NULL,
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX matches_user_id1_idx ON matches (user_id1, created_at DESC);
+CREATE INDEX matches_user_id2_idx ON matches (user_id2, created_at DESC);
+
+CREATE TABLE unmatches (
+    match_id     TEXT NOT NULL,
+    user_id1     INTEGER NOT NULL,
+    user_id2     INTEGER NOT NULL,
+    initiator_id INTEGER NOT NULL,
+    created_at   INTEGER NOT NULL
+);
+CREATE INDEX unmatches_user_id1_idx ON unmatches (user_id1);
+CREATE INDEX unmatches_user_id2_idx ON unmatches (user_id2);
+
+CREATE TABLE blocks (
+    blocker_id INTEGER NOT NULL,
+    blocked_id INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id)
+);
+CREATE INDEX blocks_blocked_id_idx ON blocks (blocked_id);
+
+CREATE TABLE reports (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    reporter_id INTEGER NOT NULL,
+    reported_id INTEGER NOT NULL,
+    reason      TEXT NOT NULL,
+    details     TEXT NOT NULL DEFAULT '',
+    status      TEXT NOT NULL,
+    created_at  INTEGER NOT NULL
+);
+CREATE INDEX reports_reported_id_idx ON reports (reported_id);
+CREATE INDEX reports_status_idx ON reports (status, created_at DESC);
+
+CREATE TABLE moderations (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id      INTEGER NOT NULL,
+    moderator_id INTEGER NOT NULL,
+    status       TEXT NOT NULL,
+    reason       TEXT NOT NULL DEFAULT '',
+    until        INTEGER,
+    created_at   INTEGER NOT NULL
+);
+CREATE INDEX moderations_user_id_idx ON moderations (user_id, created_at DESC);
+
+CREATE TABLE refresh_tokens (
+    id         TEXT PRIMARY KEY,
+    family_id  TEXT NOT NULL,
+    user_id    INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    revoked_at INTEGER
+);
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+CREATE TABLE revoked_tokens (
+    jti        TEXT PRIMARY KEY,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE TABLE login_attempts (
+    key             TEXT PRIMARY KEY,
+    failures        INTEGER NOT NULL DEFAULT 0,
+    last_failure_at INTEGER,
+    locked_until    INTEGER
+);
+
+CREATE TABLE login_lockouts (
+    key          TEXT NOT NULL,
+    failures     INTEGER NOT NULL,
+    locked_until INTEGER NOT NULL,
+    created_at   INTEGER NOT NULL
+);
+CREATE INDEX login_lockouts_key_idx ON login_lockouts (key, created_at DESC);
+
+CREATE TABLE one_time_tokens (
+    id         TEXT PRIMARY KEY,
+    purpose    TEXT NOT NULL,
+    user_id    INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    used_at    INTEGER
+);
+CREATE INDEX one_time_tokens_user_id_idx ON one_time_tokens (user_id, purpose);
@@ -0,0 +1,173 @@
+package sqlite
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+// Preferences, TwoFactor and Moderation are kept as JSON text, their JSON keys match the MongoDB fields.
+// They are driver.Valuer and sql.Scanner so they are written and read directly, a nil pointer is NULL.
+
+func jsonValue(v any) (driver.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func scanJSON(src, v any) error {
+	switch src := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(src), v)
+	case []byte:
+		return json.Unmarshal(src, v)
+	default:
+		return fmt.Errorf("cannot scan %T as JSON", src)
+	}
+}
+
+type Preferences struct {
+	Genders     []string           `json:"genders"`
+	MinAge      int32              `json:"minAge"`
+	MaxAge      int32              `json:"maxAge"`
+	MaxDistance float64            `json:"maxDistance"`
+	Unit        users.DistanceUnit `json:"unit"`
+	Ranked      bool               `json:"ranked"`
+}
+
+func (p Preferences) Value() (driver.Value, error) {
+	return jsonValue(p)
+}
+
+func (p *Preferences) Scan(src any) error {
+	return scanJSON(src, p)
+}
+
+func toPreferences(p *users.Preferences) *Preferences {
+	if p == nil {
+		return nil
+	}
+	genders := p.Genders
+	// an empty array rather than null keeps the mutual filter a single comparison
+	if genders == nil {
+		genders = []string{}
+	}
+	return &Preferences{
+		Genders:     genders,
+		MinAge:      p.MinAge,
+		MaxAge:      p.MaxAge,
+		MaxDistance: p.MaxDistance,
+		Unit:        p.Unit,
+		Ranked:      p.Ranked,
+	}
+}
+
+func (p *Preferences) toPreferences() *users.Preferences {
+	if p == nil {
+		return nil
+	}
+	return &users.Preferences{
+		Genders:     p.Genders,
+		MinAge:      p.MinAge,
+		MaxAge:      p.MaxAge,
+		MaxDistance: p.MaxDistance,
+		Unit:        p.Unit,
+		Ranked:      p.Ranked,
+	}
+}
+
+type TwoFactor struct {
+	Secret        string     `json:"secret"`
+	Enabled       bool       `json:"enabled"`
+	RecoveryCodes []string   `json:"recoveryCodes"`
+	EnabledAt     *time.Time `json:"enabledAt,omitempty"`
+	LastStep      int64      `json:"lastStep,omitempty"`
+}
+
+func (t TwoFactor) Value() (driver.Value, error) {
+	return jsonValue(t)
+}
+
+func (t *TwoFactor) Scan(src any) error {
+	return scanJSON(src, t)
+}
+
+func toTwoFactor(t *users.TwoFactor) *TwoFactor {
+	if t == nil {
+		return nil
+	}
+	codes := t.RecoveryCodes
+	if codes == nil {
+		codes = []string{}
+	}
+	return &TwoFactor{
+		Secret:        t.Secret,
+		Enabled:       t.Enabled,
+		RecoveryCodes: codes,
+		EnabledAt:     t.EnabledAt,
+		LastStep:      t.LastStep,
+	}
+}
+
+func (t *TwoFactor) toTwoFactor() *users.TwoFactor {
+	if t == nil {
+		return nil
+	}
+	return &users.TwoFactor{
+		Secret:        t.Secret,
+		Enabled:       t.Enabled,
+		RecoveryCodes: t.RecoveryCodes,
+		EnabledAt:     t.EnabledAt,
+		LastStep:      t.LastStep,
+	}
+}
+
+type Moderation struct {
+	UserID      int32                  `json:"userID"`
+	ModeratorID int32                  `json:"moderatorID"`
+	Status      users.ModerationStatus `json:"status"`
+	Reason      string                 `json:"reason"`
+	Until       *time.Time             `json:"until,omitempty"`
+	CreatedAt   time.Time              `json:"createdAt"`
+}
+
+func (m Moderation) Value() (driver.Value, error) {
+	return jsonValue(m)
+}
+
+func (m *Moderation) Scan(src any) error {
+	return scanJSON(src, m)
+}
+
+func toModeration(m *users.Moderation) *Moderation {
+	if m == nil {
+		return nil
+	}
+	return &Moderation{
+		UserID:      m.UserID,
+		ModeratorID: m.ModeratorID,
+		Status:      m.Status,
+		Reason:      m.Reason,
+		Until:       m.Until,
+		CreatedAt:   m.CreatedAt,
+	}
+}
+
+func (m *Moderation) toModeration() *users.Moderation {
+	if m == nil {
+		return nil
+	}
+	return &users.Moderation{
+		UserID:      m.UserID,
+		ModeratorID: m.ModeratorID,
+		Status:      m.Status,
+		Reason:      m.Reason,
+		Until:       m.Until,
+		CreatedAt:   m.CreatedAt,
+	}
+}
@@ -0,0 +1,274 @@
+package sqlite
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/muzzapp/date-api/internal/storage/discover"
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+// query collects the conditions of a WHERE clause and their numbered arguments.
+type query struct {
+	conditions []string
+	args       []any
+}
+
+// arg adds an argument and returns its placeholder.
+func (q *query) arg(v any) string {
+	q.args = append(q.args, v)
+	return "?" + strconv.Itoa(len(q.args))
+}
+
+// list adds the arguments of an IN list and returns their placeholders.
+func list[T any](q *query, values []T) string {
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		placeholders[i] = q.arg(v)
+	}
+	return "(" + strings.Join(placeholders, ", ") + ")"
+}
+
+func (q *query) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// whereClause joins the conditions, it is empty without any.
+func (q *query) whereClause() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// discoverQuery is the SQL counterpart of the $geoNear pipeline of persistence.User, the candidates are filtered
+// like matchFilter, ranked like rankStages and paged like afterCursorStage. The distances are measured with the
+// math functions on the sphere of discover.Distance, with a max distance the candidates are first narrowed down to
+// the latitudes it covers so the latitude index is used.
+func discoverQuery(filter *users.DiscoverFilter) (string, []any) {
+	q := &query{}
+	distance := distanceColumn(filter.Location.Coordinates, q)
+	q.where("u.longitude IS NOT NULL AND u.latitude IS NOT NULL")
+	matchFilter(filter, q)
+	if filter.MaxDistance > 0 {
+		low, high := discover.LatitudeRange(filter.Location.Coordinates, filter.MaxDistance)
+		q.where("u.latitude BETWEEN " + q.arg(low) + " AND " + q.arg(high))
+	}
+	hiddenFilter(filter.ID, q)
+
+	genderSort, ageSort := "0", "0"
+	if filter.Rank != nil {
+		genderSort, ageSort = rankColumns(filter.Rank, q)
+	}
+	candidates := "SELECT u.id, u.name, u.gender, coalesce(u.age_value, 0) AS age, " + distance +
+		" AS distance_from_me, " + genderSort + " AS gender_sort, " + ageSort + " AS age_sort FROM users u" +
+		q.whereClause()
+
+	outer := &query{args: q.args}
+	if filter.MaxDistance > 0 {
+		outer.where("distance_from_me <= " + outer.arg(filter.MaxDistance))
+	}
+	if filter.After != nil {
+		outer.where(afterCursorCondition(filter.Rank, filter.After, outer))
+	}
+	sql := "SELECT id, name, gender, age, distance_from_me, gender_sort, age_sort FROM (" + candidates + ") candidates" +
+		outer.whereClause() + " ORDER BY " + strings.Join(sortKeys(filter.Rank), ", ")
+	if filter.Limit > 0 {
+		sql += " LIMIT " + outer.arg(filter.Limit+1)
+	}
+	return sql, outer.args
+}
+
+// distanceColumn is the haversine distance in meters between c and the user location, like discover.Distance.
+func distanceColumn(c *users.Coordinates, q *query) string {
+	longitude, latitude := q.arg(c.Longitude), q.arg(c.Latitude)
+	return "2 * " + strconv.Itoa(discover.EarthRadius) + " * asin(min(1, sqrt(" +
+		"pow(sin(radians(u.latitude - " + latitude + ") / 2), 2) + cos(radians(" + latitude + ")) * " +
+		"cos(radians(u.latitude)) * pow(sin(radians(u.longitude - " + longitude + ") / 2), 2))))"
+}
+
+// rankColumns returns the genderSort and ageSort expressions of rankStages.
+func rankColumns(rank *users.Rank, q *query) (string, string) {
+	genderSort := "0"
+	if rank.MostCommonGender != "" {
+		genderSort = "CASE WHEN u.gender = " + q.arg(rank.MostCommonGender) + " THEN 1 ELSE 2 END"
+	}
+	return genderSort, "abs(coalesce(u.age_value, 0) - " + q.arg(rank.AvgAge) + ")"
+}
+
+// sortKeys returns the discover sort order, id is always last so every profile has a unique position to page from.
+func sortKeys(rank *users.Rank) []string {
+	var keys []string
+	if rank != nil {
+		if rank.MostCommonGender != "" {
+			keys = append(keys, "gender_sort")
+		}
+		keys = append(keys, "age_sort")
+	}
+	return append(keys, "distance_from_me", "id")
+}
+
+// afterCursorCondition keeps the profiles sorted after the cursor, comparing the sort keys as a row.
+func afterCursorCondition(rank *users.Rank, after *users.DiscoverCursor, q *query) string {
+	var values []string
+	if rank != nil {
+		if rank.MostCommonGender != "" {
+			values = append(values, q.arg(after.GenderSort))
+		}
+		values = append(values, q.arg(after.AgeSort))
+	}
+	values = append(values, q.arg(after.DistanceFromMe), q.arg(after.ID))
+	return "(" + strings.Join(sortKeys(rank), ", ") + ") > (" + strings.Join(values, ", ") + ")"
+}
+
+func matchFilter(filter *users.DiscoverFilter, q *query) {
+	q.where("u.id <> " + q.arg(filter.ID))
+	ageFilter(filter.MinAge, filter.MaxAge, q)
+	genderFilter(filter.Genders, q)
+	mutualFilter(filter.RequesterGender, filter.RequesterAge, q)
+	moderationFilter(q)
+	if filter.VerifiedOnly {
+		q.where("u.email_verified")
+	}
+}
+
+// moderationFilter hides banned and deleted users as well as suspended users until the end of their suspension.
+func moderationFilter(q *query) {
+	statuses := []string{string(users.ModerationStatusBanned), string(users.ModerationStatusSuspended)}
+	q.where("(coalesce(json_extract(u.moderation, '$.status'), '') NOT IN " + list(q, statuses) +
+		" OR (json_extract(u.moderation, '$.status') = " + q.arg(string(users.ModerationStatusSuspended)) +
+		" AND julianday(json_extract(u.moderation, '$.until')) <= julianday('now')))")
+	q.where("u.deleted_at IS NULL")
+}
+
+// hiddenFilter excludes the users ID swiped, unmatched, blocked or was blocked by with anti-joins, like the
+// hiddenLookupStages of persistence.User.
+func hiddenFilter(ID int32, q *query) {
+	me := q.arg(ID)
+	q.where("NOT EXISTS (SELECT 1 FROM swipes s WHERE s.swiper_id = " + me + " AND s.swiped_id = u.id)")
+	q.where("NOT EXISTS (SELECT 1 FROM unmatches m WHERE (m.user_id1 = " + me + " AND m.user_id2 = u.id) OR " +
+		"(m.user_id1 = u.id AND m.user_id2 = " + me + "))")
+	q.where("NOT EXISTS (SELECT 1 FROM blocks b WHERE (b.blocker_id = " + me + " AND b.blocked_id = u.id) OR " +
+		"(b.blocker_id = u.id AND b.blocked_id = " + me + "))")
+}
+
+func ageFilter(minAge, maxAge int32, q *query) {
+	if minAge > 0 {
+		q.where("u.age_value >= " + q.arg(minAge))
+	}
+	if maxAge > 0 {
+		q.where("u.age_value <= " + q.arg(maxAge))
+	}
+}
+
+func genderFilter(genders []string, q *query) {
+	switch len(genders) {
+	case 0:
+	case 1:
+		q.where("u.gender = " + q.arg(genders[0]))
+	default:
+		q.where("u.gender IN " + list(q, genders))
+	}
+}
+
+// mutualFilter only keeps the candidates whose saved preferences accept the requester,
+// missing or zero preferences accept everyone.
+func mutualFilter(gender string, age int32, q *query) {
+	if gender != "" {
+		q.where("(u.preferences IS NULL OR coalesce(json_array_length(u.preferences, '$.genders'), 0) = 0 OR " +
+			"EXISTS (SELECT 1 FROM json_each(u.preferences, '$.genders') WHERE value = " + q.arg(gender) + "))")
+	}
+	if age > 0 {
+		placeholder := q.arg(age)
+		q.where("(coalesce(json_extract(u.preferences, '$.maxAge'), 0) = 0 OR " +
+			"json_extract(u.preferences, '$.maxAge') >= " + placeholder + ")")
+		q.where("coalesce(json_extract(u.preferences, '$.minAge'), 0) <= " + placeholder)
+	}
+}
+
+// userUpdateSet returns the SET assignments of the non nil fields of update.
+func userUpdateSet(update *users.UserUpdate, q *query) []string {
+	var set []string
+	assign := func(column string, v any) {
+		set = append(set, column+" = "+q.arg(v))
+	}
+	if update.Password != nil {
+		assign("password", *update.Password)
+	}
+	if update.EmailVerified != nil {
+		assign("email_verified", *update.EmailVerified)
+	}
+	if update.TwoFactor != nil {
+		assign("two_factor", toTwoFactor(update.TwoFactor))
+	}
+	if update.DeletedAt != nil {
+		assign("deleted_at", micros(*update.DeletedAt))
+	}
+	if update.Name != nil {
+		assign("name", *update.Name)
+	}
+	if update.Gender != nil {
+		assign("gender", *update.Gender)
+	}
+	if update.Bio != nil {
+		assign("bio", *update.Bio)
+	}
+	if update.Age != nil {
+		assign("age_value", update.Age.Value)
+		assign("dob", micros(update.Age.DOB))
+	}
+	if update.Location != nil {
+		longitude, latitude := coordinates(update.Location)
+		assign("longitude", longitude)
+		assign("latitude", latitude)
+	}
+	if update.Preferences != nil {
+		assign("preferences", toPreferences(update.Preferences))
+	}
+	return set
+}
+
+// coordinates returns the longitude and latitude of a location, nil without coordinates.
+func coordinates(location *users.Location) (any, any) {
+	if location == nil || location.Coordinates == nil {
+		return nil, nil
+	}
+	return location.Coordinates.Longitude, location.Coordinates.Latitude
+}
+
+// reportsFilter is the WHERE clause of the reports listed to moderators.
+func reportsFilter(filter *users.ReportFilter, q *query) {
+	if filter.Status != "" {
+		q.where("status = " + q.arg(string(filter.Status)))
+	}
+	if filter.Reason != "" {
+		q.where("reason = " + q.arg(string(filter.Reason)))
+	}
+	if filter.ReporterID > 0 {
+		q.where("reporter_id = " + q.arg(filter.ReporterID))
+	}
+	if filter.ReportedID > 0 {
+		q.where("reported_id = " + q.arg(filter.ReportedID))
+	}
+	if filter.After != nil {
+		q.where("id < " + q.arg(filter.After.ID))
+	}
+}
+
+// matchesQuery lists the matches of ID newest first joined with the other user, the matches with a deleted
+// user are dropped like in persistence.matchesPipeline.
+func matchesQuery(ID, limit int32, after *users.MatchesCursor) (string, []any) {
+	q := &query{}
+	placeholder := q.arg(ID)
+	q.where("(m.user_id1 = " + placeholder + " OR m.user_id2 = " + placeholder + ")")
+	if after != nil {
+		q.where("(m.created_at, m.id) < (" + q.arg(micros(after.CreatedAt)) + ", " + q.arg(after.ID) + ")")
+	}
+	sql := "SELECT m.id, m.user_id1, m.user_id2, m.created_at, u.id, u.name, u.gender, coalesce(u.age_value, 0) " +
+		"FROM matches m JOIN users u ON u.id = CASE WHEN m.user_id1 = " + placeholder + " THEN m.user_id2 " +
+		"ELSE m.user_id1 END AND u.deleted_at IS NULL" + q.whereClause() + " ORDER BY m.created_at DESC, m.id DESC"
+	if limit > 0 {
+		sql += " LIMIT " + q.arg(limit+1)
+	}
+	return sql, q.args
+}
@@ -0,0 +1,43 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverQuery(t *testing.T) {
+	location := &users.Location{Type: "Point", Coordinates: &users.Coordinates{Longitude: 1, Latitude: 2}}
+
+	t.Run("limit fetches one extra profile after sorting", func(t *testing.T) {
+		// when
+		sql, args := discoverQuery(&users.DiscoverFilter{ID: 1, Location: location, Limit: 20})
+
+		// then
+		require.Contains(t, sql, " ORDER BY distance_from_me, id LIMIT ?")
+		require.Equal(t, int32(21), args[len(args)-1])
+	})
+
+	t.Run("max distance narrows the latitudes then filters on the distance", func(t *testing.T) {
+		// when
+		sql, args := discoverQuery(&users.DiscoverFilter{ID: 1, Location: location, MaxDistance: 5000})
+
+		// then
+		require.Contains(t, sql, "u.latitude BETWEEN ?")
+		require.Contains(t, sql, ") candidates WHERE distance_from_me <= ?")
+		require.Equal(t, float64(5000), args[len(args)-1])
+	})
+
+	t.Run("cursor is matched after the rank columns are computed", func(t *testing.T) {
+		// given
+		after := &users.DiscoverCursor{AgeSort: 2, DistanceFromMe: 10, ID: 4}
+
+		// when
+		sql, args := discoverQuery(&users.DiscoverFilter{ID: 1, Location: location, Rank: &users.Rank{AvgAge: 30}, After: after})
+
+		// then
+		require.Contains(t, sql, ") candidates WHERE (age_sort, distance_from_me, id) > (?")
+		require.Equal(t, []any{int32(2), float64(10), int32(4)}, args[len(args)-3:])
+	})
+}
@@ -0,0 +1,116 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+// Block is idempotent, blocking the same user twice keeps the first block.
+func (u *User) Block(ctx context.Context, block *users.Block) error {
+	_, err := u.db.ExecContext(ctx, "INSERT INTO blocks (blocker_id, blocked_id, created_at) VALUES (?, ?, ?) "+
+		"ON CONFLICT (blocker_id, blocked_id) DO NOTHING", block.BlockerID, block.BlockedID, micros(block.CreatedAt))
+	return err
+}
+
+// GetBlockedIDs returns the users blocked by ID as well as the users who blocked ID.
+func (u *User) GetBlockedIDs(ctx context.Context, ID int32) ([]int32, error) {
+	return u.queryIDs(ctx, "SELECT blocked_id FROM blocks WHERE blocker_id = ?1 "+
+		"UNION ALL SELECT blocker_id FROM blocks WHERE blocked_id = ?1", ID)
+}
+
+func (u *User) CreateReport(ctx context.Context, report *users.Report) (*users.Report, error) {
+	err := u.db.QueryRowContext(ctx, "INSERT INTO reports (reporter_id, reported_id, reason, details, status, "+
+		"created_at) VALUES (?, ?, ?, ?, ?, ?) RETURNING id", report.ReporterID, report.ReportedID,
+		string(report.Reason), report.Details, string(report.Status), micros(report.CreatedAt)).Scan(&report.ID)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (u *User) ListReports(ctx context.Context, filter *users.ReportFilter) ([]*users.Report, *users.ReportsCursor, error) {
+	q := &query{}
+	reportsFilter(filter, q)
+	stmt := "SELECT id, reporter_id, reported_id, reason, details, status, created_at FROM reports" +
+		q.whereClause() + " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		stmt += " LIMIT " + q.arg(filter.Limit+1)
+	}
+	rows, err := u.db.QueryContext(ctx, stmt, q.args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	reports := make([]*users.Report, 0)
+	for rows.Next() {
+		report := new(users.Report)
+		var createdAt int64
+		err = rows.Scan(&report.ID, &report.ReporterID, &report.ReportedID, &report.Reason, &report.Details,
+			&report.Status, &createdAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		report.CreatedAt = fromMicros(createdAt)
+		reports = append(reports, report)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	// one extra report is requested to know whether there is a next page
+	var next *users.ReportsCursor
+	if filter.Limit > 0 && len(reports) > int(filter.Limit) {
+		reports = reports[:filter.Limit]
+		next = &users.ReportsCursor{ID: reports[len(reports)-1].ID}
+	}
+	return reports, next, nil
+}
+
+// Moderate keeps the decision on the user and appends it to the moderations table, the user history, in one
+// transaction.
+func (u *User) Moderate(ctx context.Context, moderation *users.Moderation) (*users.User, error) {
+	var user *users.User
+	err := inTx(ctx, u.db, func(tx *sql.Tx) error {
+		var err error
+		user, err = scanUser(tx.QueryRowContext(ctx, "UPDATE users SET moderation = ? WHERE id = ? RETURNING "+
+			userColumns, toModeration(moderation), moderation.UserID))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO moderations (user_id, moderator_id, status, reason, until, "+
+			"created_at) VALUES (?, ?, ?, ?, ?, ?)", moderation.UserID, moderation.ModeratorID,
+			string(moderation.Status), moderation.Reason, nullMicros(moderation.Until), micros(moderation.CreatedAt))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetModerations returns the moderation decisions taken on ID, newest first.
+func (u *User) GetModerations(ctx context.Context, ID int32) ([]*users.Moderation, error) {
+	rows, err := u.db.QueryContext(ctx, "SELECT user_id, moderator_id, status, reason, until, created_at "+
+		"FROM moderations WHERE user_id = ? ORDER BY created_at DESC, id DESC", ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	moderations := make([]*users.Moderation, 0)
+	for rows.Next() {
+		moderation := new(users.Moderation)
+		var until sql.NullInt64
+		var createdAt int64
+		err = rows.Scan(&moderation.UserID, &moderation.ModeratorID, &moderation.Status, &moderation.Reason,
+			&until, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		moderation.Until, moderation.CreatedAt = fromNullMicros(until), fromMicros(createdAt)
+		moderations = append(moderations, moderation)
+	}
+	return moderations, rows.Err()
+}
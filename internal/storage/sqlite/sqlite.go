@@ -0,0 +1,90 @@
+// Package sqlite stores the users in a SQLite file for single node deployments and offline demos,
+// with the pure Go driver so the binary still builds without cgo.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+type Config struct {
+	SQLitePath string `envconfig:"SQLITE_PATH" default:"date.db"`
+}
+
+// Database is every store backed by SQLite, the counterpart of persistence.Database.
+type Database struct {
+	*User
+	*Auth
+	*Attempts
+	*Tokens
+}
+
+func New(db *sql.DB) *Database {
+	return &Database{
+		User:     NewUser(db),
+		Auth:     NewAuth(db),
+		Attempts: NewAttempts(db),
+		Tokens:   NewTokens(db),
+	}
+}
+
+// Open opens the database file, creating it when missing. SQLite allows a single writer so the pool keeps a
+// single connection, which also makes every transaction of the stores serializable. The pragmas are in the DSN so
+// the driver applies them to every connection the pool opens, not only the first one.
+func Open(ctx context.Context, conf *Config) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", dsn(conf.SQLitePath))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if err = db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// dsn adds the pragmas to path, keeping the parameters it may already have.
+func dsn(path string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// Times are stored as UTC unix microseconds, integers compare and sort the same way the times do.
+
+func micros(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+func nullMicros(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixMicro(), Valid: true}
+}
+
+func fromMicros(m int64) time.Time {
+	return time.UnixMicro(m).UTC()
+}
+
+func fromNullMicros(m sql.NullInt64) *time.Time {
+	if !m.Valid {
+		return nil
+	}
+	t := fromMicros(m.Int64)
+	return &t
+}
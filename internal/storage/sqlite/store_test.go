@@ -0,0 +1,81 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/muzzapp/date-api/internal/storage/storetest"
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDB(t *testing.T) *Database {
+	ctx := context.Background()
+	db, err := Open(ctx, &Config{SQLitePath: filepath.Join(t.TempDir(), "date.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	require.NoError(t, Migrate(ctx, db))
+	return New(db)
+}
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) users.Store {
+		return newTestDB(t).User
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	// given
+	ctx := context.Background()
+	db, err := Open(ctx, &Config{SQLitePath: filepath.Join(t.TempDir(), "date.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	require.NoError(t, Migrate(ctx, db))
+
+	// when
+	err = Migrate(ctx, db)
+
+	// then
+	require.NoError(t, err)
+	var applied int
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT count(*) FROM schema_migrations").Scan(&applied))
+	require.Equal(t, 1, applied)
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("pragmas apply to every connection", func(t *testing.T) {
+		// given
+		ctx := context.Background()
+		db, err := Open(ctx, &Config{SQLitePath: filepath.Join(t.TempDir(), "date.db")})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = db.Close()
+		})
+		db.SetMaxIdleConns(0)
+
+		for range 2 {
+			// when
+			var journalMode string
+			var busyTimeout int
+			require.NoError(t, db.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&journalMode))
+			require.NoError(t, db.QueryRowContext(ctx, "PRAGMA busy_timeout").Scan(&busyTimeout))
+
+			// then
+			require.Equal(t, "wal", journalMode)
+			require.Equal(t, 5000, busyTimeout)
+		}
+	})
+
+	t.Run("parameters of the path are kept", func(t *testing.T) {
+		// when
+		name := dsn("file:date.db?mode=ro")
+
+		// then
+		require.Equal(t, "file:date.db?mode=ro&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)", name)
+	})
+}
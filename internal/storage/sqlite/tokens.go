@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+type Tokens struct {
+	db *sql.DB
+}
+
+var (
+	_ users.TokenStore = (*Tokens)(nil)
+)
+
+func NewTokens(db *sql.DB) *Tokens {
+	return &Tokens{db: db}
+}
+
+func (t *Tokens) CreateOneTimeToken(ctx context.Context, token *users.OneTimeToken) error {
+	_, err := t.db.ExecContext(ctx, "INSERT INTO one_time_tokens (id, purpose, user_id, expires_at, created_at, "+
+		"used_at) VALUES (?, ?, ?, ?, ?, ?)", token.ID, string(token.Purpose), token.UserID, micros(token.ExpiresAt),
+		micros(token.CreatedAt), nullMicros(token.UsedAt))
+	return err
+}
+
+// UseOneTimeToken finds and marks the token in a single update so a token cannot be used twice.
+func (t *Tokens) UseOneTimeToken(ctx context.Context, ID string, purpose users.TokenPurpose, now time.Time) (*users.OneTimeToken, error) {
+	token := new(users.OneTimeToken)
+	var expiresAt, createdAt int64
+	var usedAt sql.NullInt64
+	err := t.db.QueryRowContext(ctx, "UPDATE one_time_tokens SET used_at = ?3 "+
+		"WHERE id = ?1 AND purpose = ?2 AND used_at IS NULL AND expires_at > ?3 "+
+		"RETURNING id, purpose, user_id, expires_at, created_at, used_at", ID, string(purpose), micros(now)).
+		Scan(&token.ID, &token.Purpose, &token.UserID, &expiresAt, &createdAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = users.ErrInvalidToken
+		}
+		return nil, err
+	}
+	token.ExpiresAt, token.CreatedAt, token.UsedAt = fromMicros(expiresAt), fromMicros(createdAt), fromNullMicros(usedAt)
+	return token, nil
+}
+
+func (t *Tokens) RevokeOneTimeTokens(ctx context.Context, userID int32, purpose users.TokenPurpose, now time.Time) error {
+	_, err := t.db.ExecContext(ctx, "UPDATE one_time_tokens SET used_at = ?3 "+
+		"WHERE user_id = ?1 AND purpose = ?2 AND used_at IS NULL", userID, string(purpose), micros(now))
+	return err
+}
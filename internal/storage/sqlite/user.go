@@ -0,0 +1,402 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+var errMissingLocation = errors.New("discover requires the requester location")
+
+type User struct {
+	db *sql.DB
+}
+
+var (
+	_ users.Store = (*User)(nil)
+)
+
+func NewUser(db *sql.DB) *User {
+	return &User{db: db}
+}
+
+// userColumns are the columns read by scanUser, in order.
+const userColumns = "id, email, password, name, gender, bio, age_value, dob, longitude, latitude, preferences, " +
+	"email_verified, two_factor, role, moderation, deleted_at"
+
+// row is a *sql.Row or *sql.Rows.
+type row interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row row) (*users.User, error) {
+	user := new(users.User)
+	var age *int32
+	var dob, deletedAt sql.NullInt64
+	var longitude, latitude *float64
+	var preferences *Preferences
+	var twoFactor *TwoFactor
+	var moderation *Moderation
+	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.Gender, &user.Bio, &age, &dob,
+		&longitude, &latitude, &preferences, &user.EmailVerified, &twoFactor, &user.Role, &moderation, &deletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = users.ErrUserNotFound
+		}
+		return nil, err
+	}
+	if age != nil {
+		user.Age = &users.Age{Value: *age}
+		if dob.Valid {
+			user.Age.DOB = fromMicros(dob.Int64)
+		}
+	}
+	if longitude != nil && latitude != nil {
+		user.Location = &users.Location{
+			Type:        "Point",
+			Coordinates: &users.Coordinates{Longitude: *longitude, Latitude: *latitude},
+		}
+	}
+	user.Preferences = preferences.toPreferences()
+	user.TwoFactor = twoFactor.toTwoFactor()
+	user.Moderation = moderation.toModeration()
+	user.DeletedAt = fromNullMicros(deletedAt)
+	return user, nil
+}
+
+func (u *User) CreateUser(ctx context.Context, user *users.User) (*users.User, error) {
+	var age *int32
+	var dob sql.NullInt64
+	if user.Age != nil {
+		age, dob = &user.Age.Value, nullMicros(&user.Age.DOB)
+	}
+	longitude, latitude := coordinates(user.Location)
+	err := u.db.QueryRowContext(ctx, "INSERT INTO users (email, password, name, gender, bio, age_value, dob, "+
+		"longitude, latitude, preferences, email_verified, two_factor, role, moderation, deleted_at) "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id",
+		user.Email, user.Password, user.Name, user.Gender, user.Bio, age, dob, longitude, latitude,
+		toPreferences(user.Preferences), user.EmailVerified, toTwoFactor(user.TwoFactor), string(user.Role),
+		toModeration(user.Moderation), nullMicros(user.DeletedAt)).Scan(&user.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			err = users.ErrEmailTaken
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (u *User) GetUser(ctx context.Context, ID int32) (*users.User, error) {
+	return scanUser(u.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", ID))
+}
+
+// GetRankByIDs counts the genders and sums the ages of the users in one query, the rank is computed like
+// persistence.User does from its $facet.
+func (u *User) GetRankByIDs(ctx context.Context, IDs []int32) (*users.Rank, error) {
+	if len(IDs) == 0 {
+		return nil, nil
+	}
+	q := &query{}
+	rows, err := u.db.QueryContext(ctx, "SELECT gender, count(*), coalesce(sum(age_value), 0), count(age_value) "+
+		"FROM users WHERE id IN "+list(q, IDs)+" GROUP BY gender ORDER BY count(*) DESC", q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []int64
+	var genders []string
+	var ageSum, ages int64
+	for rows.Next() {
+		var gender string
+		var count, sum, withAge int64
+		if err = rows.Scan(&gender, &count, &sum, &withAge); err != nil {
+			return nil, err
+		}
+		genders = append(genders, gender)
+		counts = append(counts, count)
+		ageSum += sum
+		ages += withAge
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(counts) == 0 {
+		return nil, nil
+	}
+
+	rank := &users.Rank{}
+	if ages > 0 {
+		rank.AvgAge = int32(float64(ageSum) / float64(ages))
+	}
+	// a tie between the two most swiped genders ranks on age only
+	if len(counts) < 2 || counts[0] != counts[1] {
+		rank.MostCommonGender = genders[0]
+	}
+	return rank, nil
+}
+
+func (u *User) GetUserByEmail(ctx context.Context, email string) (*users.User, error) {
+	return scanUser(u.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = ?", email))
+}
+
+func (u *User) UpdateUser(ctx context.Context, ID int32, update *users.UserUpdate) (*users.User, error) {
+	q := &query{}
+	set := userUpdateSet(update, q)
+	if len(set) == 0 {
+		return u.GetUser(ctx, ID)
+	}
+	stmt := "UPDATE users SET " + strings.Join(set, ", ") + " WHERE id = " + q.arg(ID) + " RETURNING " + userColumns
+	return scanUser(u.db.QueryRowContext(ctx, stmt, q.args...))
+}
+
+// UseRecoveryCode reads and rewrites the codes in one transaction, the single connection of the pool
+// serializes it with the other writes.
+func (u *User) UseRecoveryCode(ctx context.Context, ID int32, hashedCode string) error {
+	return inTx(ctx, u.db, func(tx *sql.Tx) error {
+		var twoFactor *TwoFactor
+		err := tx.QueryRowContext(ctx, "SELECT two_factor FROM users WHERE id = ?", ID).Scan(&twoFactor)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if twoFactor == nil || !slices.Contains(twoFactor.RecoveryCodes, hashedCode) {
+			return users.ErrInvalidTwoFactorCode
+		}
+		twoFactor.RecoveryCodes = slices.DeleteFunc(twoFactor.RecoveryCodes, func(code string) bool {
+			return code == hashedCode
+		})
+		_, err = tx.ExecContext(ctx, "UPDATE users SET two_factor = ? WHERE id = ?", twoFactor, ID)
+		return err
+	})
+}
+
+func (u *User) UseTOTPStep(ctx context.Context, ID int32, step int64) error {
+	result, err := u.db.ExecContext(ctx, "UPDATE users SET two_factor = json_set(two_factor, '$.lastStep', ?2) "+
+		"WHERE id = ?1 AND two_factor IS NOT NULL AND COALESCE(json_extract(two_factor, '$.lastStep'), 0) < ?2",
+		ID, step)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return users.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// Discover runs discoverQuery, the candidates are measured, sorted and paged by SQLite.
+func (u *User) Discover(ctx context.Context, filter *users.DiscoverFilter) ([]*users.Profile, *users.DiscoverCursor, error) {
+	if filter.Location == nil || filter.Location.Coordinates == nil {
+		return nil, nil, errMissingLocation
+	}
+	stmt, args := discoverQuery(filter)
+	rows, err := u.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	profiles := make([]*users.Profile, 0)
+	var positions []users.DiscoverCursor
+	for rows.Next() {
+		profile := new(users.Profile)
+		var position users.DiscoverCursor
+		err = rows.Scan(&profile.ID, &profile.Name, &profile.Gender, &profile.Age, &position.DistanceFromMe,
+			&position.GenderSort, &position.AgeSort)
+		if err != nil {
+			return nil, nil, err
+		}
+		position.ID = profile.ID
+		profile.DistanceFromMe = int32(position.DistanceFromMe)
+		profiles = append(profiles, profile)
+		positions = append(positions, position)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// one extra profile is requested to know whether there is a next page
+	var next *users.DiscoverCursor
+	if filter.Limit > 0 && len(profiles) > int(filter.Limit) {
+		profiles = profiles[:filter.Limit]
+		next = &positions[filter.Limit-1]
+	}
+	return profiles, next, nil
+}
+
+func (u *User) GetYesSwipeIDs(ctx context.Context, ID int32) ([]int32, error) {
+	return u.queryIDs(ctx, "SELECT swiped_id FROM swipes WHERE swiper_id = ? AND ok", ID)
+}
+
+// Swipe records the latest decision of ID about swipe.ID, swiping the same profile again only updates it.
+func (u *User) Swipe(ctx context.Context, ID int32, swipe *users.Swipe) error {
+	_, err := u.db.ExecContext(ctx, "INSERT INTO swipes (swiper_id, swiped_id, ok, created_at, updated_at) "+
+		"VALUES (?1, ?2, ?3, ?4, ?4) "+
+		"ON CONFLICT (swiper_id, swiped_id) DO UPDATE SET ok = excluded.ok, updated_at = excluded.updated_at",
+		ID, swipe.ID, swipe.OK, micros(time.Now()))
+	return err
+}
+
+func (u *User) GetSwipes(ctx context.Context, ID int32) ([]*users.SwipeRecord, error) {
+	rows, err := u.db.QueryContext(ctx, "SELECT swiped_id, ok, created_at, updated_at FROM swipes "+
+		"WHERE swiper_id = ? ORDER BY created_at, swiped_id", ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	swipes := make([]*users.SwipeRecord, 0)
+	for rows.Next() {
+		swipe := new(users.SwipeRecord)
+		var createdAt, updatedAt int64
+		if err = rows.Scan(&swipe.SwipedID, &swipe.OK, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		swipe.CreatedAt, swipe.UpdatedAt = fromMicros(createdAt), fromMicros(updatedAt)
+		swipes = append(swipes, swipe)
+	}
+	return swipes, rows.Err()
+}
+
+func (u *User) Match(ctx context.Context, ID, swipedID int32) (bool, error) {
+	var matched bool
+	err := u.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM swipes WHERE swiper_id = ? AND swiped_id = ? AND ok)",
+		swipedID, ID).Scan(&matched)
+	return matched, err
+}
+
+// CreateMatch stores the match unless it already exists, in which case the stored match is returned.
+func (u *User) CreateMatch(ctx context.Context, match *users.Match) (*users.Match, error) {
+	if len(match.UserIDs) != 2 {
+		return nil, fmt.Errorf("a match is between 2 users, got %d", len(match.UserIDs))
+	}
+	_, err := u.db.ExecContext(ctx, "INSERT INTO matches (id, user_id1, user_id2, created_at) VALUES (?, ?, ?, ?) "+
+		"ON CONFLICT (id) DO NOTHING", match.ID, match.UserIDs[0], match.UserIDs[1], micros(match.CreatedAt))
+	if err != nil {
+		return nil, err
+	}
+	return u.GetMatch(ctx, match.ID)
+}
+
+func (u *User) GetMatch(ctx context.Context, matchID string) (*users.Match, error) {
+	match := &users.Match{UserIDs: make([]int32, 2)}
+	var createdAt int64
+	err := u.db.QueryRowContext(ctx, "SELECT id, user_id1, user_id2, created_at FROM matches WHERE id = ?", matchID).
+		Scan(&match.ID, &match.UserIDs[0], &match.UserIDs[1], &createdAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = users.ErrMatchNotFound
+		}
+		return nil, err
+	}
+	match.CreatedAt = fromMicros(createdAt)
+	return match, nil
+}
+
+func (u *User) GetMatches(ctx context.Context, ID, limit int32, after *users.MatchesCursor) ([]*users.Match, *users.MatchesCursor, error) {
+	stmt, args := matchesQuery(ID, limit, after)
+	rows, err := u.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	matches := make([]*users.Match, 0)
+	for rows.Next() {
+		match := &users.Match{UserIDs: make([]int32, 2), Profile: new(users.Profile)}
+		var createdAt int64
+		err = rows.Scan(&match.ID, &match.UserIDs[0], &match.UserIDs[1], &createdAt,
+			&match.Profile.ID, &match.Profile.Name, &match.Profile.Gender, &match.Profile.Age)
+		if err != nil {
+			return nil, nil, err
+		}
+		match.CreatedAt = fromMicros(createdAt)
+		matches = append(matches, match)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *users.MatchesCursor
+	if limit > 0 && len(matches) > int(limit) {
+		matches = matches[:limit]
+		last := matches[len(matches)-1]
+		next = &users.MatchesCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	return matches, next, nil
+}
+
+// Unmatch records the unmatch event and deletes the match in one transaction.
+func (u *User) Unmatch(ctx context.Context, unmatch *users.Unmatch) error {
+	if len(unmatch.UserIDs) != 2 {
+		return fmt.Errorf("an unmatch is between 2 users, got %d", len(unmatch.UserIDs))
+	}
+	return inTx(ctx, u.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO unmatches (match_id, user_id1, user_id2, initiator_id, created_at) "+
+			"VALUES (?, ?, ?, ?, ?)", unmatch.MatchID, unmatch.UserIDs[0], unmatch.UserIDs[1], unmatch.InitiatorID,
+			micros(unmatch.CreatedAt))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM matches WHERE id = ?", unmatch.MatchID)
+		return err
+	})
+}
+
+func (u *User) GetUnmatchedIDs(ctx context.Context, ID int32) ([]int32, error) {
+	return u.queryIDs(ctx, "SELECT user_id2 FROM unmatches WHERE user_id1 = ?1 "+
+		"UNION ALL SELECT user_id1 FROM unmatches WHERE user_id2 = ?1", ID)
+}
+
+func (u *User) GetDeletedUserIDs(ctx context.Context, deletedBefore time.Time) ([]int32, error) {
+	return u.queryIDs(ctx, "SELECT id FROM users WHERE deleted_at < ?", micros(deletedBefore))
+}
+
+// PurgeUser deletes the user and everything linked to them in one transaction.
+func (u *User) PurgeUser(ctx context.Context, ID int32) error {
+	return inTx(ctx, u.db, func(tx *sql.Tx) error {
+		for _, stmt := range []string{
+			"DELETE FROM swipes WHERE swiper_id = ?1 OR swiped_id = ?1",
+			"DELETE FROM matches WHERE user_id1 = ?1 OR user_id2 = ?1",
+			"DELETE FROM unmatches WHERE user_id1 = ?1 OR user_id2 = ?1",
+			"DELETE FROM blocks WHERE blocker_id = ?1 OR blocked_id = ?1",
+			"DELETE FROM reports WHERE reporter_id = ?1 OR reported_id = ?1",
+			"DELETE FROM moderations WHERE user_id = ?1",
+			"DELETE FROM refresh_tokens WHERE user_id = ?1",
+			"DELETE FROM one_time_tokens WHERE user_id = ?1",
+			"DELETE FROM users WHERE id = ?1",
+		} {
+			if _, err := tx.ExecContext(ctx, stmt, ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (u *User) queryIDs(ctx context.Context, stmt string, args ...any) ([]int32, error) {
+	rows, err := u.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	IDs := make([]int32, 0)
+	for rows.Next() {
+		var ID int32
+		if err = rows.Scan(&ID); err != nil {
+			return nil, err
+		}
+		IDs = append(IDs, ID)
+	}
+	return IDs, rows.Err()
+}
@@ -0,0 +1,191 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/storage/storetest"
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUser_Discover(t *testing.T) {
+	ctx := context.Background()
+	store := newTestDB(t).User
+	requester, err := store.CreateUser(ctx, storetest.NewUser("me", "male", 30, 0))
+	require.NoError(t, err)
+	far, err := store.CreateUser(ctx, storetest.NewUser("far", "female", 30, 1))
+	require.NoError(t, err)
+	near, err := store.CreateUser(ctx, storetest.NewUser("near", "male", 45, 0.1))
+	require.NoError(t, err)
+	filter := &users.DiscoverFilter{ID: requester.ID, Location: requester.Location, RequesterGender: "male",
+		RequesterAge: 30}
+
+	t.Run("max distance only keeps the profiles within it", func(t *testing.T) {
+		// given
+		within := *filter
+		within.MaxDistance = 50_000
+
+		// when
+		profiles, _, err := store.Discover(ctx, &within)
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, profiles, 1)
+		require.Equal(t, near.ID, profiles[0].ID)
+		require.InDelta(t, 11_130, profiles[0].DistanceFromMe, 20)
+	})
+
+	t.Run("saved preferences must accept the requester", func(t *testing.T) {
+		// given
+		_, err := store.UpdateUser(ctx, far.ID, &users.UserUpdate{
+			Preferences: &users.Preferences{Genders: []string{"female"}},
+		})
+		require.NoError(t, err)
+		_, err = store.UpdateUser(ctx, near.ID, &users.UserUpdate{
+			Preferences: &users.Preferences{Genders: []string{"female", "male"}, MinAge: 25, MaxAge: 35},
+		})
+		require.NoError(t, err)
+
+		// when
+		profiles, _, err := store.Discover(ctx, filter)
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, profiles, 1)
+		require.Equal(t, near.ID, profiles[0].ID)
+	})
+
+	t.Run("banned and deleted users are hidden", func(t *testing.T) {
+		// given
+		_, err := store.Moderate(ctx, &users.Moderation{UserID: near.ID, ModeratorID: requester.ID,
+			Status: users.ModerationStatusBanned, CreatedAt: time.Now()})
+		require.NoError(t, err)
+		deletedAt := time.Now()
+		_, err = store.UpdateUser(ctx, far.ID, &users.UserUpdate{DeletedAt: &deletedAt, Preferences: &users.Preferences{}})
+		require.NoError(t, err)
+
+		// when
+		profiles, _, err := store.Discover(ctx, filter)
+
+		// then
+		require.NoError(t, err)
+		require.Empty(t, profiles)
+	})
+}
+
+func TestUser_UpdateUser(t *testing.T) {
+	ctx := context.Background()
+	store := newTestDB(t).User
+	user, err := store.CreateUser(ctx, storetest.NewUser("me", "male", 30, 0))
+	require.NoError(t, err)
+
+	// given
+	dob := time.Date(1994, 5, 17, 0, 0, 0, 0, time.UTC)
+	enabledAt := time.Now().UTC().Truncate(time.Microsecond)
+	update := &users.UserUpdate{
+		Age:         &users.Age{Value: 30, DOB: dob},
+		Location:    &users.Location{Type: "Point", Coordinates: &users.Coordinates{Longitude: -0.12, Latitude: 51.5}},
+		Preferences: &users.Preferences{Genders: []string{"female"}, MaxDistance: 50, Unit: users.Kilometers},
+		TwoFactor:   &users.TwoFactor{Secret: "secret", Enabled: true, RecoveryCodes: []string{"a"}, EnabledAt: &enabledAt},
+	}
+
+	// when
+	updated, err := store.UpdateUser(ctx, user.ID, update)
+
+	// then
+	require.NoError(t, err)
+	require.Equal(t, update.Age, updated.Age)
+	require.Equal(t, update.Location, updated.Location)
+	require.Equal(t, update.Preferences, updated.Preferences)
+	require.Equal(t, update.TwoFactor, updated.TwoFactor)
+	require.Equal(t, "me@storetest.com", updated.Email)
+}
+
+func TestUser_UseRecoveryCode(t *testing.T) {
+	ctx := context.Background()
+	store := newTestDB(t).User
+	user, err := store.CreateUser(ctx, storetest.NewUser("me", "male", 30, 0))
+	require.NoError(t, err)
+	_, err = store.UpdateUser(ctx, user.ID, &users.UserUpdate{
+		TwoFactor: &users.TwoFactor{Enabled: true, RecoveryCodes: []string{"a", "b"}},
+	})
+	require.NoError(t, err)
+
+	t.Run("code is removed once used", func(t *testing.T) {
+		// when
+		err := store.UseRecoveryCode(ctx, user.ID, "a")
+
+		// then
+		require.NoError(t, err)
+		updated, err := store.GetUser(ctx, user.ID)
+		require.NoError(t, err)
+		require.Equal(t, []string{"b"}, updated.TwoFactor.RecoveryCodes)
+	})
+
+	t.Run("used or unknown code is refused", func(t *testing.T) {
+		// when
+		err := store.UseRecoveryCode(ctx, user.ID, "a")
+
+		// then
+		require.ErrorIs(t, err, users.ErrInvalidTwoFactorCode)
+	})
+}
+
+func TestUser_GetMatches(t *testing.T) {
+	ctx := context.Background()
+	store := newTestDB(t).User
+	me, err := store.CreateUser(ctx, storetest.NewUser("me", "male", 30, 0))
+	require.NoError(t, err)
+	var others []*users.User
+	for _, name := range []string{"a", "b", "c"} {
+		other, err := store.CreateUser(ctx, storetest.NewUser(name, "female", 30, 0))
+		require.NoError(t, err)
+		others = append(others, other)
+		_, err = store.CreateMatch(ctx, &users.Match{
+			ID:        fmt.Sprintf("%d-%d", me.ID, other.ID),
+			UserIDs:   []int32{me.ID, other.ID},
+			CreatedAt: time.Now().Add(time.Duration(len(others)) * time.Minute),
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("newest first with the other user, paged", func(t *testing.T) {
+		// when
+		first, next, err := store.GetMatches(ctx, me.ID, 2, nil)
+		require.NoError(t, err)
+		second, last, err := store.GetMatches(ctx, me.ID, 2, next)
+
+		// then
+		require.NoError(t, err)
+		require.Nil(t, last)
+		require.Len(t, first, 2)
+		require.Equal(t, others[2].ID, first[0].Profile.ID)
+		require.Equal(t, others[1].ID, first[1].Profile.ID)
+		require.Len(t, second, 1)
+		require.Equal(t, others[0].ID, second[0].Profile.ID)
+	})
+
+	t.Run("unmatched and deleted users are dropped", func(t *testing.T) {
+		// given
+		err := store.Unmatch(ctx, &users.Unmatch{MatchID: fmt.Sprintf("%d-%d", me.ID, others[0].ID),
+			UserIDs: []int32{me.ID, others[0].ID}, InitiatorID: me.ID, CreatedAt: time.Now()})
+		require.NoError(t, err)
+		deletedAt := time.Now()
+		_, err = store.UpdateUser(ctx, others[1].ID, &users.UserUpdate{DeletedAt: &deletedAt})
+		require.NoError(t, err)
+
+		// when
+		matches, _, err := store.GetMatches(ctx, me.ID, 0, nil)
+		require.NoError(t, err)
+		unmatched, err := store.GetUnmatchedIDs(ctx, others[0].ID)
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, matches, 1)
+		require.Equal(t, others[2].ID, matches[0].Profile.ID)
+		require.Equal(t, []int32{me.ID}, unmatched)
+	})
+}
@@ -0,0 +1,596 @@
+// Package storetest is a conformance suite checking that every users.Store backend behaves the same.
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the conformance suite against the stores returned by newStore, it is called once per test
+// and must return an empty store.
+func Run(t *testing.T, newStore func(t *testing.T) users.Store) {
+	t.Run("CreateUser", func(t *testing.T) { testCreateUser(t, newStore(t)) })
+	t.Run("GetUserByEmail", func(t *testing.T) { testGetUserByEmail(t, newStore(t)) })
+	t.Run("Discover", func(t *testing.T) { testDiscover(t, newStore) })
+	t.Run("Swipe", func(t *testing.T) { testSwipe(t, newStore(t)) })
+	t.Run("Match", func(t *testing.T) { testMatch(t, newStore(t)) })
+	t.Run("CreateMatch", func(t *testing.T) { testCreateMatch(t, newStore(t)) })
+	t.Run("GetMatches", func(t *testing.T) { testGetMatches(t, newStore(t)) })
+	t.Run("Unmatch", func(t *testing.T) { testUnmatch(t, newStore(t)) })
+	t.Run("GetRankByIDs", func(t *testing.T) { testGetRankByIDs(t, newStore(t)) })
+	t.Run("UseTOTPStep", func(t *testing.T) { testUseTOTPStep(t, newStore(t)) })
+	t.Run("PurgeUser", func(t *testing.T) { testPurgeUser(t, newStore(t)) })
+}
+
+// newUser builds a user at latitude degrees north of the equator, a degree is about 111km.
+func NewUser(name, gender string, age int32, latitude float64) *users.User {
+	return &users.User{
+		Email:  fmt.Sprintf("%s@storetest.com", name),
+		Name:   name,
+		Gender: gender,
+		Age:    &users.Age{Value: age},
+		Location: &users.Location{
+			Type:        "Point",
+			Coordinates: &users.Coordinates{Longitude: 0, Latitude: latitude},
+		},
+		EmailVerified: true,
+	}
+}
+
+func createUser(t *testing.T, store users.Store, user *users.User) *users.User {
+	t.Helper()
+	created, err := store.CreateUser(context.Background(), user)
+	require.NoError(t, err)
+	return created
+}
+
+func profileIDs(profiles []*users.Profile) []int32 {
+	IDs := make([]int32, len(profiles))
+	for i, profile := range profiles {
+		IDs[i] = profile.ID
+	}
+	return IDs
+}
+
+func testCreateUser(t *testing.T, store users.Store) {
+	ctx := context.Background()
+
+	t.Run("assigns distinct ids", func(t *testing.T) {
+		// when
+		alice := createUser(t, store, NewUser("alice", "female", 30, 0))
+		bob := createUser(t, store, NewUser("bob", "male", 31, 0))
+
+		// then
+		require.NotZero(t, alice.ID)
+		require.NotZero(t, bob.ID)
+		require.NotEqual(t, alice.ID, bob.ID)
+	})
+
+	t.Run("stored user is returned by GetUser", func(t *testing.T) {
+		// given
+		carol := createUser(t, store, NewUser("carol", "female", 25, 1.5))
+
+		// when
+		got, err := store.GetUser(ctx, carol.ID)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, carol.ID, got.ID)
+		require.Equal(t, "carol@storetest.com", got.Email)
+		require.Equal(t, "female", got.Gender)
+		require.Equal(t, int32(25), got.Age.Value)
+		require.Equal(t, &users.Coordinates{Longitude: 0, Latitude: 1.5}, got.Location.Coordinates)
+		require.True(t, got.EmailVerified)
+	})
+
+	t.Run("duplicate email is refused", func(t *testing.T) {
+		// when
+		_, err := store.CreateUser(ctx, NewUser("alice", "female", 40, 0))
+
+		// then
+		require.ErrorIs(t, err, users.ErrEmailTaken)
+	})
+
+	t.Run("unknown user is not found", func(t *testing.T) {
+		// when
+		_, err := store.GetUser(ctx, 1_000_000)
+
+		// then
+		require.ErrorIs(t, err, users.ErrUserNotFound)
+	})
+}
+
+func testGetUserByEmail(t *testing.T, store users.Store) {
+	ctx := context.Background()
+	alice := createUser(t, store, NewUser("alice", "female", 30, 0))
+
+	t.Run("found", func(t *testing.T) {
+		// when
+		got, err := store.GetUserByEmail(ctx, "alice@storetest.com")
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, alice.ID, got.ID)
+		require.Equal(t, "alice", got.Name)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		// when
+		_, err := store.GetUserByEmail(ctx, "nobody@storetest.com")
+
+		// then
+		require.ErrorIs(t, err, users.ErrUserNotFound)
+	})
+}
+
+func testDiscover(t *testing.T, newStore func(t *testing.T) users.Store) {
+	ctx := context.Background()
+	store := newStore(t)
+	me := createUser(t, store, NewUser("me", "male", 30, 0))
+	// candidates at increasing distances, with genders and ages giving a different ranked order
+	far := createUser(t, store, NewUser("far", "female", 30, 3))
+	middle := createUser(t, store, NewUser("middle", "male", 30, 2))
+	near := createUser(t, store, NewUser("near", "female", 50, 1))
+	hidden := createUser(t, store, NewUser("hidden", "female", 30, 0.5))
+	require.NoError(t, store.Block(ctx, &users.Block{BlockerID: me.ID, BlockedID: hidden.ID, CreatedAt: time.Now()}))
+	filter := func() *users.DiscoverFilter {
+		return &users.DiscoverFilter{ID: me.ID, Location: me.Location}
+	}
+
+	t.Run("nearest first without the requester nor the hidden users", func(t *testing.T) {
+		// when
+		profiles, next, err := store.Discover(ctx, filter())
+
+		// then
+		require.NoError(t, err)
+		require.Nil(t, next)
+		require.Equal(t, []int32{near.ID, middle.ID, far.ID}, profileIDs(profiles))
+		require.InDelta(t, 111_000, profiles[0].DistanceFromMe, 1_000)
+		require.Equal(t, "near", profiles[0].Name)
+		require.Equal(t, int32(50), profiles[0].Age)
+	})
+
+	t.Run("ranked sorts on the most common gender then the closest age", func(t *testing.T) {
+		// given
+		ranked := filter()
+		ranked.Rank = &users.Rank{AvgAge: 30, MostCommonGender: "female"}
+
+		// when
+		profiles, _, err := store.Discover(ctx, ranked)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, []int32{far.ID, near.ID, middle.ID}, profileIDs(profiles))
+	})
+
+	t.Run("ranked without a most common gender sorts on age then distance", func(t *testing.T) {
+		// given
+		ranked := filter()
+		ranked.Rank = &users.Rank{AvgAge: 30}
+
+		// when
+		profiles, _, err := store.Discover(ctx, ranked)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, []int32{middle.ID, far.ID, near.ID}, profileIDs(profiles))
+	})
+
+	for _, rank := range []*users.Rank{nil, {AvgAge: 30, MostCommonGender: "female"}} {
+		t.Run(fmt.Sprintf("pages follow the sort order, ranked %t", rank != nil), func(t *testing.T) {
+			// given
+			all := filter()
+			all.Rank = rank
+			expected, _, err := store.Discover(ctx, all)
+			require.NoError(t, err)
+			paged := filter()
+			paged.Rank = rank
+			paged.Limit = 2
+
+			// when
+			first, next, err := store.Discover(ctx, paged)
+			require.NoError(t, err)
+			require.NotNil(t, next)
+			paged.After = next
+			second, last, err := store.Discover(ctx, paged)
+
+			// then
+			require.NoError(t, err)
+			require.Nil(t, last)
+			require.Len(t, first, 2)
+			require.Equal(t, profileIDs(expected), append(profileIDs(first), profileIDs(second)...))
+		})
+	}
+
+	t.Run("swiped profiles are excluded", func(t *testing.T) {
+		// given
+		store := newStore(t)
+		me := createUser(t, store, NewUser("me", "male", 30, 0))
+		liked := createUser(t, store, NewUser("liked", "female", 30, 1))
+		passed := createUser(t, store, NewUser("passed", "female", 30, 2))
+		other := createUser(t, store, NewUser("other", "female", 30, 3))
+		require.NoError(t, store.Swipe(ctx, me.ID, &users.Swipe{ID: liked.ID, OK: true}))
+		require.NoError(t, store.Swipe(ctx, me.ID, &users.Swipe{ID: passed.ID, OK: false}))
+
+		// when
+		profiles, _, err := store.Discover(ctx, &users.DiscoverFilter{ID: me.ID, Location: me.Location})
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, []int32{other.ID}, profileIDs(profiles))
+	})
+
+	t.Run("unmatched and blocked profiles are excluded both ways", func(t *testing.T) {
+		// given
+		store := newStore(t)
+		me := createUser(t, store, NewUser("me", "male", 30, 0))
+		unmatched := createUser(t, store, NewUser("unmatched", "female", 30, 1))
+		blocked := createUser(t, store, NewUser("blocked", "female", 30, 2))
+		blocking := createUser(t, store, NewUser("blocking", "female", 30, 3))
+		other := createUser(t, store, NewUser("other", "female", 30, 4))
+		now := time.Now()
+		match := users.NewMatch(me.ID, unmatched.ID, now)
+		require.NoError(t, store.Unmatch(ctx, &users.Unmatch{
+			MatchID: match.ID, UserIDs: match.UserIDs, InitiatorID: unmatched.ID, CreatedAt: now,
+		}))
+		require.NoError(t, store.Block(ctx, &users.Block{BlockerID: me.ID, BlockedID: blocked.ID, CreatedAt: now}))
+		require.NoError(t, store.Block(ctx, &users.Block{BlockerID: blocking.ID, BlockedID: me.ID, CreatedAt: now}))
+
+		// when
+		profiles, _, err := store.Discover(ctx, &users.DiscoverFilter{ID: me.ID, Location: me.Location})
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, []int32{other.ID}, profileIDs(profiles))
+	})
+
+	t.Run("suspended profiles come back once the suspension ended", func(t *testing.T) {
+		// given
+		store := newStore(t)
+		me := createUser(t, store, NewUser("me", "male", 30, 0))
+		ended := createUser(t, store, NewUser("ended", "female", 30, 1))
+		suspended := createUser(t, store, NewUser("suspended", "female", 30, 2))
+		banned := createUser(t, store, NewUser("banned", "female", 30, 3))
+		now := time.Now().UTC()
+		past, future := now.Add(-time.Hour), now.Add(time.Hour)
+		for _, m := range []*users.Moderation{
+			{UserID: ended.ID, Status: users.ModerationStatusSuspended, Reason: "spam", Until: &past, CreatedAt: now},
+			{UserID: suspended.ID, Status: users.ModerationStatusSuspended, Reason: "spam", Until: &future, CreatedAt: now},
+			{UserID: banned.ID, Status: users.ModerationStatusBanned, Reason: "spam", CreatedAt: now},
+		} {
+			_, err := store.Moderate(ctx, m)
+			require.NoError(t, err)
+		}
+
+		// when
+		profiles, _, err := store.Discover(ctx, &users.DiscoverFilter{ID: me.ID, Location: me.Location})
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, []int32{ended.ID}, profileIDs(profiles))
+	})
+}
+
+func testSwipe(t *testing.T, store users.Store) {
+	ctx := context.Background()
+	me := createUser(t, store, NewUser("me", "male", 30, 0))
+	other := createUser(t, store, NewUser("other", "female", 30, 1))
+
+	t.Run("swiping twice keeps one swipe", func(t *testing.T) {
+		// when
+		require.NoError(t, store.Swipe(ctx, me.ID, &users.Swipe{ID: other.ID, OK: true}))
+		require.NoError(t, store.Swipe(ctx, me.ID, &users.Swipe{ID: other.ID, OK: true}))
+
+		// then
+		IDs, err := store.GetYesSwipeIDs(ctx, me.ID)
+		require.NoError(t, err)
+		require.Equal(t, []int32{other.ID}, IDs)
+		swipes, err := store.GetSwipes(ctx, me.ID)
+		require.NoError(t, err)
+		require.Len(t, swipes, 1)
+	})
+
+	t.Run("swiping again updates the decision and keeps the creation date", func(t *testing.T) {
+		// given
+		before, err := store.GetSwipes(ctx, me.ID)
+		require.NoError(t, err)
+
+		// when
+		require.NoError(t, store.Swipe(ctx, me.ID, &users.Swipe{ID: other.ID, OK: false}))
+
+		// then
+		IDs, err := store.GetYesSwipeIDs(ctx, me.ID)
+		require.NoError(t, err)
+		require.Empty(t, IDs)
+		swipes, err := store.GetSwipes(ctx, me.ID)
+		require.NoError(t, err)
+		require.Len(t, swipes, 1)
+		require.False(t, swipes[0].OK)
+		require.Equal(t, other.ID, swipes[0].SwipedID)
+		require.True(t, swipes[0].CreatedAt.Equal(before[0].CreatedAt))
+		require.False(t, swipes[0].UpdatedAt.Before(swipes[0].CreatedAt))
+	})
+}
+
+func testMatch(t *testing.T, store users.Store) {
+	ctx := context.Background()
+	me := createUser(t, store, NewUser("me", "male", 30, 0))
+	liker := createUser(t, store, NewUser("liker", "female", 30, 1))
+	passer := createUser(t, store, NewUser("passer", "female", 30, 2))
+	stranger := createUser(t, store, NewUser("stranger", "female", 30, 3))
+	require.NoError(t, store.Swipe(ctx, liker.ID, &users.Swipe{ID: me.ID, OK: true}))
+	require.NoError(t, store.Swipe(ctx, passer.ID, &users.Swipe{ID: me.ID, OK: false}))
+
+	tests := []struct {
+		name     string
+		ID       int32
+		swipedID int32
+		expected bool
+	}{
+		{name: "the swiped user said yes", ID: me.ID, swipedID: liker.ID, expected: true},
+		{name: "the swiped user said no", ID: me.ID, swipedID: passer.ID, expected: false},
+		{name: "the swiped user did not swipe", ID: me.ID, swipedID: stranger.ID, expected: false},
+		{name: "only the swipe of the swiped user counts", ID: liker.ID, swipedID: me.ID, expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			matched, err := store.Match(ctx, tt.ID, tt.swipedID)
+
+			// then
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, matched)
+		})
+	}
+}
+
+func matchIDs(matches []*users.Match) []string {
+	IDs := make([]string, len(matches))
+	for i, match := range matches {
+		IDs[i] = match.ID
+	}
+	return IDs
+}
+
+func testCreateMatch(t *testing.T, store users.Store) {
+	ctx := context.Background()
+	me := createUser(t, store, NewUser("me", "male", 30, 0))
+	other := createUser(t, store, NewUser("other", "female", 30, 1))
+	createdAt := time.Now().UTC().Truncate(time.Millisecond)
+	first, err := store.CreateMatch(ctx, users.NewMatch(me.ID, other.ID, createdAt))
+	require.NoError(t, err)
+
+	t.Run("creating the match again returns the stored one", func(t *testing.T) {
+		// when
+		again, err := store.CreateMatch(ctx, users.NewMatch(other.ID, me.ID, createdAt.Add(time.Minute)))
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, first.ID, again.ID)
+		require.ElementsMatch(t, []int32{me.ID, other.ID}, again.UserIDs)
+		require.True(t, again.CreatedAt.Equal(createdAt))
+		matches, _, err := store.GetMatches(ctx, me.ID, 0, nil)
+		require.NoError(t, err)
+		require.Len(t, matches, 1)
+	})
+
+	t.Run("stored match is returned by GetMatch", func(t *testing.T) {
+		// when
+		got, err := store.GetMatch(ctx, first.ID)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, first.ID, got.ID)
+		require.True(t, got.CreatedAt.Equal(createdAt))
+	})
+}
+
+func testGetMatches(t *testing.T, store users.Store) {
+	ctx := context.Background()
+
+	t.Run("newest first with the profile of the other user", func(t *testing.T) {
+		// given
+		me := createUser(t, store, NewUser("listed", "male", 30, 0))
+		older := createUser(t, store, NewUser("earlier", "female", 25, 1))
+		newer := createUser(t, store, NewUser("later", "female", 35, 2))
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		_, err := store.CreateMatch(ctx, users.NewMatch(me.ID, older.ID, now.Add(-time.Minute)))
+		require.NoError(t, err)
+		_, err = store.CreateMatch(ctx, users.NewMatch(newer.ID, me.ID, now))
+		require.NoError(t, err)
+
+		// when
+		matches, next, err := store.GetMatches(ctx, me.ID, 0, nil)
+
+		// then
+		require.NoError(t, err)
+		require.Nil(t, next)
+		require.Len(t, matches, 2)
+		require.Equal(t, &users.Profile{ID: newer.ID, Name: "later", Gender: "female", Age: 35}, matches[0].Profile)
+		require.Equal(t, older.ID, matches[1].Profile.ID)
+	})
+
+	t.Run("paging skips a deleted partner without losing the next cursor", func(t *testing.T) {
+		// given
+		me := createUser(t, store, NewUser("paged", "male", 30, 0))
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		var matches []*users.Match
+		for i, name := range []string{"newest", "deleted", "older", "oldest"} {
+			partner := createUser(t, store, NewUser(name, "female", 30, 1))
+			match, err := store.CreateMatch(ctx, users.NewMatch(me.ID, partner.ID, now.Add(-time.Duration(i)*time.Minute)))
+			require.NoError(t, err)
+			matches = append(matches, match)
+			if name == "deleted" {
+				_, err = store.UpdateUser(ctx, partner.ID, &users.UserUpdate{DeletedAt: &now})
+				require.NoError(t, err)
+			}
+		}
+
+		// when
+		first, next, err := store.GetMatches(ctx, me.ID, 2, nil)
+		require.NoError(t, err)
+		require.NotNil(t, next)
+		second, last, err := store.GetMatches(ctx, me.ID, 2, next)
+
+		// then
+		require.NoError(t, err)
+		require.Nil(t, last)
+		require.Equal(t, []string{matches[0].ID, matches[2].ID}, matchIDs(first))
+		require.Equal(t, []string{matches[3].ID}, matchIDs(second))
+	})
+}
+
+func testUnmatch(t *testing.T, store users.Store) {
+	ctx := context.Background()
+	me := createUser(t, store, NewUser("me", "male", 30, 0))
+	other := createUser(t, store, NewUser("other", "female", 30, 1))
+	stranger := createUser(t, store, NewUser("stranger", "female", 30, 2))
+	now := time.Now().UTC()
+	match, err := store.CreateMatch(ctx, users.NewMatch(me.ID, other.ID, now))
+	require.NoError(t, err)
+
+	// when
+	err = store.Unmatch(ctx, &users.Unmatch{MatchID: match.ID, UserIDs: match.UserIDs, InitiatorID: me.ID, CreatedAt: now})
+
+	// then
+	require.NoError(t, err)
+	_, err = store.GetMatch(ctx, match.ID)
+	require.ErrorIs(t, err, users.ErrMatchNotFound)
+	matches, _, err := store.GetMatches(ctx, me.ID, 0, nil)
+	require.NoError(t, err)
+	require.Empty(t, matches)
+	unmatched, err := store.GetUnmatchedIDs(ctx, me.ID)
+	require.NoError(t, err)
+	require.Equal(t, []int32{other.ID}, unmatched)
+	unmatched, err = store.GetUnmatchedIDs(ctx, other.ID)
+	require.NoError(t, err)
+	require.Equal(t, []int32{me.ID}, unmatched)
+	unmatched, err = store.GetUnmatchedIDs(ctx, stranger.ID)
+	require.NoError(t, err)
+	require.Empty(t, unmatched)
+}
+
+func testGetRankByIDs(t *testing.T, store users.Store) {
+	ctx := context.Background()
+	var IDs []int32
+	for i, u := range []struct {
+		gender string
+		age    int32
+	}{{"female", 20}, {"female", 30}, {"male", 28}} {
+		IDs = append(IDs, createUser(t, store, NewUser(fmt.Sprintf("ranked%d", i), u.gender, u.age, 0)).ID)
+	}
+
+	t.Run("average age and most common gender", func(t *testing.T) {
+		// when
+		rank, err := store.GetRankByIDs(ctx, IDs)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, &users.Rank{AvgAge: 26, MostCommonGender: "female"}, rank)
+	})
+
+	t.Run("a tie has no most common gender", func(t *testing.T) {
+		// when
+		rank, err := store.GetRankByIDs(ctx, IDs[1:])
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, &users.Rank{AvgAge: 29}, rank)
+	})
+
+	t.Run("unknown users have no rank", func(t *testing.T) {
+		// when
+		rank, err := store.GetRankByIDs(ctx, []int32{1_000_000})
+
+		// then
+		require.NoError(t, err)
+		require.Nil(t, rank)
+	})
+}
+
+func testUseTOTPStep(t *testing.T, store users.Store) {
+	ctx := context.Background()
+	user := NewUser("totp", "female", 30, 0)
+	user.TwoFactor = &users.TwoFactor{Secret: "secret", Enabled: true, RecoveryCodes: []string{"a"}}
+	user = createUser(t, store, user)
+	withoutTwoFactor := createUser(t, store, NewUser("plain", "male", 30, 0))
+
+	t.Run("a later step is accepted once", func(t *testing.T) {
+		// when
+		err := store.UseTOTPStep(ctx, user.ID, 100)
+
+		// then
+		require.NoError(t, err)
+		require.ErrorIs(t, store.UseTOTPStep(ctx, user.ID, 100), users.ErrInvalidTwoFactorCode)
+		stored, err := store.GetUser(ctx, user.ID)
+		require.NoError(t, err)
+		require.Equal(t, int64(100), stored.TwoFactor.LastStep)
+		require.Equal(t, []string{"a"}, stored.TwoFactor.RecoveryCodes)
+	})
+
+	t.Run("an earlier step is refused", func(t *testing.T) {
+		// when
+		err := store.UseTOTPStep(ctx, user.ID, 99)
+
+		// then
+		require.ErrorIs(t, err, users.ErrInvalidTwoFactorCode)
+		require.NoError(t, store.UseTOTPStep(ctx, user.ID, 101))
+	})
+
+	t.Run("a user without two factor is refused", func(t *testing.T) {
+		// when
+		err := store.UseTOTPStep(ctx, withoutTwoFactor.ID, 1)
+
+		// then
+		require.ErrorIs(t, err, users.ErrInvalidTwoFactorCode)
+	})
+}
+
+func testPurgeUser(t *testing.T, store users.Store) {
+	ctx := context.Background()
+	me := createUser(t, store, NewUser("purged", "male", 30, 0))
+	other := createUser(t, store, NewUser("kept", "female", 30, 1))
+	require.NoError(t, store.Swipe(ctx, me.ID, &users.Swipe{ID: other.ID, OK: true}))
+	require.NoError(t, store.Swipe(ctx, other.ID, &users.Swipe{ID: me.ID, OK: true}))
+	_, err := store.CreateMatch(ctx, users.NewMatch(me.ID, other.ID, time.Now().UTC()))
+	require.NoError(t, err)
+	for _, report := range []*users.Report{
+		{ReporterID: me.ID, ReportedID: other.ID, Reason: users.ReportReasonSpam, Status: users.ReportStatusOpen},
+		{ReporterID: other.ID, ReportedID: me.ID, Reason: users.ReportReasonSpam, Status: users.ReportStatusOpen},
+	} {
+		report.CreatedAt = time.Now().UTC()
+		_, err = store.CreateReport(ctx, report)
+		require.NoError(t, err)
+	}
+	_, err = store.Moderate(ctx, &users.Moderation{
+		UserID: me.ID, Status: users.ModerationStatusBanned, Reason: "spam", CreatedAt: time.Now().UTC(),
+	})
+	require.NoError(t, err)
+
+	// when
+	err = store.PurgeUser(ctx, me.ID)
+
+	// then
+	require.NoError(t, err)
+	_, err = store.GetUser(ctx, me.ID)
+	require.ErrorIs(t, err, users.ErrUserNotFound)
+	swipes, err := store.GetSwipes(ctx, other.ID)
+	require.NoError(t, err)
+	require.Empty(t, swipes)
+	matches, _, err := store.GetMatches(ctx, other.ID, 0, nil)
+	require.NoError(t, err)
+	require.Empty(t, matches)
+	reports, _, err := store.ListReports(ctx, &users.ReportFilter{})
+	require.NoError(t, err)
+	require.Empty(t, reports)
+	moderations, err := store.GetModerations(ctx, me.ID)
+	require.NoError(t, err)
+	require.Empty(t, moderations)
+	_, err = store.GetUser(ctx, other.ID)
+	require.NoError(t, err)
+}
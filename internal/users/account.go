@@ -0,0 +1,245 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/mailer"
+	"github.com/muzzapp/date-api/internal/securetoken"
+)
+
+type AccountConfig struct {
+	PasswordResetTTL time.Duration `envconfig:"PASSWORD_RESET_TTL" default:"1h"`
+	// PasswordResetURL is the client page resetting a password, the token is appended to it
+	PasswordResetURL string `envconfig:"PASSWORD_RESET_URL"`
+
+	EmailVerificationTTL time.Duration `envconfig:"EMAIL_VERIFICATION_TTL" default:"48h"`
+	// EmailVerificationURL is the client page verifying an email, the token is appended to it
+	EmailVerificationURL string `envconfig:"EMAIL_VERIFICATION_URL"`
+	// UnverifiedLogin lets the users who did not verify their email log in
+	UnverifiedLogin bool `envconfig:"UNVERIFIED_LOGIN" default:"true"`
+	// UnverifiedDiscover shows the users who did not verify their email in discover
+	UnverifiedDiscover bool `envconfig:"UNVERIFIED_DISCOVER" default:"true"`
+}
+
+type TokenPurpose string
+
+const (
+	TokenPurposePasswordReset     TokenPurpose = "password_reset"
+	TokenPurposeEmailVerification TokenPurpose = "email_verification"
+)
+
+// OneTimeToken is an expiring single use token mailed to a user, only its hash is stored.
+type OneTimeToken struct {
+	ID        string       `bson:"_id"`
+	Purpose   TokenPurpose `bson:"purpose"`
+	UserID    int32        `bson:"userID"`
+	ExpiresAt time.Time    `bson:"expiresAt"`
+	CreatedAt time.Time    `bson:"createdAt"`
+	UsedAt    *time.Time   `bson:"usedAt,omitempty"`
+}
+
+// WithAccountRecovery enables the flows mailing one time tokens to the users.
+func WithAccountRecovery(tokens TokenStore, mailer Mailer, conf *AccountConfig) Option {
+	return func(s *Service) {
+		s.tokens = tokens
+		s.mailer = mailer
+		s.account = conf
+	}
+}
+
+// backgroundTimeout bounds the work started by a request once it returned.
+const backgroundTimeout = time.Minute
+
+// ForgotPassword mails a password reset token to the user of email. The token is created and mailed in the
+// background and unknown emails or failures are only logged, so the answer neither tells which emails are
+// registered nor takes longer for them.
+func (s *Service) ForgotPassword(ctx context.Context, email string) error {
+	if err := s.accountRecoveryErr(); err != nil {
+		return err
+	}
+	email = normalizeEmail(email)
+	user, err := s.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("ForgotPassword GetUserByEmail", "email", email, "err", err)
+		}
+		return nil
+	}
+
+	s.inBackground(func(ctx context.Context) {
+		if err := s.sendPasswordReset(ctx, user); err != nil {
+			slog.Error("ForgotPassword sendPasswordReset", "ID", user.ID, "err", err)
+		}
+	})
+	return nil
+}
+
+func (s *Service) sendPasswordReset(ctx context.Context, user *User) error {
+	token, err := createOneTimeToken(ctx, s.tokens, user.ID, TokenPurposePasswordReset, s.account.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	message := &mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this link to choose a new password, it expires in %s:\n%s%s\n\n"+
+			"If you did not ask for it, ignore this email.", user.Name, s.account.PasswordResetTTL,
+			s.account.PasswordResetURL, token),
+	}
+	return s.mailer.Send(ctx, message)
+}
+
+// inBackground runs f once the request returned, Wait blocks until it is done.
+func (s *Service) inBackground(f func(ctx context.Context)) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundTimeout)
+		defer cancel()
+		f(ctx)
+	}()
+}
+
+// Wait blocks until the work left running by the requests, like sending mails, is done.
+func (s *Service) Wait() {
+	s.background.Wait()
+}
+
+// ResetPassword sets the password of the user of a reset token, the token and the other reset tokens of the
+// user cannot be used again. It returns the user ID so their sessions can be revoked.
+func (s *Service) ResetPassword(ctx context.Context, token, password string) (int32, error) {
+	if err := s.accountRecoveryErr(); err != nil {
+		return 0, err
+	}
+	errs := ValidationError{}
+	validatePassword(password, errs)
+	if err := errs.errOrNil(); err != nil {
+		return 0, err
+	}
+	resetToken, err := s.tokens.UseOneTimeToken(ctx, securetoken.Hash(token), TokenPurposePasswordReset, time.Now().UTC())
+	if err != nil {
+		if !errors.Is(err, ErrInvalidToken) {
+			slog.Error("ResetPassword UseOneTimeToken", "err", err)
+		}
+		return 0, err
+	}
+
+	hashed := hashPassword(password)
+	if hashed == "" {
+		return 0, ErrHashPassword
+	}
+	if _, err = s.store.UpdateUser(ctx, resetToken.UserID, &UserUpdate{Password: &hashed}); err != nil {
+		slog.Error("ResetPassword UpdateUser", "ID", resetToken.UserID, "err", err)
+		return 0, err
+	}
+	err = s.tokens.RevokeOneTimeTokens(ctx, resetToken.UserID, TokenPurposePasswordReset, time.Now().UTC())
+	if err != nil {
+		slog.Error("ResetPassword RevokeOneTimeTokens", "ID", resetToken.UserID, "err", err)
+		return 0, err
+	}
+	return resetToken.UserID, nil
+}
+
+// VerifyEmail marks the email of the user of a verification token as verified.
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	if err := s.accountRecoveryErr(); err != nil {
+		return err
+	}
+	verificationToken, err := s.tokens.UseOneTimeToken(ctx, securetoken.Hash(token), TokenPurposeEmailVerification, time.Now().UTC())
+	if err != nil {
+		if !errors.Is(err, ErrInvalidToken) {
+			slog.Error("VerifyEmail UseOneTimeToken", "err", err)
+		}
+		return err
+	}
+
+	verified := true
+	if _, err = s.store.UpdateUser(ctx, verificationToken.UserID, &UserUpdate{EmailVerified: &verified}); err != nil {
+		slog.Error("VerifyEmail UpdateUser", "ID", verificationToken.UserID, "err", err)
+		return err
+	}
+	return nil
+}
+
+// ResendEmailVerification mails a new verification token, the previous ones stay valid until they expire.
+// Like in ForgotPassword the user is looked up and mailed in the background, unknown and already verified emails
+// or failures are only logged, so the answer neither tells which emails are registered nor takes longer for them.
+func (s *Service) ResendEmailVerification(_ context.Context, email string) error {
+	if err := s.accountRecoveryErr(); err != nil {
+		return err
+	}
+	email = normalizeEmail(email)
+	s.inBackground(func(ctx context.Context) {
+		user, err := s.store.GetUserByEmail(ctx, email)
+		if err != nil {
+			if !errors.Is(err, ErrUserNotFound) {
+				slog.Error("ResendEmailVerification GetUserByEmail", "email", email, "err", err)
+			}
+			return
+		}
+		if user.EmailVerified {
+			return
+		}
+		if err = s.sendEmailVerification(ctx, user); err != nil {
+			slog.Error("ResendEmailVerification sendEmailVerification", "ID", user.ID, "err", err)
+		}
+	})
+	return nil
+}
+
+func (s *Service) sendEmailVerification(ctx context.Context, user *User) error {
+	token, err := createOneTimeToken(ctx, s.tokens, user.ID, TokenPurposeEmailVerification, s.account.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	message := &mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this link to verify your email, it expires in %s:\n%s%s",
+			user.Name, s.account.EmailVerificationTTL, s.account.EmailVerificationURL, token),
+	}
+	return s.mailer.Send(ctx, message)
+}
+
+// accountRecoveryErr tells whether the mailed token flows are enabled, their tokens and mailer are set together.
+func (s *Service) accountRecoveryErr() error {
+	if s.account == nil {
+		return ErrAccountRecoveryDisabled
+	}
+	return nil
+}
+
+// verificationErr rejects the unverified users when they may not log in.
+func (s *Service) verificationErr(user *User) error {
+	if user.EmailVerified || s.account == nil || s.account.UnverifiedLogin {
+		return nil
+	}
+	return ErrEmailNotVerified
+}
+
+func (s *Service) unverifiedDiscoverable() bool {
+	return s.account == nil || s.account.UnverifiedDiscover
+}
+
+func createOneTimeToken(ctx context.Context, tokens TokenStore, ID int32, purpose TokenPurpose, ttl time.Duration) (string, error) {
+	token, err := securetoken.New()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	oneTimeToken := &OneTimeToken{
+		ID:        securetoken.Hash(token),
+		Purpose:   purpose,
+		UserID:    ID,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err = tokens.CreateOneTimeToken(ctx, oneTimeToken); err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,303 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/muzzapp/date-api/internal/mailer"
+	"github.com/muzzapp/date-api/internal/securetoken"
+)
+
+func TestService_ForgotPassword(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	tokens := NewMockTokenStore(controller)
+	mail := NewMockMailer(controller)
+	conf := &AccountConfig{PasswordResetTTL: time.Hour, PasswordResetURL: "https://date.app/reset?token="}
+	userService := NewService(nil, store, WithAccountRecovery(tokens, mail, conf))
+	ctx := context.Background()
+
+	t.Run("unknown email is ignored", func(t *testing.T) {
+		// given
+		store.EXPECT().GetUserByEmail(ctx, "nobody@date.app").Return(nil, ErrUserNotFound)
+
+		// when
+		err := userService.ForgotPassword(ctx, "Nobody@Date.app")
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("store failure is not told apart from an unknown email", func(t *testing.T) {
+		// given
+		store.EXPECT().GetUserByEmail(ctx, "jane@date.app").Return(nil, errors.New("timeout"))
+
+		// when
+		err := userService.ForgotPassword(ctx, "jane@date.app")
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("stores the hashed token and mails the token in the background", func(t *testing.T) {
+		// given
+		user := &User{ID: 7, Name: "Jane", Email: "jane@date.app"}
+		store.EXPECT().GetUserByEmail(ctx, user.Email).Return(user, nil)
+		var stored *OneTimeToken
+		tokens.EXPECT().CreateOneTimeToken(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, token *OneTimeToken) error {
+			stored = token
+			return nil
+		})
+		var sent *mailer.Message
+		mail.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, message *mailer.Message) error {
+			sent = message
+			return nil
+		})
+
+		// when
+		err := userService.ForgotPassword(ctx, user.Email)
+		userService.Wait()
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, user.ID, stored.UserID)
+		require.Equal(t, TokenPurposePasswordReset, stored.Purpose)
+		require.WithinDuration(t, stored.CreatedAt.Add(time.Hour), stored.ExpiresAt, 0)
+		require.Equal(t, user.Email, sent.To)
+		i := strings.Index(sent.Body, conf.PasswordResetURL)
+		require.NotEqual(t, -1, i)
+		token := strings.Fields(sent.Body[i+len(conf.PasswordResetURL):])[0]
+		require.NotEqual(t, token, stored.ID)
+		require.Equal(t, securetoken.Hash(token), stored.ID)
+	})
+}
+
+func TestService_ResetPassword(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	tokens := NewMockTokenStore(controller)
+	mail := NewMockMailer(controller)
+	userService := NewService(nil, store, WithAccountRecovery(tokens, mail, &AccountConfig{PasswordResetTTL: time.Hour}))
+	ctx := context.Background()
+
+	t.Run("weak password is rejected", func(t *testing.T) {
+		// when
+		_, err := userService.ResetPassword(ctx, "token", "weak")
+
+		// then
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Contains(t, validationErr, "password")
+	})
+
+	t.Run("invalid token is rejected", func(t *testing.T) {
+		// given
+		tokens.EXPECT().UseOneTimeToken(ctx, securetoken.Hash("token"), TokenPurposePasswordReset, gomock.Any()).
+			Return(nil, ErrInvalidToken)
+
+		// when
+		_, err := userService.ResetPassword(ctx, "token", "Passw0rd!")
+
+		// then
+		require.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("sets the hashed password", func(t *testing.T) {
+		// given
+		tokens.EXPECT().UseOneTimeToken(ctx, securetoken.Hash("token"), TokenPurposePasswordReset, gomock.Any()).
+			Return(&OneTimeToken{UserID: 7, Purpose: TokenPurposePasswordReset}, nil)
+		store.EXPECT().UpdateUser(ctx, int32(7), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ int32, update *UserUpdate) (*User, error) {
+				require.NoError(t, bcrypt.CompareHashAndPassword([]byte(*update.Password), []byte("Passw0rd!")))
+				return &User{ID: 7}, nil
+			})
+		tokens.EXPECT().RevokeOneTimeTokens(ctx, int32(7), TokenPurposePasswordReset, gomock.Any()).Return(nil)
+
+		// when
+		ID, err := userService.ResetPassword(ctx, "token", "Passw0rd!")
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, int32(7), ID)
+	})
+}
+
+func TestService_AccountRecoveryDisabled(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	userService := NewService(nil, NewMockStore(controller))
+	ctx := context.Background()
+
+	// when
+	forgotErr := userService.ForgotPassword(ctx, "jane@date.app")
+	_, resetErr := userService.ResetPassword(ctx, "token", "Passw0rd!")
+	verifyErr := userService.VerifyEmail(ctx, "token")
+	resendErr := userService.ResendEmailVerification(ctx, "jane@date.app")
+
+	// then
+	require.ErrorIs(t, forgotErr, ErrAccountRecoveryDisabled)
+	require.ErrorIs(t, resetErr, ErrAccountRecoveryDisabled)
+	require.ErrorIs(t, verifyErr, ErrAccountRecoveryDisabled)
+	require.ErrorIs(t, resendErr, ErrAccountRecoveryDisabled)
+}
+
+func TestService_VerifyEmail(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	tokens := NewMockTokenStore(controller)
+	mail := NewMockMailer(controller)
+	conf := &AccountConfig{EmailVerificationTTL: 48 * time.Hour, EmailVerificationURL: "https://date.app/verify?token="}
+	userService := NewService(nil, store, WithAccountRecovery(tokens, mail, conf))
+	ctx := context.Background()
+
+	t.Run("registration mails a verification token", func(t *testing.T) {
+		// given
+		r := &Registration{
+			Email:    "jane@date.app",
+			Password: "Sup3rSecret",
+			Name:     "Jane",
+			Gender:   "female",
+			DOB:      time.Now().AddDate(-30, 0, 0),
+			Location: &Coordinates{Longitude: -0.12, Latitude: 51.5},
+		}
+		store.EXPECT().GetUserByEmail(ctx, r.Email).Return(nil, ErrUserNotFound)
+		store.EXPECT().CreateUser(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, u *User) (*User, error) {
+			require.False(t, u.EmailVerified)
+			u.ID = 7
+			return u, nil
+		})
+		var stored *OneTimeToken
+		tokens.EXPECT().CreateOneTimeToken(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, token *OneTimeToken) error {
+			stored = token
+			return nil
+		})
+		var sent *mailer.Message
+		mail.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, message *mailer.Message) error {
+			sent = message
+			return nil
+		})
+
+		// when
+		_, err := userService.Register(ctx, r)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, int32(7), stored.UserID)
+		require.Equal(t, TokenPurposeEmailVerification, stored.Purpose)
+		require.Equal(t, r.Email, sent.To)
+		i := strings.Index(sent.Body, conf.EmailVerificationURL)
+		require.NotEqual(t, -1, i)
+		require.Equal(t, stored.ID, securetoken.Hash(strings.Fields(sent.Body[i+len(conf.EmailVerificationURL):])[0]))
+	})
+
+	t.Run("invalid token is rejected", func(t *testing.T) {
+		// given
+		tokens.EXPECT().UseOneTimeToken(ctx, securetoken.Hash("token"), TokenPurposeEmailVerification, gomock.Any()).
+			Return(nil, ErrInvalidToken)
+
+		// when
+		err := userService.VerifyEmail(ctx, "token")
+
+		// then
+		require.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("marks the email as verified", func(t *testing.T) {
+		// given
+		verified := true
+		tokens.EXPECT().UseOneTimeToken(ctx, securetoken.Hash("token"), TokenPurposeEmailVerification, gomock.Any()).
+			Return(&OneTimeToken{UserID: 7, Purpose: TokenPurposeEmailVerification}, nil)
+		store.EXPECT().UpdateUser(ctx, int32(7), &UserUpdate{EmailVerified: &verified}).Return(&User{ID: 7}, nil)
+
+		// when
+		err := userService.VerifyEmail(ctx, "token")
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("already verified email is not mailed again", func(t *testing.T) {
+		// given
+		store.EXPECT().GetUserByEmail(gomock.Any(), "jane@date.app").Return(&User{ID: 7, EmailVerified: true}, nil)
+
+		// when
+		err := userService.ResendEmailVerification(ctx, "jane@date.app")
+		userService.Wait()
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("resend failures are not told apart from an unknown email", func(t *testing.T) {
+		// given
+		user := &User{ID: 7, Email: "jane@date.app"}
+		store.EXPECT().GetUserByEmail(gomock.Any(), "nobody@date.app").Return(nil, ErrUserNotFound)
+		store.EXPECT().GetUserByEmail(gomock.Any(), user.Email).Return(user, nil)
+		tokens.EXPECT().CreateOneTimeToken(gomock.Any(), gomock.Any()).Return(nil)
+		mail.EXPECT().Send(gomock.Any(), gomock.Any()).Return(errors.New("smtp down"))
+
+		// when
+		unknownErr := userService.ResendEmailVerification(ctx, "Nobody@Date.app")
+		failedErr := userService.ResendEmailVerification(ctx, user.Email)
+		userService.Wait()
+
+		// then
+		require.NoError(t, unknownErr)
+		require.NoError(t, failedErr)
+	})
+}
+
+func TestService_LoginUnverified(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	tokens := NewMockTokenStore(controller)
+	mail := NewMockMailer(controller)
+	ctx := context.Background()
+	user := &User{ID: 7, Email: "jane@date.app", Password: hashPassword("Sup3rSecret")}
+
+	t.Run("unverified user is rejected when unverified logins are disabled", func(t *testing.T) {
+		// given
+		userService := NewService(nil, store, WithAccountRecovery(tokens, mail, &AccountConfig{}))
+		store.EXPECT().GetUserByEmail(ctx, user.Email).Return(user, nil)
+
+		// when
+		_, err := userService.Login(ctx, user.Email, "Sup3rSecret", "")
+
+		// then
+		require.ErrorIs(t, err, ErrEmailNotVerified)
+	})
+
+	t.Run("unverified user logs in when unverified logins are enabled", func(t *testing.T) {
+		// given
+		userService := NewService(nil, store, WithAccountRecovery(tokens, mail, &AccountConfig{UnverifiedLogin: true}))
+		store.EXPECT().GetUserByEmail(ctx, user.Email).Return(user, nil)
+
+		// when
+		loggedIn, err := userService.Login(ctx, user.Email, "Sup3rSecret", "")
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, user.ID, loggedIn.ID)
+	})
+}
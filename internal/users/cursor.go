@@ -0,0 +1,58 @@
+package users
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// DiscoverCursor is the keyset position of the last profile of a discover page, it holds the values of every
+// sort key so the next page can continue right after it. A ranked discover keeps the rank of its first page, the
+// sort keys would not compare if the yes swipes made in between changed it.
+type DiscoverCursor struct {
+	GenderSort     int32   `json:"g,omitempty"`
+	AgeSort        int32   `json:"a,omitempty"`
+	DistanceFromMe float64 `json:"d"`
+	ID             int32   `json:"i"`
+	// Ranked tells the rank was computed, Rank is nil when there was no yes swipe to rank with
+	Ranked bool  `json:"k,omitempty"`
+	Rank   *Rank `json:"r,omitempty"`
+}
+
+// MatchesCursor is the keyset position of the last match of a page, matches are listed newest first.
+type MatchesCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"i"`
+}
+
+// ReportsCursor is the keyset position of the last report of a page, reports are listed newest first.
+type ReportsCursor struct {
+	ID int32 `json:"i"`
+}
+
+// encodeCursor turns a cursor into the opaque token handed to clients.
+func encodeCursor[T any](cursor *T) string {
+	if cursor == nil {
+		return ""
+	}
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor[T any](token string) (*T, error) {
+	if token == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cursor := new(T)
+	if err = json.Unmarshal(data, cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
@@ -0,0 +1,133 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+type DeletionConfig struct {
+	// GracePeriod is how long a deleted account is kept before its data is erased
+	GracePeriod time.Duration `envconfig:"ACCOUNT_DELETION_GRACE_PERIOD" default:"720h"`
+	// PurgeInterval is how often the accounts past their grace period are erased
+	PurgeInterval time.Duration `envconfig:"ACCOUNT_PURGE_INTERVAL" default:"1h"`
+}
+
+// SwipeRecord is a swipe made by a user, as stored.
+type SwipeRecord struct {
+	SwipedID  int32     `bson:"swipedID"`
+	OK        bool      `bson:"ok"`
+	CreatedAt time.Time `bson:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// AccountExport is every data kept about a user, their profile, swipes, matches and the reports they filed.
+type AccountExport struct {
+	User       *User
+	Swipes     []*SwipeRecord
+	Matches    []*Match
+	Reports    []*Report
+	ExportedAt time.Time
+}
+
+// WithAccountDeletion sets how long deleted accounts are kept, PurgeDeletedAccounts erases nothing without it.
+func WithAccountDeletion(conf *DeletionConfig) Option {
+	return func(s *Service) {
+		s.deletion = conf
+	}
+}
+
+// DeleteAccount soft deletes the user, they cannot log in and are hidden from discover and matches at once,
+// their data is erased by PurgeDeletedAccounts after the grace period. Deleting twice is a no-op.
+func (s *Service) DeleteAccount(ctx context.Context, ID int32) error {
+	user, err := s.store.GetUser(ctx, ID)
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("DeleteAccount GetUser", "ID", ID, "err", err)
+		}
+		return err
+	}
+	if user.DeletedAt != nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	if _, err = s.store.UpdateUser(ctx, ID, &UserUpdate{DeletedAt: &now}); err != nil {
+		slog.Error("DeleteAccount UpdateUser", "ID", ID, "err", err)
+		return err
+	}
+	return nil
+}
+
+// PurgeDeletedAccounts erases the accounts deleted for longer than the grace period with everything linked to them.
+// It returns how many accounts were erased.
+func (s *Service) PurgeDeletedAccounts(ctx context.Context, now time.Time) (int, error) {
+	if s.deletion == nil {
+		return 0, nil
+	}
+	IDs, err := s.store.GetDeletedUserIDs(ctx, now.Add(-s.deletion.GracePeriod))
+	if err != nil {
+		slog.Error("PurgeDeletedAccounts GetDeletedUserIDs", "err", err)
+		return 0, err
+	}
+	for i, ID := range IDs {
+		if err = s.store.PurgeUser(ctx, ID); err != nil {
+			slog.Error("PurgeDeletedAccounts PurgeUser", "ID", ID, "err", err)
+			return i, err
+		}
+	}
+	return len(IDs), nil
+}
+
+// RunPurge calls PurgeDeletedAccounts on start then every PurgeInterval until ctx is done, so instances restarted
+// more often than PurgeInterval still purge.
+func (s *Service) RunPurge(ctx context.Context) {
+	if s.deletion == nil {
+		return
+	}
+	ticker := time.NewTicker(s.deletion.PurgeInterval)
+	defer ticker.Stop()
+	now := time.Now()
+	for {
+		if purged, err := s.PurgeDeletedAccounts(ctx, now.UTC()); err == nil && purged > 0 {
+			slog.Info("deleted accounts purged", "count", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+	}
+}
+
+// ExportAccount gathers the data of the user for a data portability request.
+func (s *Service) ExportAccount(ctx context.Context, ID int32) (*AccountExport, error) {
+	user, err := s.GetUser(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	swipes, err := s.store.GetSwipes(ctx, ID)
+	if err != nil {
+		slog.Error("ExportAccount GetSwipes", "ID", ID, "err", err)
+		return nil, err
+	}
+	// a zero limit returns every match
+	matches, _, err := s.store.GetMatches(ctx, ID, 0, nil)
+	if err != nil {
+		slog.Error("ExportAccount GetMatches", "ID", ID, "err", err)
+		return nil, err
+	}
+	reports, _, err := s.store.ListReports(ctx, &ReportFilter{ReporterID: ID})
+	if err != nil {
+		slog.Error("ExportAccount ListReports", "ID", ID, "err", err)
+		return nil, err
+	}
+	return &AccountExport{
+		User:       user,
+		Swipes:     swipes,
+		Matches:    matches,
+		Reports:    reports,
+		ExportedAt: time.Now().UTC(),
+	}, nil
+}
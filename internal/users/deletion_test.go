@@ -0,0 +1,129 @@
+package users
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_DeleteAccount(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	userService := NewService(nil, store, WithAccountDeletion(&DeletionConfig{GracePeriod: 24 * time.Hour}))
+	ctx := context.Background()
+
+	t.Run("soft deletes the user", func(t *testing.T) {
+		// given
+		store.EXPECT().GetUser(ctx, int32(7)).Return(&User{ID: 7}, nil)
+		store.EXPECT().UpdateUser(ctx, int32(7), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ int32, update *UserUpdate) (*User, error) {
+				require.NotNil(t, update.DeletedAt)
+				require.WithinDuration(t, time.Now(), *update.DeletedAt, time.Minute)
+				return &User{ID: 7, DeletedAt: update.DeletedAt}, nil
+			})
+
+		// when
+		err := userService.DeleteAccount(ctx, 7)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("deleting twice is a no-op", func(t *testing.T) {
+		// given
+		deletedAt := time.Now().Add(-time.Hour)
+		store.EXPECT().GetUser(ctx, int32(7)).Return(&User{ID: 7, DeletedAt: &deletedAt}, nil)
+
+		// when
+		err := userService.DeleteAccount(ctx, 7)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("deleted user cannot login", func(t *testing.T) {
+		// given
+		deletedAt := time.Now().Add(-time.Hour)
+		user := &User{ID: 7, Email: "jane@date.app", Password: hashPassword("Sup3rSecret"), DeletedAt: &deletedAt}
+		store.EXPECT().GetUserByEmail(ctx, user.Email).Return(user, nil)
+
+		// when
+		_, err := userService.Login(ctx, user.Email, "Sup3rSecret", "")
+
+		// then
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+}
+
+func TestService_PurgeDeletedAccounts(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	userService := NewService(nil, store, WithAccountDeletion(&DeletionConfig{GracePeriod: 24 * time.Hour}))
+	ctx := context.Background()
+	now := time.Date(2024, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	t.Run("erases the accounts past the grace period", func(t *testing.T) {
+		// given
+		store.EXPECT().GetDeletedUserIDs(ctx, now.Add(-24*time.Hour)).Return([]int32{3, 7}, nil)
+		store.EXPECT().PurgeUser(ctx, int32(3)).Return(nil)
+		store.EXPECT().PurgeUser(ctx, int32(7)).Return(nil)
+
+		// when
+		purged, err := userService.PurgeDeletedAccounts(ctx, now)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, 2, purged)
+	})
+
+	t.Run("nothing is erased without a deletion config", func(t *testing.T) {
+		// when
+		purged, err := NewService(nil, store).PurgeDeletedAccounts(ctx, now)
+
+		// then
+		require.NoError(t, err)
+		require.Zero(t, purged)
+	})
+}
+
+func TestService_ExportAccount(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	userService := NewService(nil, store)
+	ctx := context.Background()
+
+	t.Run("gathers the profile, swipes, matches and filed reports", func(t *testing.T) {
+		// given
+		user := &User{ID: 7, Email: "jane@date.app", Password: "hash"}
+		swipes := []*SwipeRecord{{SwipedID: 3, OK: true}}
+		matches := []*Match{{ID: "3-7", UserIDs: []int32{3, 7}}}
+		reports := []*Report{{ID: 1, ReporterID: 7, ReportedID: 4, Reason: ReportReasonSpam}}
+		store.EXPECT().GetUser(ctx, int32(7)).Return(user, nil)
+		store.EXPECT().GetSwipes(ctx, int32(7)).Return(swipes, nil)
+		store.EXPECT().GetMatches(ctx, int32(7), int32(0), nil).Return(matches, nil, nil)
+		store.EXPECT().ListReports(ctx, &ReportFilter{ReporterID: 7}).Return(reports, nil, nil)
+
+		// when
+		export, err := userService.ExportAccount(ctx, 7)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, user, export.User)
+		require.Empty(t, export.User.Password)
+		require.Equal(t, swipes, export.Swipes)
+		require.Equal(t, matches, export.Matches)
+		require.Equal(t, reports, export.Reports)
+	})
+}
@@ -0,0 +1,45 @@
+package users
+
+import "math"
+
+type DistanceUnit string
+
+const (
+	Kilometers DistanceUnit = "km"
+	Miles      DistanceUnit = "mi"
+
+	metersPerKilometer = 1000
+	metersPerMile      = 1609.344
+)
+
+func (u DistanceUnit) orDefault() DistanceUnit {
+	switch u {
+	case Kilometers, Miles:
+		return u
+	default:
+		return Kilometers
+	}
+}
+
+func (u DistanceUnit) toMeters(distance float64) float64 {
+	if u == Miles {
+		return distance * metersPerMile
+	}
+	return distance * metersPerKilometer
+}
+
+func (u DistanceUnit) fromMeters(meters float64) float64 {
+	if u == Miles {
+		return meters / metersPerMile
+	}
+	return meters / metersPerKilometer
+}
+
+// convert expresses a distance given in u in another unit.
+func (u DistanceUnit) convert(distance float64, to DistanceUnit) float64 {
+	return to.fromMeters(u.toMeters(distance))
+}
+
+func (u DistanceUnit) roundFromMeters(meters int32) int32 {
+	return int32(math.Round(u.fromMeters(float64(meters))))
+}
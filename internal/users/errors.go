@@ -1,9 +1,50 @@
 package users
 
-import "errors"
+import (
+	"errors"
+	"sort"
+	"strings"
+)
 
 var (
 	ErrInsertUser       = errors.New("db insert user error: ")
 	ErrUserNotFound     = errors.New("db user not found")
 	ErrPasswordMismatch = errors.New("db user password mismatch")
+	ErrEmailTaken       = errors.New("email already registered")
+	ErrHashPassword     = errors.New("hash password failed")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+	ErrMatchNotFound    = errors.New("db match not found")
+	ErrUserBanned       = errors.New("user banned")
+	ErrUserSuspended    = errors.New("user suspended")
+	ErrEmailNotVerified = errors.New("email not verified")
+	ErrLoginLocked      = errors.New("login locked")
+	ErrInvalidToken     = errors.New("invalid or expired token")
+	// ErrTwoFactorRequired is matched by TwoFactorRequiredError
+	ErrTwoFactorRequired    = errors.New("two factor code required")
+	ErrInvalidTwoFactorCode = errors.New("invalid two factor code")
+	ErrTwoFactorEnabled     = errors.New("two factor already enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two factor not enrolled")
+	// ErrTwoFactorDisabled is returned by the two factor flows when the service has no WithTwoFactor
+	ErrTwoFactorDisabled = errors.New("two factor disabled")
+	// ErrAccountRecoveryDisabled is returned by the mailed token flows when the service has no WithAccountRecovery
+	ErrAccountRecoveryDisabled = errors.New("account recovery disabled")
 )
+
+// ValidationError maps every invalid field of a request to the reason it was rejected.
+type ValidationError map[string]string
+
+func (v ValidationError) Error() string {
+	fields := make([]string, 0, len(v))
+	for field, reason := range v {
+		fields = append(fields, field+": "+reason)
+	}
+	sort.Strings(fields)
+	return "validation failed: " + strings.Join(fields, ", ")
+}
+
+func (v ValidationError) errOrNil() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
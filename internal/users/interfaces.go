@@ -1,6 +1,11 @@
 package users
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/mailer"
+)
 
 //go:generate mockgen -source=interfaces.go -destination=interfaces_mock.go -package=users
 
@@ -9,7 +14,54 @@ type Store interface {
 	GetUser(ctx context.Context, ID int32) (*User, error)
 	GetRankByIDs(ctx context.Context, IDs []int32) (*Rank, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
-	Discover(ctx context.Context, ID, minAge, maxAge int32, gender string, IDs []int32, location *Location, rank *Rank) ([]*Profile, error)
+	UpdateUser(ctx context.Context, ID int32, update *UserUpdate) (*User, error)
+	// UseRecoveryCode removes a two factor recovery code of the user, ErrInvalidTwoFactorCode when it has none
+	UseRecoveryCode(ctx context.Context, ID int32, hashedCode string) error
+	// UseTOTPStep records step as the last TOTP step of the user, ErrInvalidTwoFactorCode when it is not after
+	// the last one recorded
+	UseTOTPStep(ctx context.Context, ID int32, step int64) error
+	Discover(ctx context.Context, filter *DiscoverFilter) ([]*Profile, *DiscoverCursor, error)
+	GetYesSwipeIDs(ctx context.Context, ID int32) ([]int32, error)
 	Swipe(ctx context.Context, ID int32, swipe *Swipe) error
 	Match(ctx context.Context, ID, swipedID int32) (bool, error)
+	CreateMatch(ctx context.Context, match *Match) (*Match, error)
+	GetMatch(ctx context.Context, matchID string) (*Match, error)
+	GetMatches(ctx context.Context, ID, limit int32, after *MatchesCursor) ([]*Match, *MatchesCursor, error)
+	Unmatch(ctx context.Context, unmatch *Unmatch) error
+	GetUnmatchedIDs(ctx context.Context, ID int32) ([]int32, error)
+	Block(ctx context.Context, block *Block) error
+	GetBlockedIDs(ctx context.Context, ID int32) ([]int32, error)
+	CreateReport(ctx context.Context, report *Report) (*Report, error)
+	ListReports(ctx context.Context, filter *ReportFilter) ([]*Report, *ReportsCursor, error)
+	Moderate(ctx context.Context, moderation *Moderation) (*User, error)
+	GetModerations(ctx context.Context, ID int32) ([]*Moderation, error)
+	GetSwipes(ctx context.Context, ID int32) ([]*SwipeRecord, error)
+	// GetDeletedUserIDs returns the users deleted before deletedBefore
+	GetDeletedUserIDs(ctx context.Context, deletedBefore time.Time) ([]int32, error)
+	// PurgeUser erases the user with their swipes, matches, unmatches, blocks, reports filed by or against them,
+	// moderations, refresh tokens and one time tokens
+	PurgeUser(ctx context.Context, ID int32) error
+}
+
+// AttemptStore keeps the failed logins of emails and client IPs.
+type AttemptStore interface {
+	// GetLoginAttempts returns empty attempts for a key without failures
+	GetLoginAttempts(ctx context.Context, key string) (*LoginAttempts, error)
+	// IncrementLoginFailures counts a failure, the count restarts when the last failure is older than window
+	IncrementLoginFailures(ctx context.Context, key string, now time.Time, window time.Duration) (*LoginAttempts, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+	CreateLoginLockout(ctx context.Context, lockout *LoginLockout) error
+}
+
+type TokenStore interface {
+	CreateOneTimeToken(ctx context.Context, token *OneTimeToken) error
+	// UseOneTimeToken marks the token as used, ErrInvalidToken is returned when it is unknown, used or expired
+	UseOneTimeToken(ctx context.Context, ID string, purpose TokenPurpose, now time.Time) (*OneTimeToken, error)
+	// RevokeOneTimeTokens marks the unused tokens of the user for purpose as used
+	RevokeOneTimeTokens(ctx context.Context, userID int32, purpose TokenPurpose, now time.Time) error
+}
+
+type Mailer interface {
+	Send(ctx context.Context, message *mailer.Message) error
 }
@@ -7,8 +7,10 @@ package users
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
+	mailer "github.com/muzzapp/date-api/internal/mailer"
 )
 
 // MockStore is a mock of Store interface.
@@ -34,6 +36,50 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// Block mocks base method.
+func (m *MockStore) Block(ctx context.Context, block *Block) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Block", ctx, block)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Block indicates an expected call of Block.
+func (mr *MockStoreMockRecorder) Block(ctx, block interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Block", reflect.TypeOf((*MockStore)(nil).Block), ctx, block)
+}
+
+// CreateMatch mocks base method.
+func (m *MockStore) CreateMatch(ctx context.Context, match *Match) (*Match, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMatch", ctx, match)
+	ret0, _ := ret[0].(*Match)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateMatch indicates an expected call of CreateMatch.
+func (mr *MockStoreMockRecorder) CreateMatch(ctx, match interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMatch", reflect.TypeOf((*MockStore)(nil).CreateMatch), ctx, match)
+}
+
+// CreateReport mocks base method.
+func (m *MockStore) CreateReport(ctx context.Context, report *Report) (*Report, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateReport", ctx, report)
+	ret0, _ := ret[0].(*Report)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateReport indicates an expected call of CreateReport.
+func (mr *MockStoreMockRecorder) CreateReport(ctx, report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateReport", reflect.TypeOf((*MockStore)(nil).CreateReport), ctx, report)
+}
+
 // CreateUser mocks base method.
 func (m *MockStore) CreateUser(ctx context.Context, user *User) (*User, error) {
 	m.ctrl.T.Helper()
@@ -50,18 +96,95 @@ func (mr *MockStoreMockRecorder) CreateUser(ctx, user interface{}) *gomock.Call
 }
 
 // Discover mocks base method.
-func (m *MockStore) Discover(ctx context.Context, ID, minAge, maxAge int32, gender string, IDs []int32, location *Location, rank *Rank) ([]*Profile, error) {
+func (m *MockStore) Discover(ctx context.Context, filter *DiscoverFilter) ([]*Profile, *DiscoverCursor, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Discover", ctx, ID, minAge, maxAge, gender, IDs, location, rank)
+	ret := m.ctrl.Call(m, "Discover", ctx, filter)
 	ret0, _ := ret[0].([]*Profile)
+	ret1, _ := ret[1].(*DiscoverCursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Discover indicates an expected call of Discover.
+func (mr *MockStoreMockRecorder) Discover(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Discover", reflect.TypeOf((*MockStore)(nil).Discover), ctx, filter)
+}
+
+// GetBlockedIDs mocks base method.
+func (m *MockStore) GetBlockedIDs(ctx context.Context, ID int32) ([]int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBlockedIDs", ctx, ID)
+	ret0, _ := ret[0].([]int32)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// Discover indicates an expected call of Discover.
-func (mr *MockStoreMockRecorder) Discover(ctx, ID, minAge, maxAge, gender, IDs, location, rank interface{}) *gomock.Call {
+// GetBlockedIDs indicates an expected call of GetBlockedIDs.
+func (mr *MockStoreMockRecorder) GetBlockedIDs(ctx, ID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Discover", reflect.TypeOf((*MockStore)(nil).Discover), ctx, ID, minAge, maxAge, gender, IDs, location, rank)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlockedIDs", reflect.TypeOf((*MockStore)(nil).GetBlockedIDs), ctx, ID)
+}
+
+// GetDeletedUserIDs mocks base method.
+func (m *MockStore) GetDeletedUserIDs(ctx context.Context, deletedBefore time.Time) ([]int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeletedUserIDs", ctx, deletedBefore)
+	ret0, _ := ret[0].([]int32)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeletedUserIDs indicates an expected call of GetDeletedUserIDs.
+func (mr *MockStoreMockRecorder) GetDeletedUserIDs(ctx, deletedBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeletedUserIDs", reflect.TypeOf((*MockStore)(nil).GetDeletedUserIDs), ctx, deletedBefore)
+}
+
+// GetMatch mocks base method.
+func (m *MockStore) GetMatch(ctx context.Context, matchID string) (*Match, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMatch", ctx, matchID)
+	ret0, _ := ret[0].(*Match)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMatch indicates an expected call of GetMatch.
+func (mr *MockStoreMockRecorder) GetMatch(ctx, matchID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMatch", reflect.TypeOf((*MockStore)(nil).GetMatch), ctx, matchID)
+}
+
+// GetMatches mocks base method.
+func (m *MockStore) GetMatches(ctx context.Context, ID, limit int32, after *MatchesCursor) ([]*Match, *MatchesCursor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMatches", ctx, ID, limit, after)
+	ret0, _ := ret[0].([]*Match)
+	ret1, _ := ret[1].(*MatchesCursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetMatches indicates an expected call of GetMatches.
+func (mr *MockStoreMockRecorder) GetMatches(ctx, ID, limit, after interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMatches", reflect.TypeOf((*MockStore)(nil).GetMatches), ctx, ID, limit, after)
+}
+
+// GetModerations mocks base method.
+func (m *MockStore) GetModerations(ctx context.Context, ID int32) ([]*Moderation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetModerations", ctx, ID)
+	ret0, _ := ret[0].([]*Moderation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetModerations indicates an expected call of GetModerations.
+func (mr *MockStoreMockRecorder) GetModerations(ctx, ID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetModerations", reflect.TypeOf((*MockStore)(nil).GetModerations), ctx, ID)
 }
 
 // GetRankByIDs mocks base method.
@@ -79,6 +202,36 @@ func (mr *MockStoreMockRecorder) GetRankByIDs(ctx, IDs interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRankByIDs", reflect.TypeOf((*MockStore)(nil).GetRankByIDs), ctx, IDs)
 }
 
+// GetSwipes mocks base method.
+func (m *MockStore) GetSwipes(ctx context.Context, ID int32) ([]*SwipeRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSwipes", ctx, ID)
+	ret0, _ := ret[0].([]*SwipeRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSwipes indicates an expected call of GetSwipes.
+func (mr *MockStoreMockRecorder) GetSwipes(ctx, ID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSwipes", reflect.TypeOf((*MockStore)(nil).GetSwipes), ctx, ID)
+}
+
+// GetUnmatchedIDs mocks base method.
+func (m *MockStore) GetUnmatchedIDs(ctx context.Context, ID int32) ([]int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUnmatchedIDs", ctx, ID)
+	ret0, _ := ret[0].([]int32)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUnmatchedIDs indicates an expected call of GetUnmatchedIDs.
+func (mr *MockStoreMockRecorder) GetUnmatchedIDs(ctx, ID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnmatchedIDs", reflect.TypeOf((*MockStore)(nil).GetUnmatchedIDs), ctx, ID)
+}
+
 // GetUser mocks base method.
 func (m *MockStore) GetUser(ctx context.Context, ID int32) (*User, error) {
 	m.ctrl.T.Helper()
@@ -109,6 +262,37 @@ func (mr *MockStoreMockRecorder) GetUserByEmail(ctx, email interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockStore)(nil).GetUserByEmail), ctx, email)
 }
 
+// GetYesSwipeIDs mocks base method.
+func (m *MockStore) GetYesSwipeIDs(ctx context.Context, ID int32) ([]int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetYesSwipeIDs", ctx, ID)
+	ret0, _ := ret[0].([]int32)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetYesSwipeIDs indicates an expected call of GetYesSwipeIDs.
+func (mr *MockStoreMockRecorder) GetYesSwipeIDs(ctx, ID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetYesSwipeIDs", reflect.TypeOf((*MockStore)(nil).GetYesSwipeIDs), ctx, ID)
+}
+
+// ListReports mocks base method.
+func (m *MockStore) ListReports(ctx context.Context, filter *ReportFilter) ([]*Report, *ReportsCursor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListReports", ctx, filter)
+	ret0, _ := ret[0].([]*Report)
+	ret1, _ := ret[1].(*ReportsCursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListReports indicates an expected call of ListReports.
+func (mr *MockStoreMockRecorder) ListReports(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListReports", reflect.TypeOf((*MockStore)(nil).ListReports), ctx, filter)
+}
+
 // Match mocks base method.
 func (m *MockStore) Match(ctx context.Context, ID, swipedID int32) (bool, error) {
 	m.ctrl.T.Helper()
@@ -124,6 +308,35 @@ func (mr *MockStoreMockRecorder) Match(ctx, ID, swipedID interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Match", reflect.TypeOf((*MockStore)(nil).Match), ctx, ID, swipedID)
 }
 
+// Moderate mocks base method.
+func (m *MockStore) Moderate(ctx context.Context, moderation *Moderation) (*User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Moderate", ctx, moderation)
+	ret0, _ := ret[0].(*User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Moderate indicates an expected call of Moderate.
+func (mr *MockStoreMockRecorder) Moderate(ctx, moderation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Moderate", reflect.TypeOf((*MockStore)(nil).Moderate), ctx, moderation)
+}
+
+// PurgeUser mocks base method.
+func (m *MockStore) PurgeUser(ctx context.Context, ID int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeUser", ctx, ID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeUser indicates an expected call of PurgeUser.
+func (mr *MockStoreMockRecorder) PurgeUser(ctx, ID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeUser", reflect.TypeOf((*MockStore)(nil).PurgeUser), ctx, ID)
+}
+
 // Swipe mocks base method.
 func (m *MockStore) Swipe(ctx context.Context, ID int32, swipe *Swipe) error {
 	m.ctrl.T.Helper()
@@ -137,3 +350,258 @@ func (mr *MockStoreMockRecorder) Swipe(ctx, ID, swipe interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Swipe", reflect.TypeOf((*MockStore)(nil).Swipe), ctx, ID, swipe)
 }
+
+// Unmatch mocks base method.
+func (m *MockStore) Unmatch(ctx context.Context, unmatch *Unmatch) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unmatch", ctx, unmatch)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unmatch indicates an expected call of Unmatch.
+func (mr *MockStoreMockRecorder) Unmatch(ctx, unmatch interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unmatch", reflect.TypeOf((*MockStore)(nil).Unmatch), ctx, unmatch)
+}
+
+// UpdateUser mocks base method.
+func (m *MockStore) UpdateUser(ctx context.Context, ID int32, update *UserUpdate) (*User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUser", ctx, ID, update)
+	ret0, _ := ret[0].(*User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUser indicates an expected call of UpdateUser.
+func (mr *MockStoreMockRecorder) UpdateUser(ctx, ID, update interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockStore)(nil).UpdateUser), ctx, ID, update)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockStore) UseRecoveryCode(ctx context.Context, ID int32, hashedCode string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", ctx, ID, hashedCode)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockStoreMockRecorder) UseRecoveryCode(ctx, ID, hashedCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockStore)(nil).UseRecoveryCode), ctx, ID, hashedCode)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockStore) UseTOTPStep(ctx context.Context, ID int32, step int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", ctx, ID, step)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockStoreMockRecorder) UseTOTPStep(ctx, ID, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockStore)(nil).UseTOTPStep), ctx, ID, step)
+}
+
+// MockAttemptStore is a mock of AttemptStore interface.
+type MockAttemptStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockAttemptStoreMockRecorder
+}
+
+// MockAttemptStoreMockRecorder is the mock recorder for MockAttemptStore.
+type MockAttemptStoreMockRecorder struct {
+	mock *MockAttemptStore
+}
+
+// NewMockAttemptStore creates a new mock instance.
+func NewMockAttemptStore(ctrl *gomock.Controller) *MockAttemptStore {
+	mock := &MockAttemptStore{ctrl: ctrl}
+	mock.recorder = &MockAttemptStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAttemptStore) EXPECT() *MockAttemptStoreMockRecorder {
+	return m.recorder
+}
+
+// CreateLoginLockout mocks base method.
+func (m *MockAttemptStore) CreateLoginLockout(ctx context.Context, lockout *LoginLockout) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLoginLockout", ctx, lockout)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateLoginLockout indicates an expected call of CreateLoginLockout.
+func (mr *MockAttemptStoreMockRecorder) CreateLoginLockout(ctx, lockout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLoginLockout", reflect.TypeOf((*MockAttemptStore)(nil).CreateLoginLockout), ctx, lockout)
+}
+
+// GetLoginAttempts mocks base method.
+func (m *MockAttemptStore) GetLoginAttempts(ctx context.Context, key string) (*LoginAttempts, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLoginAttempts", ctx, key)
+	ret0, _ := ret[0].(*LoginAttempts)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLoginAttempts indicates an expected call of GetLoginAttempts.
+func (mr *MockAttemptStoreMockRecorder) GetLoginAttempts(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLoginAttempts", reflect.TypeOf((*MockAttemptStore)(nil).GetLoginAttempts), ctx, key)
+}
+
+// IncrementLoginFailures mocks base method.
+func (m *MockAttemptStore) IncrementLoginFailures(ctx context.Context, key string, now time.Time, window time.Duration) (*LoginAttempts, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementLoginFailures", ctx, key, now, window)
+	ret0, _ := ret[0].(*LoginAttempts)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncrementLoginFailures indicates an expected call of IncrementLoginFailures.
+func (mr *MockAttemptStoreMockRecorder) IncrementLoginFailures(ctx, key, now, window interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementLoginFailures", reflect.TypeOf((*MockAttemptStore)(nil).IncrementLoginFailures), ctx, key, now, window)
+}
+
+// LockLogin mocks base method.
+func (m *MockAttemptStore) LockLogin(ctx context.Context, key string, until time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockLogin", ctx, key, until)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LockLogin indicates an expected call of LockLogin.
+func (mr *MockAttemptStoreMockRecorder) LockLogin(ctx, key, until interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockLogin", reflect.TypeOf((*MockAttemptStore)(nil).LockLogin), ctx, key, until)
+}
+
+// ResetLoginAttempts mocks base method.
+func (m *MockAttemptStore) ResetLoginAttempts(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetLoginAttempts", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetLoginAttempts indicates an expected call of ResetLoginAttempts.
+func (mr *MockAttemptStoreMockRecorder) ResetLoginAttempts(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetLoginAttempts", reflect.TypeOf((*MockAttemptStore)(nil).ResetLoginAttempts), ctx, key)
+}
+
+// MockTokenStore is a mock of TokenStore interface.
+type MockTokenStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockTokenStoreMockRecorder
+}
+
+// MockTokenStoreMockRecorder is the mock recorder for MockTokenStore.
+type MockTokenStoreMockRecorder struct {
+	mock *MockTokenStore
+}
+
+// NewMockTokenStore creates a new mock instance.
+func NewMockTokenStore(ctrl *gomock.Controller) *MockTokenStore {
+	mock := &MockTokenStore{ctrl: ctrl}
+	mock.recorder = &MockTokenStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTokenStore) EXPECT() *MockTokenStoreMockRecorder {
+	return m.recorder
+}
+
+// CreateOneTimeToken mocks base method.
+func (m *MockTokenStore) CreateOneTimeToken(ctx context.Context, token *OneTimeToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOneTimeToken", ctx, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateOneTimeToken indicates an expected call of CreateOneTimeToken.
+func (mr *MockTokenStoreMockRecorder) CreateOneTimeToken(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOneTimeToken", reflect.TypeOf((*MockTokenStore)(nil).CreateOneTimeToken), ctx, token)
+}
+
+// RevokeOneTimeTokens mocks base method.
+func (m *MockTokenStore) RevokeOneTimeTokens(ctx context.Context, userID int32, purpose TokenPurpose, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeOneTimeTokens", ctx, userID, purpose, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeOneTimeTokens indicates an expected call of RevokeOneTimeTokens.
+func (mr *MockTokenStoreMockRecorder) RevokeOneTimeTokens(ctx, userID, purpose, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeOneTimeTokens", reflect.TypeOf((*MockTokenStore)(nil).RevokeOneTimeTokens), ctx, userID, purpose, now)
+}
+
+// UseOneTimeToken mocks base method.
+func (m *MockTokenStore) UseOneTimeToken(ctx context.Context, ID string, purpose TokenPurpose, now time.Time) (*OneTimeToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseOneTimeToken", ctx, ID, purpose, now)
+	ret0, _ := ret[0].(*OneTimeToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseOneTimeToken indicates an expected call of UseOneTimeToken.
+func (mr *MockTokenStoreMockRecorder) UseOneTimeToken(ctx, ID, purpose, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseOneTimeToken", reflect.TypeOf((*MockTokenStore)(nil).UseOneTimeToken), ctx, ID, purpose, now)
+}
+
+// MockMailer is a mock of Mailer interface.
+type MockMailer struct {
+	ctrl     *gomock.Controller
+	recorder *MockMailerMockRecorder
+}
+
+// MockMailerMockRecorder is the mock recorder for MockMailer.
+type MockMailerMockRecorder struct {
+	mock *MockMailer
+}
+
+// NewMockMailer creates a new mock instance.
+func NewMockMailer(ctrl *gomock.Controller) *MockMailer {
+	mock := &MockMailer{ctrl: ctrl}
+	mock.recorder = &MockMailerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMailer) EXPECT() *MockMailerMockRecorder {
+	return m.recorder
+}
+
+// Send mocks base method.
+func (m *MockMailer) Send(ctx context.Context, message *mailer.Message) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", ctx, message)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockMailerMockRecorder) Send(ctx, message interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockMailer)(nil).Send), ctx, message)
+}
@@ -0,0 +1,132 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// LockoutConfig sets how many failed logins an email or a client IP may make before being locked out. The
+// lockout doubles on every failure past the threshold, up to MaxLockout.
+type LockoutConfig struct {
+	MaxFailures int32 `envconfig:"LOGIN_MAX_FAILURES" default:"5"`
+	// IPMaxFailures is higher than MaxFailures since many users can share an IP
+	IPMaxFailures int32 `envconfig:"LOGIN_IP_MAX_FAILURES" default:"20"`
+	// Window is how long a failure is remembered after the last one
+	Window     time.Duration `envconfig:"LOGIN_FAILURE_WINDOW" default:"1h"`
+	Lockout    time.Duration `envconfig:"LOGIN_LOCKOUT" default:"1m"`
+	MaxLockout time.Duration `envconfig:"LOGIN_MAX_LOCKOUT" default:"1h"`
+}
+
+// LoginAttempts are the recent failed logins of a key, an email or a client IP.
+type LoginAttempts struct {
+	Key           string     `bson:"_id"`
+	Failures      int32      `bson:"failures"`
+	LastFailureAt time.Time  `bson:"lastFailureAt"`
+	LockedUntil   *time.Time `bson:"lockedUntil,omitempty"`
+}
+
+// LoginLockout records that a key was locked out.
+type LoginLockout struct {
+	Key         string    `bson:"key"`
+	Failures    int32     `bson:"failures"`
+	LockedUntil time.Time `bson:"lockedUntil"`
+	CreatedAt   time.Time `bson:"createdAt"`
+}
+
+// LoginLockedError is returned while an email or an IP is locked out, RetryAfter is the time left.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("login locked, retry after %s", e.RetryAfter)
+}
+
+func (e *LoginLockedError) Is(target error) bool {
+	return target == ErrLoginLocked
+}
+
+type lockoutKey struct {
+	key         string
+	maxFailures int32
+}
+
+func (s *Service) lockoutKeys(email, ip string) []lockoutKey {
+	if s.attempts == nil {
+		return nil
+	}
+	keys := []lockoutKey{{key: "email:" + email, maxFailures: s.lockout.MaxFailures}}
+	if ip != "" {
+		keys = append(keys, lockoutKey{key: "ip:" + ip, maxFailures: s.lockout.IPMaxFailures})
+	}
+	return keys
+}
+
+func (s *Service) checkLockout(ctx context.Context, keys []lockoutKey, now time.Time) error {
+	for _, k := range keys {
+		attempts, err := s.attempts.GetLoginAttempts(ctx, k.key)
+		if err != nil {
+			slog.Error("checkLockout GetLoginAttempts", "key", k.key, "err", err)
+			return err
+		}
+		if attempts.LockedUntil != nil && now.Before(*attempts.LockedUntil) {
+			return &LoginLockedError{RetryAfter: attempts.LockedUntil.Sub(now)}
+		}
+	}
+	return nil
+}
+
+func (s *Service) recordLoginFailure(ctx context.Context, keys []lockoutKey, now time.Time) error {
+	for _, k := range keys {
+		attempts, err := s.attempts.IncrementLoginFailures(ctx, k.key, now, s.lockout.Window)
+		if err != nil {
+			slog.Error("recordLoginFailure IncrementLoginFailures", "key", k.key, "err", err)
+			return err
+		}
+		if attempts.Failures < k.maxFailures {
+			continue
+		}
+		lockedUntil := now.Add(s.lockoutDuration(attempts.Failures - k.maxFailures))
+		if err = s.attempts.LockLogin(ctx, k.key, lockedUntil); err != nil {
+			slog.Error("recordLoginFailure LockLogin", "key", k.key, "err", err)
+			return err
+		}
+		lockout := &LoginLockout{
+			Key:         k.key,
+			Failures:    attempts.Failures,
+			LockedUntil: lockedUntil,
+			CreatedAt:   now,
+		}
+		if err = s.attempts.CreateLoginLockout(ctx, lockout); err != nil {
+			slog.Error("recordLoginFailure CreateLoginLockout", "key", k.key, "err", err)
+			return err
+		}
+		slog.Warn("login locked out", "key", k.key, "failures", attempts.Failures, "lockedUntil", lockedUntil)
+	}
+	return nil
+}
+
+// lockoutDuration doubles the lockout for every failure past the threshold.
+func (s *Service) lockoutDuration(extraFailures int32) time.Duration {
+	lockout := float64(s.lockout.Lockout) * math.Pow(2, float64(extraFailures))
+	if lockout > float64(s.lockout.MaxLockout) {
+		return s.lockout.MaxLockout
+	}
+	return time.Duration(lockout)
+}
+
+// resetLoginFailures forgets the failures of the email once its password was found, the IP failures are kept
+// so a valid account cannot be used to keep guessing the others.
+func (s *Service) resetLoginFailures(ctx context.Context, keys []lockoutKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := s.attempts.ResetLoginAttempts(ctx, keys[0].key); err != nil {
+		slog.Error("resetLoginFailures ResetLoginAttempts", "key", keys[0].key, "err", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package users_test
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/golang/mock/gomock"
+	"github.com/muzzapp/date-api/internal/storage/memory"
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestService_LoginLockout(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := users.NewMockStore(controller)
+	conf := &users.LockoutConfig{
+		MaxFailures:   3,
+		IPMaxFailures: 5,
+		Window:        time.Hour,
+		Lockout:       time.Minute,
+		MaxLockout:    time.Hour,
+	}
+	ctx := context.Background()
+	email := "jane@example.com"
+	store.EXPECT().GetUserByEmail(ctx, email).Return(nil, users.ErrUserNotFound).AnyTimes()
+
+	t.Run("email is locked out after too many failures", func(t *testing.T) {
+		// given
+		attempts := memory.NewAttempts()
+		userService := users.NewService(gofakeit.New(10), store, users.WithLoginLockout(attempts, conf))
+		for i := 0; i < 3; i++ {
+			_, err := userService.Login(ctx, email, "wrong", "10.0.0.1")
+			require.ErrorIs(t, err, users.ErrUserNotFound)
+		}
+
+		// when
+		_, err := userService.Login(ctx, email, "wrong", "10.0.0.1")
+
+		// then
+		var lockedErr *users.LoginLockedError
+		require.ErrorAs(t, err, &lockedErr)
+		require.ErrorIs(t, err, users.ErrLoginLocked)
+		require.InDelta(t, time.Minute, lockedErr.RetryAfter, float64(time.Second))
+		require.Len(t, attempts.Lockouts(), 1)
+		require.Equal(t, "email:"+email, attempts.Lockouts()[0].Key)
+	})
+
+	t.Run("lockout doubles on every failure past the threshold", func(t *testing.T) {
+		// given
+		attempts := memory.NewAttempts()
+		userService := users.NewService(gofakeit.New(10), store, users.WithLoginLockout(attempts, conf))
+		for i := 0; i < 3; i++ {
+			_, _ = userService.Login(ctx, email, "wrong", "")
+		}
+		// the first lockout is over
+		require.NoError(t, attempts.LockLogin(ctx, "email:"+email, time.Now().Add(-time.Second)))
+
+		// when
+		_, err := userService.Login(ctx, email, "wrong", "")
+		require.ErrorIs(t, err, users.ErrUserNotFound)
+
+		// then
+		lockouts := attempts.Lockouts()
+		require.Len(t, lockouts, 2)
+		require.Equal(t, int32(4), lockouts[1].Failures)
+		require.Equal(t, 2*time.Minute, lockouts[1].LockedUntil.Sub(lockouts[1].CreatedAt))
+	})
+
+	t.Run("ip is locked out across emails", func(t *testing.T) {
+		// given
+		attempts := memory.NewAttempts()
+		userService := users.NewService(gofakeit.New(10), store, users.WithLoginLockout(attempts, conf))
+		for i := 0; i < 5; i++ {
+			other := gofakeit.New(uint64(i)).Email()
+			store.EXPECT().GetUserByEmail(ctx, other).Return(nil, users.ErrUserNotFound)
+			_, _ = userService.Login(ctx, other, "wrong", "10.0.0.2")
+		}
+
+		// when
+		_, err := userService.Login(ctx, "someone@example.com", "wrong", "10.0.0.2")
+
+		// then
+		require.ErrorIs(t, err, users.ErrLoginLocked)
+	})
+
+	t.Run("successful login forgets the email failures", func(t *testing.T) {
+		// given
+		attempts := memory.NewAttempts()
+		userService := users.NewService(gofakeit.New(10), store, users.WithLoginLockout(attempts, conf))
+		password := "Secret123"
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		require.NoError(t, err)
+		user := &users.User{ID: 1, Email: "john@example.com", Password: string(hashed)}
+		store.EXPECT().GetUserByEmail(ctx, user.Email).Return(user, nil).AnyTimes()
+		for i := 0; i < 2; i++ {
+			_, err = userService.Login(ctx, user.Email, "wrong", "")
+			require.ErrorIs(t, err, users.ErrPasswordMismatch)
+		}
+
+		// when
+		_, err = userService.Login(ctx, user.Email, password, "")
+		require.NoError(t, err)
+
+		// then
+		remaining, err := attempts.GetLoginAttempts(ctx, "email:"+user.Email)
+		require.NoError(t, err)
+		require.Zero(t, remaining.Failures)
+	})
+
+	t.Run("password of a two factor user keeps the failures until the code is checked", func(t *testing.T) {
+		// given
+		attempts := memory.NewAttempts()
+		twoFactorConf := &users.TwoFactorConfig{ChallengeTTL: time.Minute, Key: base64.StdEncoding.EncodeToString(make([]byte, 32))}
+		twoFactorKey, err := users.NewTwoFactorKey(twoFactorConf)
+		require.NoError(t, err)
+		userService := users.NewService(gofakeit.New(10), store,
+			users.WithLoginLockout(attempts, conf),
+			users.WithTwoFactor(memory.NewTokens(), twoFactorConf, twoFactorKey),
+		)
+		password := "Secret123"
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		require.NoError(t, err)
+		user := &users.User{
+			ID:            2,
+			Email:         "joan@example.com",
+			Password:      string(hashed),
+			EmailVerified: true,
+			TwoFactor:     &users.TwoFactor{Secret: "JBSWY3DPEHPK3PXP", Enabled: true},
+		}
+		store.EXPECT().GetUserByEmail(ctx, user.Email).Return(user, nil).AnyTimes()
+		for i := 0; i < 2; i++ {
+			_, err = userService.Login(ctx, user.Email, "wrong", "")
+			require.ErrorIs(t, err, users.ErrPasswordMismatch)
+		}
+
+		// when
+		_, err = userService.Login(ctx, user.Email, password, "")
+		require.ErrorIs(t, err, users.ErrTwoFactorRequired)
+
+		// then
+		remaining, err := attempts.GetLoginAttempts(ctx, "email:"+user.Email)
+		require.NoError(t, err)
+		require.Equal(t, int32(2), remaining.Failures)
+	})
+}
@@ -1,20 +1,99 @@
 package users
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/brianvoe/gofakeit/v7"
 )
 
 type User struct {
-	ID       int32     `bson:"_id"`
-	Email    string    `bson:"email"`
-	Password string    `bson:"password"`
-	Name     string    `bson:"name"`
-	Gender   string    `bson:"gender"`
-	Age      *Age      `bson:"age"`
-	Location *Location `bson:"location"`
-	Swipes   []*Swipe  `bson:"swipes"`
+	ID          int32        `bson:"_id"`
+	Email       string       `bson:"email"`
+	Password    string       `bson:"password"`
+	Name        string       `bson:"name"`
+	Gender      string       `bson:"gender"`
+	Bio         string       `bson:"bio"`
+	Age         *Age         `bson:"age"`
+	Location    *Location    `bson:"location"`
+	Preferences *Preferences `bson:"preferences"`
+	// EmailVerified is set once the user used the token mailed on registration
+	EmailVerified bool `bson:"emailVerified"`
+	// TwoFactor is nil until the user enrolls
+	TwoFactor *TwoFactor `bson:"twoFactor,omitempty"`
+	// Role is empty for the users created before roles existed, they are regular users
+	Role Role `bson:"role,omitempty"`
+	// Moderation is the latest moderation decision taken on the user, nil when there never was one
+	Moderation *Moderation `bson:"moderation,omitempty"`
+	// DeletedAt is set when the user deleted their account, it is erased after a grace period
+	DeletedAt *time.Time `bson:"deletedAt,omitempty"`
+}
+
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+func (r Role) orDefault() Role {
+	if r == "" {
+		return RoleUser
+	}
+	return r
+}
+
+// moderationErr tells whether the user is currently banned or suspended.
+func (u *User) moderationErr(now time.Time) error {
+	if u.Moderation == nil {
+		return nil
+	}
+	switch u.Moderation.Status {
+	case ModerationStatusBanned:
+		return ErrUserBanned
+	case ModerationStatusSuspended:
+		if u.Moderation.Until == nil || now.Before(*u.Moderation.Until) {
+			return ErrUserSuspended
+		}
+	}
+	return nil
+}
+
+// Preferences are the discover filters saved by a user, they are used whenever a discover query omits them.
+type Preferences struct {
+	Genders []string `bson:"genders"`
+	MinAge  int32    `bson:"minAge"`
+	MaxAge  int32    `bson:"maxAge"`
+	// MaxDistance is expressed in Unit, zero means no limit
+	MaxDistance float64      `bson:"maxDistance"`
+	Unit        DistanceUnit `bson:"unit"`
+	Ranked      bool         `bson:"ranked"`
+}
+
+func (p *Preferences) validate() error {
+	errs := ValidationError{}
+	seen := make(map[string]bool, len(p.Genders))
+	for _, gender := range p.Genders {
+		validateGender(gender, errs)
+		if seen[gender] {
+			errs["genders"] = "must not contain duplicates"
+		}
+		seen[gender] = true
+	}
+	if gender, ok := errs["gender"]; ok {
+		delete(errs, "gender")
+		errs["genders"] = gender
+	}
+	validateAgeRange(p.MinAge, p.MaxAge, errs)
+	if p.MaxDistance < 0 {
+		errs["maxDistance"] = "must not be negative"
+	}
+	switch p.Unit {
+	case "", Kilometers, Miles:
+	default:
+		errs["unit"] = "must be km or mi"
+	}
+	return errs.errOrNil()
 }
 
 type Age struct {
@@ -34,6 +113,17 @@ func (l *Location) CoordinatesFloat64Slice() []float64 {
 	return []float64{l.Coordinates.Longitude, l.Coordinates.Latitude}
 }
 
+func newPointLocation(c *Coordinates) *Location {
+	return &Location{
+		Type: "Point",
+		Coordinates: &Coordinates{
+			Longitude: c.Longitude,
+			Latitude:  c.Latitude,
+		},
+	}
+}
+
+// Coordinates are persisted by MongoDB as a GeoJSON [longitude, latitude] pair, see the persistence codecs.
 type Coordinates struct {
 	Longitude float64 `bson:"longitude"`
 	Latitude  float64 `bson:"latitude"`
@@ -44,28 +134,11 @@ type Swipe struct {
 	OK bool  `bson:"ok"`
 }
 
-func (u *User) swipeIDs() []int32 {
-	if u.Swipes == nil {
-		return nil
+func (u *User) age() int32 {
+	if u.Age == nil {
+		return 0
 	}
-	ids := make([]int32, len(u.Swipes))
-	for i, swipe := range u.Swipes {
-		ids[i] = swipe.ID
-	}
-	return ids
-}
-
-func (u *User) yesSwipeIDs() []int32 {
-	if u.Swipes == nil {
-		return nil
-	}
-	ids := make([]int32, 0)
-	for _, swipe := range u.Swipes {
-		if swipe.OK {
-			ids = append(ids, swipe.ID)
-		}
-	}
-	return ids
+	return u.Age.Value
 }
 
 func NewFakeUser(f *gofakeit.Faker) *User {
@@ -82,7 +155,8 @@ func NewFakeUser(f *gofakeit.Faker) *User {
 				Latitude:  f.Latitude(),
 			},
 		},
-		Swipes: []*Swipe{},
+		// seeded users have no mailbox to verify
+		EmailVerified: true,
 	}
 }
 
@@ -103,6 +177,164 @@ func calculateAge(now, dob time.Time) int32 {
 	return int32(years)
 }
 
+type Registration struct {
+	Email    string
+	Password string
+	Name     string
+	Gender   string
+	DOB      time.Time
+	Location *Coordinates
+}
+
+func (r *Registration) validate(now time.Time) error {
+	errs := ValidationError{}
+	validateEmail(r.Email, errs)
+	validatePassword(r.Password, errs)
+	validateName(r.Name, errs)
+	validateGender(r.Gender, errs)
+	validateDOB(now, r.DOB, errs)
+	validateCoordinates(r.Location, errs)
+	return errs.errOrNil()
+}
+
+// ProfileUpdate holds the fields a user may change on their own profile, nil fields are left untouched.
+type ProfileUpdate struct {
+	Name     *string
+	Gender   *string
+	Bio      *string
+	DOB      *time.Time
+	Location *Coordinates
+}
+
+func (p *ProfileUpdate) validate(now time.Time) error {
+	errs := ValidationError{}
+	if p.Name != nil {
+		validateName(*p.Name, errs)
+	}
+	if p.Gender != nil {
+		validateGender(*p.Gender, errs)
+	}
+	if p.Bio != nil {
+		validateBio(*p.Bio, errs)
+	}
+	if p.DOB != nil {
+		validateDOB(now, *p.DOB, errs)
+	}
+	if p.Location != nil {
+		validateCoordinates(p.Location, errs)
+	}
+	return errs.errOrNil()
+}
+
+func (p *ProfileUpdate) toUserUpdate(now time.Time) *UserUpdate {
+	update := &UserUpdate{
+		Name:   p.Name,
+		Gender: p.Gender,
+		Bio:    p.Bio,
+	}
+	if p.DOB != nil {
+		update.Age = &Age{
+			Value: calculateAge(now, *p.DOB),
+			DOB:   *p.DOB,
+		}
+	}
+	if p.Location != nil {
+		update.Location = newPointLocation(p.Location)
+	}
+	return update
+}
+
+// UserUpdate is the set of fields persisted by Store.UpdateUser, nil fields are left untouched.
+type UserUpdate struct {
+	// Password is the hashed password
+	Password      *string
+	EmailVerified *bool
+	TwoFactor     *TwoFactor
+	DeletedAt     *time.Time
+	Name          *string
+	Gender        *string
+	Bio           *string
+	Age           *Age
+	Location      *Location
+	Preferences   *Preferences
+}
+
+// DiscoverQuery holds the filters of a discover request, zero values fall back to the user Preferences.
+type DiscoverQuery struct {
+	MinAge      int32
+	MaxAge      int32
+	Genders     []string
+	Ranked      *bool
+	MaxDistance float64
+	Unit        DistanceUnit
+	Limit       int32
+	Cursor      string
+}
+
+// withPreferences fills every filter missing from the query with the saved preferences.
+func (q *DiscoverQuery) withPreferences(p *Preferences) *DiscoverQuery {
+	if p == nil {
+		p = &Preferences{}
+	}
+	resolved := *q
+	if resolved.MinAge == 0 {
+		resolved.MinAge = p.MinAge
+	}
+	if resolved.MaxAge == 0 {
+		resolved.MaxAge = p.MaxAge
+	}
+	if len(resolved.Genders) == 0 {
+		resolved.Genders = p.Genders
+	}
+	if resolved.Ranked == nil {
+		ranked := p.Ranked
+		resolved.Ranked = &ranked
+	}
+	if resolved.Unit == "" {
+		resolved.Unit = p.Unit
+	}
+	resolved.Unit = resolved.Unit.orDefault()
+	if resolved.MaxDistance == 0 && p.MaxDistance > 0 {
+		resolved.MaxDistance = p.Unit.orDefault().convert(p.MaxDistance, resolved.Unit)
+	}
+	return &resolved
+}
+
+// validate checks the query once resolved with the saved preferences, a min age sent in the query may be above
+// the saved max age.
+func (q *DiscoverQuery) validate() error {
+	errs := ValidationError{}
+	validateAgeRange(q.MinAge, q.MaxAge, errs)
+	return errs.errOrNil()
+}
+
+type DiscoverResult struct {
+	Profiles   []*Profile
+	NextCursor string
+	// Unit of every Profile.DistanceFromMe
+	Unit DistanceUnit
+}
+
+// DiscoverFilter is everything Store.Discover needs to find the next page of profiles, the store leaves out ID
+// and the users ID swiped, unmatched, blocked or was blocked by without loading them.
+type DiscoverFilter struct {
+	ID int32
+	// RequesterGender and RequesterAge are matched against the candidates preferences
+	RequesterGender string
+	RequesterAge    int32
+	MinAge          int32
+	MaxAge          int32
+	Genders         []string
+	Location        *Location
+	// MaxDistance in meters, zero means no limit
+	MaxDistance float64
+	Rank        *Rank
+	// VerifiedOnly hides the users who did not verify their email
+	VerifiedOnly bool
+	Limit        int32
+	After        *DiscoverCursor
+}
+
 type Profile struct {
 	ID             int32
 	Name           string
@@ -111,7 +343,188 @@ type Profile struct {
 	DistanceFromMe int32
 }
 
+type Match struct {
+	ID        string    `bson:"_id"`
+	UserIDs   []int32   `bson:"userIDs"`
+	CreatedAt time.Time `bson:"createdAt"`
+	// Profile of the other user, only set when listing matches
+	Profile *Profile `bson:"-"`
+}
+
+// NewMatch builds the match between two users, its ID only depends on the pair so
+// recording the same match twice is idempotent.
+func NewMatch(ID, otherID int32, now time.Time) *Match {
+	if otherID < ID {
+		ID, otherID = otherID, ID
+	}
+	return &Match{
+		ID:        fmt.Sprintf("%d-%d", ID, otherID),
+		UserIDs:   []int32{ID, otherID},
+		CreatedAt: now,
+	}
+}
+
+// Unmatch records that a match was undone, the pair is never shown to or matched with each other again.
+type Unmatch struct {
+	MatchID     string    `bson:"matchID"`
+	UserIDs     []int32   `bson:"userIDs"`
+	InitiatorID int32     `bson:"initiatorID"`
+	CreatedAt   time.Time `bson:"createdAt"`
+}
+
+type Block struct {
+	BlockerID int32     `bson:"blockerID"`
+	BlockedID int32     `bson:"blockedID"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+type ReportReason string
+
+const (
+	ReportReasonSpam          ReportReason = "spam"
+	ReportReasonFakeProfile   ReportReason = "fake_profile"
+	ReportReasonInappropriate ReportReason = "inappropriate"
+	ReportReasonHarassment    ReportReason = "harassment"
+	ReportReasonUnderage      ReportReason = "underage"
+	ReportReasonOther         ReportReason = "other"
+)
+
+type ReportStatus string
+
+const (
+	ReportStatusOpen ReportStatus = "open"
+)
+
+// Report is a complaint about a user, stored for the moderators to review.
+type Report struct {
+	ID         int32        `bson:"_id"`
+	ReporterID int32        `bson:"reporterID"`
+	ReportedID int32        `bson:"reportedID"`
+	Reason     ReportReason `bson:"reason"`
+	Details    string       `bson:"details"`
+	Status     ReportStatus `bson:"status"`
+	CreatedAt  time.Time    `bson:"createdAt"`
+}
+
+func (r *Report) validate() error {
+	errs := ValidationError{}
+	if r.ReporterID == r.ReportedID {
+		errs["id"] = "cannot report yourself"
+	}
+	switch r.Reason {
+	case ReportReasonSpam, ReportReasonFakeProfile, ReportReasonInappropriate, ReportReasonHarassment,
+		ReportReasonUnderage, ReportReasonOther:
+	default:
+		errs["reason"] = "must be one of spam, fake_profile, inappropriate, harassment, underage or other"
+	}
+	if r.Reason == ReportReasonOther && r.Details == "" {
+		errs["details"] = "is required when the reason is other"
+	}
+	if len(r.Details) > maxReportDetailsLength {
+		errs["details"] = "must be at most 1000 characters"
+	}
+	return errs.errOrNil()
+}
+
+type ModerationStatus string
+
+const (
+	ModerationStatusActive    ModerationStatus = "active"
+	ModerationStatusSuspended ModerationStatus = "suspended"
+	ModerationStatusBanned    ModerationStatus = "banned"
+)
+
+// Moderation is a decision taken by a moderator on a user, the latest one is kept on the user and every one
+// is kept in the user history.
+type Moderation struct {
+	UserID int32 `bson:"userID"`
+	// ModeratorID is zero when the decision was automatic, like the end of a suspension
+	ModeratorID int32            `bson:"moderatorID"`
+	Status      ModerationStatus `bson:"status"`
+	Reason      string           `bson:"reason"`
+	// Until is the end of a suspension
+	Until     *time.Time `bson:"until,omitempty"`
+	CreatedAt time.Time  `bson:"createdAt"`
+}
+
+func (m *Moderation) validate(now time.Time) error {
+	errs := ValidationError{}
+	if m.UserID == m.ModeratorID {
+		errs["id"] = "cannot moderate yourself"
+	}
+	switch m.Status {
+	case ModerationStatusSuspended:
+		if m.Until == nil || !m.Until.After(now) {
+			errs["until"] = "must be in the future"
+		}
+	case ModerationStatusActive, ModerationStatusBanned:
+		if m.Until != nil {
+			errs["until"] = "is only allowed for suspensions"
+		}
+	default:
+		errs["status"] = "must be one of active, suspended or banned"
+	}
+	if m.Status != ModerationStatusActive && m.Reason == "" {
+		errs["reason"] = "is required"
+	}
+	if len(m.Reason) > maxReportDetailsLength {
+		errs["reason"] = "must be at most 1000 characters"
+	}
+	return errs.errOrNil()
+}
+
+type ReportsQuery struct {
+	Status     ReportStatus
+	Reason     ReportReason
+	ReporterID int32
+	ReportedID int32
+	Limit      int32
+	Cursor     string
+}
+
+type ReportsResult struct {
+	Reports    []*Report
+	NextCursor string
+}
+
+// ReportFilter selects the reports listed to moderators, zero fields are ignored and a zero Limit returns every
+// report.
+type ReportFilter struct {
+	Status     ReportStatus
+	Reason     ReportReason
+	ReporterID int32
+	ReportedID int32
+	Limit      int32
+	After      *ReportsCursor
+}
+
+// HistoryQuery pages the reports of a user history, Limit applies to the reports received and filed each.
+type HistoryQuery struct {
+	Limit int32
+}
+
+// UserHistory is everything the moderators need to know about a user. The next reports are listed by
+// ListReports from the cursors, filtered on the reported or reporter user.
+type UserHistory struct {
+	User                      *User
+	ReportsReceived           []*Report
+	ReportsReceivedNextCursor string
+	ReportsFiled              []*Report
+	ReportsFiledNextCursor    string
+	Moderations               []*Moderation
+}
+
+type MatchesQuery struct {
+	Limit  int32
+	Cursor string
+}
+
+type MatchesResult struct {
+	Matches    []*Match
+	NextCursor string
+}
+
 type Rank struct {
-	AvgAge           int32
-	MostCommonGender string
+	AvgAge           int32  `json:"a"`
+	MostCommonGender string `json:"g,omitempty"`
 }
@@ -0,0 +1,55 @@
+package users_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/muzzapp/date-api/internal/storage/memory"
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+// TestService_DiscoverRank pins the rank to the yes swipes only, as documented: the no swipes would rank the males
+// around 26 first here.
+func TestService_DiscoverRank(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewUser()
+	userService := users.NewService(gofakeit.New(10), store)
+	create := func(name, gender string, age int32, latitude float64) *users.User {
+		user, err := store.CreateUser(ctx, &users.User{
+			Email:         name + "@example.com",
+			Name:          name,
+			Gender:        gender,
+			Age:           &users.Age{Value: age},
+			Location:      &users.Location{Type: "Point", Coordinates: &users.Coordinates{Latitude: latitude}},
+			EmailVerified: true,
+		})
+		require.NoError(t, err)
+		return user
+	}
+
+	// given
+	me := create("me", "male", 30, 0)
+	liked := create("liked", "female", 40, 0.1)
+	passed := create("passed", "male", 20, 0.2)
+	passedToo := create("passedToo", "male", 20, 0.3)
+	far := create("far", "female", 40, 3)
+	near := create("near", "male", 20, 1)
+	_, err := userService.Swipe(ctx, me.ID, liked.ID, true)
+	require.NoError(t, err)
+	_, err = userService.Swipe(ctx, me.ID, passed.ID, false)
+	require.NoError(t, err)
+	_, err = userService.Swipe(ctx, me.ID, passedToo.ID, false)
+	require.NoError(t, err)
+	ranked := true
+
+	// when
+	result, err := userService.Discover(ctx, me.ID, &users.DiscoverQuery{Ranked: &ranked})
+
+	// then
+	require.NoError(t, err)
+	require.Len(t, result.Profiles, 2)
+	require.Equal(t, far.ID, result.Profiles[0].ID)
+	require.Equal(t, near.ID, result.Profiles[1].ID)
+}
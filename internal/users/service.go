@@ -4,23 +4,53 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/brianvoe/gofakeit/v7"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Service struct {
-	store Store
-	faker *gofakeit.Faker
+	store    Store
+	faker    *gofakeit.Faker
+	attempts AttemptStore
+	lockout  *LockoutConfig
+	tokens   TokenStore
+	mailer   Mailer
+	account  *AccountConfig
+	// twoFactor is nil when the TOTP login is disabled
+	twoFactor    *TwoFactorConfig
+	twoFactorKey *TwoFactorKey
+	// challenges keeps the two factor login challenges, apart from the tokens mailed by the account recovery
+	challenges TokenStore
+	deletion   *DeletionConfig
+	// background tracks the work left running after a request returned, like sending mails
+	background sync.WaitGroup
 
 	fakeUserFunc func(faker *gofakeit.Faker) *User
 }
 
-func NewService(faker *gofakeit.Faker, store Store) *Service {
-	return &Service{
+type Option func(s *Service)
+
+// WithLoginLockout locks out the emails and IPs making too many failed logins, logins are not limited without it.
+func WithLoginLockout(attempts AttemptStore, conf *LockoutConfig) Option {
+	return func(s *Service) {
+		s.attempts = attempts
+		s.lockout = conf
+	}
+}
+
+func NewService(faker *gofakeit.Faker, store Store, opts ...Option) *Service {
+	s := &Service{
 		store: store,
 		faker: faker,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *Service) CreateUser(ctx context.Context) (*User, error) {
@@ -37,6 +67,54 @@ func (s *Service) CreateUser(ctx context.Context) (*User, error) {
 	return createdUser, nil
 }
 
+func (s *Service) Register(ctx context.Context, r *Registration) (*User, error) {
+	r.Email = normalizeEmail(r.Email)
+	if err := r.validate(time.Now()); err != nil {
+		return nil, err
+	}
+
+	_, err := s.store.GetUserByEmail(ctx, r.Email)
+	switch {
+	case err == nil:
+		return nil, ErrEmailTaken
+	case !errors.Is(err, ErrUserNotFound):
+		slog.Error("Register GetUserByEmail", "email", r.Email, "err", err)
+		return nil, err
+	}
+
+	password := hashPassword(r.Password)
+	if password == "" {
+		return nil, ErrHashPassword
+	}
+	user := &User{
+		Email:    r.Email,
+		Password: password,
+		Name:     r.Name,
+		Gender:   r.Gender,
+		Age: &Age{
+			Value: calculateAge(time.Now(), r.DOB),
+			DOB:   r.DOB,
+		},
+		Location: newPointLocation(r.Location),
+	}
+
+	createdUser, err := s.store.CreateUser(ctx, user)
+	if err != nil {
+		if !errors.Is(err, ErrEmailTaken) {
+			slog.Error("Register CreateUser", "email", r.Email, "err", err)
+		}
+		return nil, err
+	}
+	createdUser.Password = ""
+	if s.accountRecoveryErr() == nil {
+		// the user is registered anyway, the verification can be mailed again
+		if err = s.sendEmailVerification(ctx, createdUser); err != nil {
+			slog.Error("Register sendEmailVerification", "ID", createdUser.ID, "err", err)
+		}
+	}
+	return createdUser, nil
+}
+
 func (s *Service) newFakeUser() *User {
 	if s.fakeUserFunc == nil {
 		return NewFakeUser(s.faker)
@@ -53,15 +131,66 @@ func hashPassword(password string) string {
 	return string(bytes)
 }
 
-func (s *Service) Login(ctx context.Context, email, password string) (*User, error) {
+// Login checks the credentials of a user logging in from ip. Too many failures lock out the email and the ip,
+// a *LoginLockedError is returned until the lockout ends.
+func (s *Service) Login(ctx context.Context, email, password, ip string) (*User, error) {
+	email = normalizeEmail(email)
+	now := time.Now().UTC()
+	keys := s.lockoutKeys(email, ip)
+	if err := s.checkLockout(ctx, keys, now); err != nil {
+		return nil, err
+	}
+
 	foundUser, err := s.store.GetUserByEmail(ctx, email)
 	if err != nil {
-		slog.Error("login GetUserByEmail", "email", email, "err", err)
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("login GetUserByEmail", "email", email, "err", err)
+			return nil, err
+		}
+		if failureErr := s.recordLoginFailure(ctx, keys, now); failureErr != nil {
+			return nil, failureErr
+		}
 		return nil, err
 	}
 	if !verifyPassword(foundUser.Password, password) {
+		if err = s.recordLoginFailure(ctx, keys, now); err != nil {
+			return nil, err
+		}
 		return nil, ErrPasswordMismatch
 	}
+	if foundUser.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	if err = foundUser.moderationErr(now); err != nil {
+		return nil, err
+	}
+	if err = s.verificationErr(foundUser); err != nil {
+		return nil, err
+	}
+	if foundUser.Moderation != nil && foundUser.Moderation.Status == ModerationStatusSuspended {
+		// the suspension is over, it is lifted on the first login after its end
+		foundUser, err = s.store.Moderate(ctx, &Moderation{
+			UserID:    foundUser.ID,
+			Status:    ModerationStatusActive,
+			Reason:    "suspension ended",
+			CreatedAt: now,
+		})
+		if err != nil {
+			slog.Error("login Moderate", "email", email, "err", err)
+			return nil, err
+		}
+	}
+	foundUser.Role = foundUser.Role.orDefault()
+	if foundUser.TwoFactor.enabled() {
+		if err = s.twoFactorErr(); err != nil {
+			return nil, err
+		}
+		// the failures are kept until the second factor is checked, or the password would reset them between codes
+		return nil, s.requireTwoFactor(ctx, foundUser)
+	}
+	if err = s.resetLoginFailures(ctx, keys); err != nil {
+		return nil, err
+	}
 	return foundUser, nil
 }
 
@@ -72,37 +201,194 @@ func verifyPassword(hashedPassword, password string) bool {
 	return true
 }
 
-func (s *Service) Discover(ctx context.Context, ID, minAge, maxAge int32, gender string, ranked bool) ([]*Profile, error) {
+func (s *Service) GetUser(ctx context.Context, ID int32) (*User, error) {
+	user, err := s.store.GetUser(ctx, ID)
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("GetUser", "ID", ID, "err", err)
+		}
+		return nil, err
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// GetActiveUser returns a user who is allowed to log in, deleted, banned and suspended users are rejected, as are
+// unverified users when they may not log in.
+func (s *Service) GetActiveUser(ctx context.Context, ID int32) (*User, error) {
+	user, err := s.GetUser(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	if err = user.moderationErr(time.Now()); err != nil {
+		return nil, err
+	}
+	if err = s.verificationErr(user); err != nil {
+		return nil, err
+	}
+	user.Role = user.Role.orDefault()
+	return user, nil
+}
+
+func (s *Service) UpdateUser(ctx context.Context, ID int32, p *ProfileUpdate) (*User, error) {
+	now := time.Now()
+	if err := p.validate(now); err != nil {
+		return nil, err
+	}
+	user, err := s.store.UpdateUser(ctx, ID, p.toUserUpdate(now))
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("UpdateUser", "ID", ID, "err", err)
+		}
+		return nil, err
+	}
+	user.Password = ""
+	return user, nil
+}
+
+func (s *Service) UpdateLocation(ctx context.Context, ID int32, c *Coordinates) (*User, error) {
+	errs := ValidationError{}
+	validateCoordinates(c, errs)
+	if err := errs.errOrNil(); err != nil {
+		return nil, err
+	}
+	user, err := s.store.UpdateUser(ctx, ID, &UserUpdate{Location: newPointLocation(c)})
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("UpdateLocation", "ID", ID, "err", err)
+		}
+		return nil, err
+	}
+	user.Password = ""
+	return user, nil
+}
+
+func (s *Service) GetPreferences(ctx context.Context, ID int32) (*Preferences, error) {
+	user, err := s.store.GetUser(ctx, ID)
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("GetPreferences GetUser", "ID", ID, "err", err)
+		}
+		return nil, err
+	}
+	if user.Preferences == nil {
+		return &Preferences{Unit: Kilometers}, nil
+	}
+	return user.Preferences, nil
+}
+
+func (s *Service) UpdatePreferences(ctx context.Context, ID int32, p *Preferences) (*Preferences, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	p.Unit = p.Unit.orDefault()
+	user, err := s.store.UpdateUser(ctx, ID, &UserUpdate{Preferences: p})
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("UpdatePreferences", "ID", ID, "err", err)
+		}
+		return nil, err
+	}
+	return user.Preferences, nil
+}
+
+func (s *Service) Discover(ctx context.Context, ID int32, q *DiscoverQuery) (*DiscoverResult, error) {
+	after, err := decodeCursor[DiscoverCursor](q.Cursor)
+	if err != nil {
+		return nil, err
+	}
 	user, err := s.store.GetUser(ctx, ID)
 	if err != nil {
 		slog.Error("Discover GetUser", "ID", ID, "err", err)
 		return nil, err
 	}
-	swipeIDs := user.swipeIDs()
-	rank, err := s.rankedDiscover(ctx, ranked, swipeIDs)
+	q = q.withPreferences(user.Preferences)
+	if err = q.validate(); err != nil {
+		return nil, err
+	}
+	rank, err := s.rankedDiscover(ctx, *q.Ranked, ID, after)
 	if err != nil {
-		slog.Error("Discover rankedDiscover", "ranked", ranked, "swipeIDs", swipeIDs, "err", err)
+		slog.Error("Discover rankedDiscover", "ranked", *q.Ranked, "ID", ID, "err", err)
 		return nil, err
 	}
 
-	profiles, err := s.store.Discover(ctx, ID, minAge, maxAge, gender, swipeIDs, user.Location, rank)
+	var maxDistance float64
+	if q.MaxDistance > 0 {
+		maxDistance = q.Unit.toMeters(q.MaxDistance)
+	}
+	filter := &DiscoverFilter{
+		ID:              ID,
+		RequesterGender: user.Gender,
+		RequesterAge:    user.age(),
+		MinAge:          q.MinAge,
+		MaxAge:          q.MaxAge,
+		Genders:         q.Genders,
+		Location:        user.Location,
+		MaxDistance:     maxDistance,
+		Rank:            rank,
+		VerifiedOnly:    !s.unverifiedDiscoverable(),
+		Limit:           q.Limit,
+		After:           after,
+	}
+	profiles, next, err := s.store.Discover(ctx, filter)
 	if err != nil {
 		slog.Error("Discover",
-			"ID", ID, "minAge", minAge, "maxAge", maxAge, "gender", gender, "swipeIDs", swipeIDs,
-			"Coordinates", user.Location.CoordinatesFloat64Slice(), "ranked", ranked, "err", err)
+			"ID", ID, "minAge", q.MinAge, "maxAge", q.MaxAge, "genders", q.Genders,
+			"Coordinates", user.Location.CoordinatesFloat64Slice(), "maxDistance", maxDistance, "ranked", *q.Ranked,
+			"limit", q.Limit, "err", err)
 		return nil, err
 	}
-	return profiles, nil
+	for _, p := range profiles {
+		p.DistanceFromMe = q.Unit.roundFromMeters(p.DistanceFromMe)
+	}
+	if next != nil {
+		next.Ranked, next.Rank = *q.Ranked, rank
+	}
+	return &DiscoverResult{
+		Profiles:   profiles,
+		NextCursor: encodeCursor(next),
+		Unit:       q.Unit,
+	}, nil
 }
 
-func (s *Service) rankedDiscover(ctx context.Context, ranked bool, swipeIDs []int32) (*Rank, error) {
-	if !ranked || len(swipeIDs) == 0 {
+// hiddenIDs returns the users that must never be matched with ID again: unmatched users and users blocked by or
+// blocking ID. Store.Discover leaves them out by itself.
+func (s *Service) hiddenIDs(ctx context.Context, ID int32) ([]int32, error) {
+	unmatchedIDs, err := s.store.GetUnmatchedIDs(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	blockedIDs, err := s.store.GetBlockedIDs(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	return append(unmatchedIDs, blockedIDs...), nil
+}
+
+// rankedDiscover ranks on the users ID swiped yes, the no swipes do not count.
+func (s *Service) rankedDiscover(ctx context.Context, ranked bool, ID int32, after *DiscoverCursor) (*Rank, error) {
+	if !ranked {
 		return nil, nil
 	}
-	return s.store.GetRankByIDs(ctx, swipeIDs)
+	// the next pages keep the rank of the first one
+	if after != nil && after.Ranked {
+		return after.Rank, nil
+	}
+	yesSwipeIDs, err := s.store.GetYesSwipeIDs(ctx, ID)
+	if err != nil || len(yesSwipeIDs) == 0 {
+		return nil, err
+	}
+	return s.store.GetRankByIDs(ctx, yesSwipeIDs)
 }
 
 func (s *Service) Swipe(ctx context.Context, ID, swipedID int32, ok bool) (bool, error) {
+	// a yes swipe on yourself would match your own swipe
+	if ID == swipedID {
+		return false, ValidationError{"id": "cannot swipe yourself"}
+	}
 	_, err := s.store.GetUser(ctx, ID)
 	if err != nil {
 		if !errors.Is(err, ErrUserNotFound) {
@@ -110,16 +396,217 @@ func (s *Service) Swipe(ctx context.Context, ID, swipedID int32, ok bool) (bool,
 		}
 		return false, err
 	}
+	// swiping an unknown or deleted user would leave a swipe no purge erases
+	swiped, err := s.store.GetUser(ctx, swipedID)
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("Swipe GetUser", "swipedID", swipedID, "err", err)
+		}
+		return false, err
+	}
+	if swiped.DeletedAt != nil {
+		return false, ErrUserNotFound
+	}
 	if err = s.store.Swipe(ctx, ID, &Swipe{ID: swipedID, OK: ok}); err != nil {
 		slog.Error("Swipe", "ID", ID, "swipedID", swipedID, "err", err)
 		return false, err
 	}
-	if ok {
-		ok, err = s.store.Match(ctx, ID, swipedID)
-		if err != nil {
-			slog.Error("Swipe Match", "ID", ID, "swipedID", swipedID, "err", err)
-			return false, err
+	if !ok {
+		return false, nil
+	}
+	ok, err = s.store.Match(ctx, ID, swipedID)
+	if err != nil {
+		slog.Error("Swipe Match", "ID", ID, "swipedID", swipedID, "err", err)
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+	hiddenIDs, err := s.hiddenIDs(ctx, ID)
+	if err != nil {
+		slog.Error("Swipe hiddenIDs", "ID", ID, "err", err)
+		return false, err
+	}
+	if slices.Contains(hiddenIDs, swipedID) {
+		return false, nil
+	}
+	// both users may swipe each other at the same time, CreateMatch is idempotent so the match is recorded once
+	if _, err = s.store.CreateMatch(ctx, NewMatch(ID, swipedID, time.Now().UTC())); err != nil {
+		slog.Error("Swipe CreateMatch", "ID", ID, "swipedID", swipedID, "err", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Service) GetMatches(ctx context.Context, ID int32, q *MatchesQuery) (*MatchesResult, error) {
+	after, err := decodeCursor[MatchesCursor](q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	matches, next, err := s.store.GetMatches(ctx, ID, q.Limit, after)
+	if err != nil {
+		slog.Error("GetMatches", "ID", ID, "limit", q.Limit, "err", err)
+		return nil, err
+	}
+	return &MatchesResult{
+		Matches:    matches,
+		NextCursor: encodeCursor(next),
+	}, nil
+}
+
+func (s *Service) Unmatch(ctx context.Context, ID int32, matchID string) error {
+	match, err := s.store.GetMatch(ctx, matchID)
+	if err != nil {
+		if !errors.Is(err, ErrMatchNotFound) {
+			slog.Error("Unmatch GetMatch", "ID", ID, "matchID", matchID, "err", err)
+		}
+		return err
+	}
+	if !slices.Contains(match.UserIDs, ID) {
+		return ErrMatchNotFound
+	}
+	unmatch := &Unmatch{
+		MatchID:     match.ID,
+		UserIDs:     match.UserIDs,
+		InitiatorID: ID,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err = s.store.Unmatch(ctx, unmatch); err != nil {
+		slog.Error("Unmatch", "ID", ID, "matchID", matchID, "err", err)
+		return err
+	}
+	return nil
+}
+
+// Block hides both users from each other and removes their match if they had one.
+func (s *Service) Block(ctx context.Context, ID, blockedID int32) error {
+	if ID == blockedID {
+		return ValidationError{"id": "cannot block yourself"}
+	}
+	if _, err := s.store.GetUser(ctx, blockedID); err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("Block GetUser", "blockedID", blockedID, "err", err)
+		}
+		return err
+	}
+	now := time.Now().UTC()
+	if err := s.store.Block(ctx, &Block{BlockerID: ID, BlockedID: blockedID, CreatedAt: now}); err != nil {
+		slog.Error("Block", "ID", ID, "blockedID", blockedID, "err", err)
+		return err
+	}
+
+	match, err := s.store.GetMatch(ctx, NewMatch(ID, blockedID, now).ID)
+	switch {
+	case errors.Is(err, ErrMatchNotFound):
+		return nil
+	case err != nil:
+		slog.Error("Block GetMatch", "ID", ID, "blockedID", blockedID, "err", err)
+		return err
+	}
+	unmatch := &Unmatch{
+		MatchID:     match.ID,
+		UserIDs:     match.UserIDs,
+		InitiatorID: ID,
+		CreatedAt:   now,
+	}
+	if err = s.store.Unmatch(ctx, unmatch); err != nil {
+		slog.Error("Block Unmatch", "ID", ID, "blockedID", blockedID, "err", err)
+		return err
+	}
+	return nil
+}
+
+func (s *Service) Report(ctx context.Context, report *Report) (*Report, error) {
+	if err := report.validate(); err != nil {
+		return nil, err
+	}
+	if _, err := s.store.GetUser(ctx, report.ReportedID); err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("Report GetUser", "reportedID", report.ReportedID, "err", err)
 		}
+		return nil, err
+	}
+	report.Status = ReportStatusOpen
+	report.CreatedAt = time.Now().UTC()
+	createdReport, err := s.store.CreateReport(ctx, report)
+	if err != nil {
+		slog.Error("Report CreateReport", "reporterID", report.ReporterID, "reportedID", report.ReportedID, "err", err)
+		return nil, err
+	}
+	return createdReport, nil
+}
+
+func (s *Service) ListReports(ctx context.Context, q *ReportsQuery) (*ReportsResult, error) {
+	after, err := decodeCursor[ReportsCursor](q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	filter := &ReportFilter{
+		Status:     q.Status,
+		Reason:     q.Reason,
+		ReporterID: q.ReporterID,
+		ReportedID: q.ReportedID,
+		Limit:      q.Limit,
+		After:      after,
+	}
+	reports, next, err := s.store.ListReports(ctx, filter)
+	if err != nil {
+		slog.Error("ListReports",
+			"status", q.Status, "reason", q.Reason, "reporterID", q.ReporterID, "reportedID", q.ReportedID,
+			"limit", q.Limit, "err", err)
+		return nil, err
+	}
+	return &ReportsResult{
+		Reports:    reports,
+		NextCursor: encodeCursor(next),
+	}, nil
+}
+
+// GetUserHistory returns the reports made by and about a user along with the moderation decisions taken on them.
+func (s *Service) GetUserHistory(ctx context.Context, ID int32, q *HistoryQuery) (*UserHistory, error) {
+	user, err := s.GetUser(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	received, nextReceived, err := s.store.ListReports(ctx, &ReportFilter{ReportedID: ID, Limit: q.Limit})
+	if err != nil {
+		slog.Error("GetUserHistory ListReports received", "ID", ID, "err", err)
+		return nil, err
+	}
+	filed, nextFiled, err := s.store.ListReports(ctx, &ReportFilter{ReporterID: ID, Limit: q.Limit})
+	if err != nil {
+		slog.Error("GetUserHistory ListReports filed", "ID", ID, "err", err)
+		return nil, err
+	}
+	moderations, err := s.store.GetModerations(ctx, ID)
+	if err != nil {
+		slog.Error("GetUserHistory GetModerations", "ID", ID, "err", err)
+		return nil, err
+	}
+	return &UserHistory{
+		User:                      user,
+		ReportsReceived:           received,
+		ReportsReceivedNextCursor: encodeCursor(nextReceived),
+		ReportsFiled:              filed,
+		ReportsFiledNextCursor:    encodeCursor(nextFiled),
+		Moderations:               moderations,
+	}, nil
+}
+
+// Moderate suspends, bans or reinstates a user. Banned and suspended users cannot log in and are not discovered.
+func (s *Service) Moderate(ctx context.Context, m *Moderation) (*User, error) {
+	now := time.Now().UTC()
+	if err := m.validate(now); err != nil {
+		return nil, err
+	}
+	m.CreatedAt = now
+	user, err := s.store.Moderate(ctx, m)
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("Moderate", "ID", m.UserID, "moderatorID", m.ModeratorID, "status", m.Status, "err", err)
+		}
+		return nil, err
 	}
-	return ok, nil
+	user.Password = ""
+	return user, nil
 }
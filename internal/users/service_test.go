@@ -2,7 +2,9 @@ package users
 
 import (
 	"context"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/brianvoe/gofakeit/v7"
 	"github.com/golang/mock/gomock"
@@ -54,6 +56,91 @@ func TestService_CreateUser(t *testing.T) {
 	})
 }
 
+func TestService_Register(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	faker := gofakeit.New(10)
+	userService := NewService(faker, store)
+	ctx := context.Background()
+
+	newRegistration := func() *Registration {
+		return &Registration{
+			Email:    "Jane.Doe@Example.com ",
+			Password: "Sup3rSecret",
+			Name:     "Jane Doe",
+			Gender:   "female",
+			DOB:      time.Now().AddDate(-30, 0, -1),
+			Location: &Coordinates{Longitude: -0.12, Latitude: 51.5},
+		}
+	}
+
+	t.Run("invalid fields should return a validation error", func(t *testing.T) {
+		// given
+		r := &Registration{
+			Email:    "not-an-email",
+			Password: "short",
+			Gender:   "other",
+			DOB:      time.Now().AddDate(-17, 0, 0),
+			Location: &Coordinates{Longitude: 200, Latitude: 51.5},
+		}
+
+		// when
+		_, err := userService.Register(ctx, r)
+
+		// then
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Equal(t, []string{"dob", "email", "gender", "location.longitude", "name", "password"},
+			sortedKeys(validationErr))
+	})
+
+	t.Run("duplicated email should return ErrEmailTaken", func(t *testing.T) {
+		// given
+		r := newRegistration()
+		store.EXPECT().GetUserByEmail(ctx, "jane.doe@example.com").Return(NewFakeUser(faker), nil)
+
+		// when
+		_, err := userService.Register(ctx, r)
+
+		// then
+		require.ErrorIs(t, err, ErrEmailTaken)
+	})
+
+	t.Run("successful registration", func(t *testing.T) {
+		// given
+		r := newRegistration()
+		store.EXPECT().GetUserByEmail(ctx, "jane.doe@example.com").Return(nil, ErrUserNotFound)
+		store.EXPECT().CreateUser(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, u *User) (*User, error) {
+			require.True(t, verifyPassword(u.Password, "Sup3rSecret"))
+			u.ID = 7
+			return u, nil
+		})
+
+		// when
+		user, err := userService.Register(ctx, r)
+		require.NoError(t, err)
+
+		// then
+		require.Equal(t, int32(7), user.ID)
+		require.Equal(t, "jane.doe@example.com", user.Email)
+		require.Empty(t, user.Password)
+		require.Equal(t, int32(30), user.Age.Value)
+		require.Equal(t, []float64{-0.12, 51.5}, user.Location.CoordinatesFloat64Slice())
+	})
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func TestService_Login(t *testing.T) {
 	controller := gomock.NewController(t)
 	defer controller.Finish()
@@ -72,7 +159,7 @@ func TestService_Login(t *testing.T) {
 		}
 		store.EXPECT().GetUserByEmail(ctx, user.Email).Return(user, nil)
 
-		loggedUser, err := userService.Login(ctx, user.Email, "diff.password")
+		loggedUser, err := userService.Login(ctx, user.Email, "diff.password", "")
 		require.ErrorIs(t, err, ErrPasswordMismatch)
 		require.Nil(t, loggedUser)
 	})
@@ -84,7 +171,7 @@ func TestService_Login(t *testing.T) {
 		}
 		store.EXPECT().GetUserByEmail(ctx, "some.email@gmail.com").Return(nil, ErrUserNotFound)
 
-		loggedUser, err := userService.Login(ctx, "some.email@gmail.com", user.Password)
+		loggedUser, err := userService.Login(ctx, "some.email@gmail.com", user.Password, "")
 		require.ErrorIs(t, err, ErrUserNotFound)
 		require.Nil(t, loggedUser)
 	})
@@ -98,9 +185,185 @@ func TestService_Login(t *testing.T) {
 		}
 		store.EXPECT().GetUserByEmail(ctx, user.Email).Return(user, nil)
 
-		loggedUser, err := userService.Login(ctx, user.Email, originalPassword)
+		loggedUser, err := userService.Login(ctx, user.Email, originalPassword, "")
 		require.NoError(t, err)
 		require.Equal(t, user, loggedUser)
+		require.Equal(t, RoleUser, loggedUser.Role)
+	})
+
+	t.Run("banned user cannot login", func(t *testing.T) {
+		user := NewFakeUser(faker)
+		originalPassword := user.Password
+		user.Password = hashPassword(user.Password)
+		user.Moderation = &Moderation{UserID: user.ID, Status: ModerationStatusBanned, Reason: "spam"}
+		store.EXPECT().GetUserByEmail(ctx, user.Email).Return(user, nil)
+
+		loggedUser, err := userService.Login(ctx, user.Email, originalPassword, "")
+		require.ErrorIs(t, err, ErrUserBanned)
+		require.Nil(t, loggedUser)
+	})
+
+	t.Run("suspended user cannot login until the suspension ends", func(t *testing.T) {
+		user := NewFakeUser(faker)
+		originalPassword := user.Password
+		user.Password = hashPassword(user.Password)
+		until := time.Now().Add(time.Hour)
+		user.Moderation = &Moderation{UserID: user.ID, Status: ModerationStatusSuspended, Reason: "spam", Until: &until}
+		store.EXPECT().GetUserByEmail(ctx, user.Email).Return(user, nil)
+
+		loggedUser, err := userService.Login(ctx, user.Email, originalPassword, "")
+		require.ErrorIs(t, err, ErrUserSuspended)
+		require.Nil(t, loggedUser)
+	})
+
+	t.Run("ended suspension is lifted at login", func(t *testing.T) {
+		user := NewFakeUser(faker)
+		originalPassword := user.Password
+		user.Password = hashPassword(user.Password)
+		until := time.Now().Add(-time.Hour)
+		user.Moderation = &Moderation{UserID: user.ID, Status: ModerationStatusSuspended, Reason: "spam", Until: &until}
+		store.EXPECT().GetUserByEmail(ctx, user.Email).Return(user, nil)
+		store.EXPECT().Moderate(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, m *Moderation) (*User, error) {
+			require.Equal(t, user.ID, m.UserID)
+			require.Equal(t, ModerationStatusActive, m.Status)
+			require.Zero(t, m.ModeratorID)
+			user.Moderation = m
+			return user, nil
+		})
+
+		loggedUser, err := userService.Login(ctx, user.Email, originalPassword, "")
+		require.NoError(t, err)
+		require.Equal(t, ModerationStatusActive, loggedUser.Moderation.Status)
+	})
+}
+
+func TestService_UpdateUser(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	faker := gofakeit.New(10)
+	userService := NewService(faker, store)
+	ctx := context.Background()
+
+	t.Run("invalid fields should return a validation error", func(t *testing.T) {
+		// given
+		name := ""
+		dob := time.Now().AddDate(-10, 0, 0)
+		update := &ProfileUpdate{Name: &name, DOB: &dob}
+
+		// when
+		_, err := userService.UpdateUser(ctx, 1, update)
+
+		// then
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Equal(t, []string{"dob", "name"}, sortedKeys(validationErr))
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		// given
+		bio := "hello"
+		store.EXPECT().UpdateUser(ctx, int32(1), &UserUpdate{Bio: &bio}).Return(nil, ErrUserNotFound)
+
+		// when
+		_, err := userService.UpdateUser(ctx, 1, &ProfileUpdate{Bio: &bio})
+
+		// then
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+
+	t.Run("successful update recomputes age", func(t *testing.T) {
+		// given
+		user := NewFakeUser(faker)
+		user.Password = hashPassword(user.Password)
+		dob := time.Now().AddDate(-25, 0, -1)
+		expectedUpdate := &UserUpdate{Age: &Age{Value: 25, DOB: dob}}
+		store.EXPECT().UpdateUser(ctx, int32(1), expectedUpdate).Return(user, nil)
+
+		// when
+		updatedUser, err := userService.UpdateUser(ctx, 1, &ProfileUpdate{DOB: &dob})
+		require.NoError(t, err)
+
+		// then
+		require.Empty(t, updatedUser.Password)
+	})
+}
+
+func TestService_UpdateLocation(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	faker := gofakeit.New(10)
+	userService := NewService(faker, store)
+	ctx := context.Background()
+
+	t.Run("out of range coordinates should return a validation error", func(t *testing.T) {
+		// when
+		_, err := userService.UpdateLocation(ctx, 1, &Coordinates{Longitude: 181, Latitude: -91})
+
+		// then
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Equal(t, []string{"location.latitude", "location.longitude"}, sortedKeys(validationErr))
+	})
+
+	t.Run("successful location update", func(t *testing.T) {
+		// given
+		user := NewFakeUser(faker)
+		coordinates := &Coordinates{Longitude: 2.35, Latitude: 48.85}
+		user.Location = newPointLocation(coordinates)
+		store.EXPECT().UpdateUser(ctx, int32(1), &UserUpdate{Location: newPointLocation(coordinates)}).Return(user, nil)
+
+		// when
+		updatedUser, err := userService.UpdateLocation(ctx, 1, coordinates)
+		require.NoError(t, err)
+
+		// then
+		require.Equal(t, []float64{2.35, 48.85}, updatedUser.Location.CoordinatesFloat64Slice())
+	})
+}
+
+func TestService_UpdatePreferences(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	faker := gofakeit.New(10)
+	userService := NewService(faker, store)
+	ctx := context.Background()
+
+	t.Run("invalid preferences should return a validation error", func(t *testing.T) {
+		// given
+		p := &Preferences{Genders: []string{"female", "other"}, MinAge: 40, MaxAge: 30, MaxDistance: -1, Unit: "ly"}
+
+		// when
+		_, err := userService.UpdatePreferences(ctx, 1, p)
+
+		// then
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Equal(t, []string{"genders", "maxAge", "maxDistance", "unit"}, sortedKeys(validationErr))
+	})
+
+	t.Run("successful update defaults the unit", func(t *testing.T) {
+		// given
+		p := &Preferences{Genders: []string{"female", "male"}, MinAge: 20, MaxDistance: 30}
+		expected := &Preferences{Genders: []string{"female", "male"}, MinAge: 20, MaxDistance: 30, Unit: Kilometers}
+		user := NewFakeUser(faker)
+		user.Preferences = expected
+		store.EXPECT().UpdateUser(ctx, int32(1), &UserUpdate{Preferences: expected}).Return(user, nil)
+
+		// when
+		preferences, err := userService.UpdatePreferences(ctx, 1, p)
+		require.NoError(t, err)
+
+		// then
+		require.Equal(t, expected, preferences)
 	})
 }
 
@@ -118,26 +381,27 @@ func TestService_Discover(t *testing.T) {
 		// given
 		fiftyUsers := createFiftyUsers(faker)
 		user := fiftyUsers[0]
-		swipes := []*Swipe{
-			{ID: fiftyUsers[3].ID, OK: false},
-			{ID: fiftyUsers[5].ID, OK: false},
-			{ID: fiftyUsers[8].ID, OK: true},
-		}
-		user.Swipes = swipes
+		yesSwipeIDs := []int32{fiftyUsers[3].ID, fiftyUsers[5].ID, fiftyUsers[8].ID}
 		rank := &Rank{AvgAge: 40, MostCommonGender: "female"}
+		ranked := true
 		ID := fiftyUsers[0].ID
 		discoveredProfiles := usersToProfiles(fiftyUsers[1:])
 		store.EXPECT().GetUser(ctx, ID).Return(user, nil)
-		store.EXPECT().GetRankByIDs(ctx, user.swipeIDs()).Return(rank, nil)
-		store.EXPECT().Discover(ctx, ID, int32(20), int32(40), "female", user.swipeIDs(), user.Location, rank).
-			Return(discoveredProfiles, nil)
+		store.EXPECT().GetYesSwipeIDs(ctx, ID).Return(yesSwipeIDs, nil)
+		store.EXPECT().GetRankByIDs(ctx, yesSwipeIDs).Return(rank, nil)
+		store.EXPECT().Discover(ctx, &DiscoverFilter{
+			ID: ID, RequesterGender: user.Gender, RequesterAge: user.Age.Value,
+			MinAge: 20, MaxAge: 40, Genders: []string{"female"}, Location: user.Location, Rank: rank,
+		}).Return(discoveredProfiles, nil, nil)
 
 		// when
-		profiles, err := userService.Discover(ctx, ID, 20, 40, "female", true)
+		result, err := userService.Discover(ctx, ID,
+			&DiscoverQuery{MinAge: 20, MaxAge: 40, Genders: []string{"female"}, Ranked: &ranked})
 		require.NoError(t, err)
 
 		//  then
-		require.Equal(t, discoveredProfiles, profiles)
+		require.Equal(t, discoveredProfiles, result.Profiles)
+		require.Empty(t, result.NextCursor)
 	})
 
 	t.Run("successful discover min and max filter", func(t *testing.T) {
@@ -147,15 +411,17 @@ func TestService_Discover(t *testing.T) {
 		ID := fiftyUsers[0].ID
 		discoveredProfiles := usersToProfiles(fiftyUsers[1:])
 		store.EXPECT().GetUser(ctx, ID).Return(user, nil)
-		store.EXPECT().Discover(ctx, ID, int32(20), int32(40), "", []int32{}, user.Location, nil).
-			Return(discoveredProfiles, nil)
+		store.EXPECT().Discover(ctx, &DiscoverFilter{
+			ID: ID, RequesterGender: user.Gender, RequesterAge: user.Age.Value,
+			MinAge: 20, MaxAge: 40, Location: user.Location,
+		}).Return(discoveredProfiles, nil, nil)
 
 		// when
-		profiles, err := userService.Discover(ctx, ID, 20, 40, "", false)
+		result, err := userService.Discover(ctx, ID, &DiscoverQuery{MinAge: 20, MaxAge: 40})
 		require.NoError(t, err)
 
 		//  then
-		require.Equal(t, discoveredProfiles, profiles)
+		require.Equal(t, discoveredProfiles, result.Profiles)
 	})
 
 	t.Run("successful discover gender filter", func(t *testing.T) {
@@ -165,15 +431,17 @@ func TestService_Discover(t *testing.T) {
 		ID := fiftyUsers[0].ID
 		discoveredProfiles := usersToProfiles(fiftyUsers[1:])
 		store.EXPECT().GetUser(ctx, ID).Return(user, nil)
-		store.EXPECT().Discover(ctx, ID, int32(0), int32(0), "male", []int32{}, user.Location, nil).
-			Return(discoveredProfiles, nil)
+		store.EXPECT().Discover(ctx, &DiscoverFilter{
+			ID: ID, RequesterGender: user.Gender, RequesterAge: user.Age.Value,
+			Genders: []string{"male"}, Location: user.Location,
+		}).Return(discoveredProfiles, nil, nil)
 
 		// when
-		profiles, err := userService.Discover(ctx, ID, int32(0), int32(0), "male", false)
+		result, err := userService.Discover(ctx, ID, &DiscoverQuery{Genders: []string{"male"}})
 		require.NoError(t, err)
 
 		//  then
-		require.Equal(t, discoveredProfiles, profiles)
+		require.Equal(t, discoveredProfiles, result.Profiles)
 	})
 
 	t.Run("successful discover no filter", func(t *testing.T) {
@@ -183,15 +451,200 @@ func TestService_Discover(t *testing.T) {
 		ID := fiftyUsers[0].ID
 		discoveredProfiles := usersToProfiles(fiftyUsers[1:])
 		store.EXPECT().GetUser(ctx, ID).Return(user, nil)
-		store.EXPECT().Discover(ctx, ID, int32(0), int32(0), "", []int32{}, user.Location, nil).
-			Return(discoveredProfiles, nil)
+		store.EXPECT().Discover(ctx, &DiscoverFilter{
+			ID: ID, RequesterGender: user.Gender, RequesterAge: user.Age.Value,
+			Location: user.Location,
+		}).Return(discoveredProfiles, nil, nil)
+
+		// when
+		result, err := userService.Discover(ctx, ID, &DiscoverQuery{})
+		require.NoError(t, err)
+
+		//  then
+		require.Equal(t, discoveredProfiles, result.Profiles)
+	})
+
+	t.Run("pages are chained with an opaque cursor", func(t *testing.T) {
+		// given
+		fiftyUsers := createFiftyUsers(faker)
+		user := fiftyUsers[0]
+		ID := fiftyUsers[0].ID
+		firstPage := usersToProfiles(fiftyUsers[1:11])
+		secondPage := usersToProfiles(fiftyUsers[11:21])
+		next := &DiscoverCursor{DistanceFromMe: 1234.5, ID: fiftyUsers[10].ID}
+		store.EXPECT().GetUser(ctx, ID).Return(user, nil).Times(2)
+		store.EXPECT().Discover(ctx, &DiscoverFilter{
+			ID: ID, RequesterGender: user.Gender, RequesterAge: user.Age.Value,
+			Location: user.Location, Limit: 10,
+		}).Return(firstPage, next, nil)
+		store.EXPECT().Discover(ctx, &DiscoverFilter{
+			ID: ID, RequesterGender: user.Gender, RequesterAge: user.Age.Value,
+			Location: user.Location, Limit: 10, After: next,
+		}).Return(secondPage, nil, nil)
+
+		// when
+		result, err := userService.Discover(ctx, ID, &DiscoverQuery{Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, firstPage, result.Profiles)
+		require.NotEmpty(t, result.NextCursor)
+
+		result, err = userService.Discover(ctx, ID, &DiscoverQuery{Limit: 10, Cursor: result.NextCursor})
+		require.NoError(t, err)
+
+		//  then
+		require.Equal(t, secondPage, result.Profiles)
+		require.Empty(t, result.NextCursor)
+	})
+
+	t.Run("ranked pages keep the rank of the first page", func(t *testing.T) {
+		// given
+		fiftyUsers := createFiftyUsers(faker)
+		user := fiftyUsers[0]
+		ID := fiftyUsers[0].ID
+		ranked := true
+		rank := &Rank{AvgAge: 31, MostCommonGender: "male"}
+		next := &DiscoverCursor{GenderSort: 1, AgeSort: 2, DistanceFromMe: 1234.5, ID: fiftyUsers[10].ID}
+		store.EXPECT().GetUser(ctx, ID).Return(user, nil).Times(2)
+		// only the first page computes the rank, a yes swipe in between does not change the order
+		store.EXPECT().GetYesSwipeIDs(ctx, ID).Return([]int32{3}, nil)
+		store.EXPECT().GetRankByIDs(ctx, []int32{3}).Return(rank, nil)
+		store.EXPECT().Discover(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, filter *DiscoverFilter) ([]*Profile, *DiscoverCursor, error) {
+				require.Equal(t, rank, filter.Rank)
+				require.Nil(t, filter.After)
+				return usersToProfiles(fiftyUsers[1:11]), next, nil
+			})
+		store.EXPECT().Discover(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, filter *DiscoverFilter) ([]*Profile, *DiscoverCursor, error) {
+				require.Equal(t, rank, filter.Rank)
+				require.Equal(t, &DiscoverCursor{
+					GenderSort: 1, AgeSort: 2, DistanceFromMe: 1234.5, ID: fiftyUsers[10].ID, Ranked: true, Rank: rank,
+				}, filter.After)
+				return usersToProfiles(fiftyUsers[11:21]), nil, nil
+			})
+
+		// when
+		result, err := userService.Discover(ctx, ID, &DiscoverQuery{Limit: 10, Ranked: &ranked})
+		require.NoError(t, err)
+		result, err = userService.Discover(ctx, ID, &DiscoverQuery{Limit: 10, Ranked: &ranked, Cursor: result.NextCursor})
+		require.NoError(t, err)
+
+		//  then
+		require.Empty(t, result.NextCursor)
+	})
+
+	t.Run("max distance and distances use the requested unit", func(t *testing.T) {
+		// given
+		fiftyUsers := createFiftyUsers(faker)
+		user := fiftyUsers[0]
+		ID := fiftyUsers[0].ID
+		discoveredProfiles := []*Profile{{ID: 2, DistanceFromMe: 3219}, {ID: 3, DistanceFromMe: 16093}}
+		store.EXPECT().GetUser(ctx, ID).Return(user, nil)
+		store.EXPECT().Discover(ctx, &DiscoverFilter{
+			ID: ID, RequesterGender: user.Gender, RequesterAge: user.Age.Value,
+			Location: user.Location, MaxDistance: 10 * metersPerMile,
+		}).Return(discoveredProfiles, nil, nil)
+
+		// when
+		result, err := userService.Discover(ctx, ID, &DiscoverQuery{MaxDistance: 10, Unit: Miles})
+		require.NoError(t, err)
+
+		//  then
+		require.Equal(t, Miles, result.Unit)
+		require.Equal(t, []*Profile{{ID: 2, DistanceFromMe: 2}, {ID: 3, DistanceFromMe: 10}}, result.Profiles)
+	})
+
+	t.Run("saved preferences are used when the query omits them", func(t *testing.T) {
+		// given
+		fiftyUsers := createFiftyUsers(faker)
+		user := fiftyUsers[0]
+		user.Preferences = &Preferences{
+			Genders: []string{"female"}, MinAge: 25, MaxAge: 35, MaxDistance: 50, Unit: Kilometers, Ranked: false,
+		}
+		ID := fiftyUsers[0].ID
+		discoveredProfiles := usersToProfiles(fiftyUsers[1:])
+		store.EXPECT().GetUser(ctx, ID).Return(user, nil)
+		store.EXPECT().Discover(ctx, &DiscoverFilter{
+			ID: ID, RequesterGender: user.Gender, RequesterAge: user.Age.Value,
+			MinAge: 30, MaxAge: 35, Genders: []string{"female"}, Location: user.Location,
+			MaxDistance: 50000,
+		}).Return(discoveredProfiles, nil, nil)
 
 		// when
-		profiles, err := userService.Discover(ctx, ID, int32(0), int32(0), "", false)
+		result, err := userService.Discover(ctx, ID, &DiscoverQuery{MinAge: 30})
 		require.NoError(t, err)
 
 		//  then
-		require.Equal(t, discoveredProfiles, profiles)
+		require.Equal(t, Kilometers, result.Unit)
+	})
+
+	t.Run("min age above the saved max age is rejected", func(t *testing.T) {
+		// given
+		fiftyUsers := createFiftyUsers(faker)
+		user := fiftyUsers[0]
+		user.Preferences = &Preferences{MinAge: 25, MaxAge: 35}
+		ID := fiftyUsers[0].ID
+		store.EXPECT().GetUser(ctx, ID).Return(user, nil)
+
+		// when
+		_, err := userService.Discover(ctx, ID, &DiscoverQuery{MinAge: 40})
+
+		//  then
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Contains(t, validationErr, "maxAge")
+	})
+
+	t.Run("saved max distance is converted to the requested unit", func(t *testing.T) {
+		// given
+		fiftyUsers := createFiftyUsers(faker)
+		user := fiftyUsers[0]
+		user.Preferences = &Preferences{MaxDistance: 10, Unit: Miles, Ranked: true}
+		ranked := false
+		ID := fiftyUsers[0].ID
+		store.EXPECT().GetUser(ctx, ID).Return(user, nil)
+		store.EXPECT().Discover(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, filter *DiscoverFilter) ([]*Profile, *DiscoverCursor, error) {
+				require.InDelta(t, 10*metersPerMile, filter.MaxDistance, 0.001)
+				require.Nil(t, filter.Rank)
+				return []*Profile{}, nil, nil
+			})
+
+		// when
+		result, err := userService.Discover(ctx, ID, &DiscoverQuery{Unit: Kilometers, Ranked: &ranked})
+		require.NoError(t, err)
+
+		//  then
+		require.Equal(t, Kilometers, result.Unit)
+	})
+
+	t.Run("ranked discover without yes swipes is not ranked", func(t *testing.T) {
+		// given
+		fiftyUsers := createFiftyUsers(faker)
+		user := fiftyUsers[0]
+		ranked := true
+		ID := fiftyUsers[0].ID
+		discoveredProfiles := usersToProfiles(fiftyUsers[1:])
+		store.EXPECT().GetUser(ctx, ID).Return(user, nil)
+		store.EXPECT().GetYesSwipeIDs(ctx, ID).Return([]int32{}, nil)
+		store.EXPECT().Discover(ctx, &DiscoverFilter{
+			ID: ID, RequesterGender: user.Gender, RequesterAge: user.Age.Value, Location: user.Location,
+		}).Return(discoveredProfiles, nil, nil)
+
+		// when
+		result, err := userService.Discover(ctx, ID, &DiscoverQuery{Ranked: &ranked})
+		require.NoError(t, err)
+
+		//  then
+		require.Equal(t, discoveredProfiles, result.Profiles)
+	})
+
+	t.Run("malformed cursor", func(t *testing.T) {
+		// when
+		_, err := userService.Discover(ctx, 1, &DiscoverQuery{Cursor: "not a cursor"})
+
+		//  then
+		require.ErrorIs(t, err, ErrInvalidCursor)
 	})
 }
 
@@ -233,6 +686,15 @@ func TestService_Swipe(t *testing.T) {
 	userService := NewService(faker, store)
 	ctx := context.Background()
 
+	t.Run("swiping yourself is rejected", func(t *testing.T) {
+		// when
+		matched, err := userService.Swipe(ctx, 7, 7, true)
+
+		// then
+		require.False(t, matched)
+		require.Equal(t, ValidationError{"id": "cannot swipe yourself"}, err)
+	})
+
 	t.Run("successful swipe yes with match", func(t *testing.T) {
 		// given
 		fiftyUsers := createFiftyUsers(faker)
@@ -241,9 +703,17 @@ func TestService_Swipe(t *testing.T) {
 		swipedUser := fiftyUsers[10]
 		swipe := &Swipe{ID: swipedID, OK: true}
 
-		store.EXPECT().GetUser(ctx, ID).Return(swipedUser, nil)
+		store.EXPECT().GetUser(ctx, ID).Return(fiftyUsers[0], nil)
+		store.EXPECT().GetUser(ctx, swipedID).Return(swipedUser, nil)
 		store.EXPECT().Swipe(ctx, ID, swipe).Return(nil)
 		store.EXPECT().Match(ctx, ID, swipedID).Return(true, nil)
+		store.EXPECT().GetUnmatchedIDs(ctx, ID).Return(nil, nil)
+		store.EXPECT().GetBlockedIDs(ctx, ID).Return(nil, nil)
+		store.EXPECT().CreateMatch(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, m *Match) (*Match, error) {
+			require.Equal(t, "0-10", m.ID)
+			require.Equal(t, []int32{ID, swipedID}, m.UserIDs)
+			return m, nil
+		})
 
 		// when
 		ok, err := userService.Swipe(ctx, ID, swipedID, true)
@@ -253,6 +723,28 @@ func TestService_Swipe(t *testing.T) {
 		require.Equal(t, true, ok)
 	})
 
+	t.Run("swipe yes on an unmatched user does not match again", func(t *testing.T) {
+		// given
+		fiftyUsers := createFiftyUsers(faker)
+		ID := fiftyUsers[0].ID
+		swipedID := fiftyUsers[10].ID
+		swipe := &Swipe{ID: swipedID, OK: true}
+
+		store.EXPECT().GetUser(ctx, ID).Return(fiftyUsers[0], nil)
+		store.EXPECT().GetUser(ctx, swipedID).Return(fiftyUsers[10], nil)
+		store.EXPECT().Swipe(ctx, ID, swipe).Return(nil)
+		store.EXPECT().Match(ctx, ID, swipedID).Return(true, nil)
+		store.EXPECT().GetUnmatchedIDs(ctx, ID).Return([]int32{swipedID}, nil)
+		store.EXPECT().GetBlockedIDs(ctx, ID).Return(nil, nil)
+
+		// when
+		ok, err := userService.Swipe(ctx, ID, swipedID, true)
+		require.NoError(t, err)
+
+		//  then
+		require.False(t, ok)
+	})
+
 	t.Run("successful swipe yes with no match", func(t *testing.T) {
 		// given
 		fiftyUsers := createFiftyUsers(faker)
@@ -261,7 +753,8 @@ func TestService_Swipe(t *testing.T) {
 		swipedUser := fiftyUsers[10]
 		swipe := &Swipe{ID: swipedID, OK: true}
 
-		store.EXPECT().GetUser(ctx, ID).Return(swipedUser, nil)
+		store.EXPECT().GetUser(ctx, ID).Return(fiftyUsers[0], nil)
+		store.EXPECT().GetUser(ctx, swipedID).Return(swipedUser, nil)
 		store.EXPECT().Swipe(ctx, ID, swipe).Return(nil)
 		store.EXPECT().Match(ctx, ID, swipedID).Return(false, nil)
 
@@ -281,7 +774,8 @@ func TestService_Swipe(t *testing.T) {
 		swipedUser := fiftyUsers[10]
 		swipe := &Swipe{ID: swipedID, OK: false}
 
-		store.EXPECT().GetUser(ctx, ID).Return(swipedUser, nil)
+		store.EXPECT().GetUser(ctx, ID).Return(fiftyUsers[0], nil)
+		store.EXPECT().GetUser(ctx, swipedID).Return(swipedUser, nil)
 		store.EXPECT().Swipe(ctx, ID, swipe).Return(nil)
 
 		// when
@@ -291,4 +785,364 @@ func TestService_Swipe(t *testing.T) {
 		//  then
 		require.Equal(t, false, ok)
 	})
+
+	t.Run("swipe on a deleted user is refused", func(t *testing.T) {
+		// given
+		fiftyUsers := createFiftyUsers(faker)
+		ID := fiftyUsers[0].ID
+		swipedUser := fiftyUsers[10]
+		deletedAt := time.Now()
+		swipedUser.DeletedAt = &deletedAt
+
+		store.EXPECT().GetUser(ctx, ID).Return(fiftyUsers[0], nil)
+		store.EXPECT().GetUser(ctx, swipedUser.ID).Return(swipedUser, nil)
+
+		// when
+		_, err := userService.Swipe(ctx, ID, swipedUser.ID, true)
+
+		// then
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+
+	t.Run("swipe on an unknown user is refused", func(t *testing.T) {
+		// given
+		fiftyUsers := createFiftyUsers(faker)
+		ID := fiftyUsers[0].ID
+
+		store.EXPECT().GetUser(ctx, ID).Return(fiftyUsers[0], nil)
+		store.EXPECT().GetUser(ctx, int32(999)).Return(nil, ErrUserNotFound)
+
+		// when
+		_, err := userService.Swipe(ctx, ID, 999, true)
+
+		// then
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+}
+
+func TestNewMatch(t *testing.T) {
+	now := time.Now()
+
+	// when
+	match := NewMatch(12, 3, now)
+
+	// then
+	require.Equal(t, &Match{ID: "3-12", UserIDs: []int32{3, 12}, CreatedAt: now}, match)
+	require.Equal(t, match, NewMatch(3, 12, now))
+}
+
+func TestService_GetMatches(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	faker := gofakeit.New(10)
+	userService := NewService(faker, store)
+	ctx := context.Background()
+
+	t.Run("pages are chained with an opaque cursor", func(t *testing.T) {
+		// given
+		now := time.Now().UTC()
+		firstPage := []*Match{NewMatch(1, 2, now), NewMatch(1, 3, now.Add(-time.Minute))}
+		secondPage := []*Match{NewMatch(1, 4, now.Add(-time.Hour))}
+		next := &MatchesCursor{CreatedAt: firstPage[1].CreatedAt, ID: firstPage[1].ID}
+		store.EXPECT().GetMatches(ctx, int32(1), int32(2), nil).Return(firstPage, next, nil)
+		store.EXPECT().GetMatches(ctx, int32(1), int32(2), next).Return(secondPage, nil, nil)
+
+		// when
+		result, err := userService.GetMatches(ctx, 1, &MatchesQuery{Limit: 2})
+		require.NoError(t, err)
+		require.Equal(t, firstPage, result.Matches)
+
+		result, err = userService.GetMatches(ctx, 1, &MatchesQuery{Limit: 2, Cursor: result.NextCursor})
+		require.NoError(t, err)
+
+		// then
+		require.Equal(t, secondPage, result.Matches)
+		require.Empty(t, result.NextCursor)
+	})
+
+	t.Run("malformed cursor", func(t *testing.T) {
+		// when
+		_, err := userService.GetMatches(ctx, 1, &MatchesQuery{Cursor: "%%%"})
+
+		// then
+		require.ErrorIs(t, err, ErrInvalidCursor)
+	})
+}
+
+func TestService_Unmatch(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	faker := gofakeit.New(10)
+	userService := NewService(faker, store)
+	ctx := context.Background()
+
+	t.Run("match not found", func(t *testing.T) {
+		// given
+		store.EXPECT().GetMatch(ctx, "1-2").Return(nil, ErrMatchNotFound)
+
+		// when
+		err := userService.Unmatch(ctx, 1, "1-2")
+
+		// then
+		require.ErrorIs(t, err, ErrMatchNotFound)
+	})
+
+	t.Run("only a user of the match can unmatch", func(t *testing.T) {
+		// given
+		store.EXPECT().GetMatch(ctx, "1-2").Return(NewMatch(1, 2, time.Now()), nil)
+
+		// when
+		err := userService.Unmatch(ctx, 3, "1-2")
+
+		// then
+		require.ErrorIs(t, err, ErrMatchNotFound)
+	})
+
+	t.Run("successful unmatch records the initiator", func(t *testing.T) {
+		// given
+		store.EXPECT().GetMatch(ctx, "1-2").Return(NewMatch(1, 2, time.Now()), nil)
+		store.EXPECT().Unmatch(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, u *Unmatch) error {
+			require.Equal(t, "1-2", u.MatchID)
+			require.Equal(t, []int32{1, 2}, u.UserIDs)
+			require.Equal(t, int32(2), u.InitiatorID)
+			require.False(t, u.CreatedAt.IsZero())
+			return nil
+		})
+
+		// when
+		err := userService.Unmatch(ctx, 2, "1-2")
+
+		// then
+		require.NoError(t, err)
+	})
+}
+
+func TestService_Block(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	faker := gofakeit.New(10)
+	userService := NewService(faker, store)
+	ctx := context.Background()
+
+	t.Run("cannot block yourself", func(t *testing.T) {
+		// when
+		err := userService.Block(ctx, 1, 1)
+
+		// then
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+	})
+
+	t.Run("blocked user not found", func(t *testing.T) {
+		// given
+		store.EXPECT().GetUser(ctx, int32(2)).Return(nil, ErrUserNotFound)
+
+		// when
+		err := userService.Block(ctx, 1, 2)
+
+		// then
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+
+	t.Run("successful block without match", func(t *testing.T) {
+		// given
+		store.EXPECT().GetUser(ctx, int32(2)).Return(NewFakeUser(faker), nil)
+		store.EXPECT().Block(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, b *Block) error {
+			require.Equal(t, int32(1), b.BlockerID)
+			require.Equal(t, int32(2), b.BlockedID)
+			return nil
+		})
+		store.EXPECT().GetMatch(ctx, "1-2").Return(nil, ErrMatchNotFound)
+
+		// when
+		err := userService.Block(ctx, 1, 2)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("successful block removes the match", func(t *testing.T) {
+		// given
+		match := NewMatch(1, 2, time.Now())
+		store.EXPECT().GetUser(ctx, int32(1)).Return(NewFakeUser(faker), nil)
+		store.EXPECT().Block(ctx, gomock.Any()).Return(nil)
+		store.EXPECT().GetMatch(ctx, "1-2").Return(match, nil)
+		store.EXPECT().Unmatch(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, u *Unmatch) error {
+			require.Equal(t, match.ID, u.MatchID)
+			require.Equal(t, int32(2), u.InitiatorID)
+			return nil
+		})
+
+		// when
+		err := userService.Block(ctx, 2, 1)
+
+		// then
+		require.NoError(t, err)
+	})
+}
+
+func TestService_Report(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	faker := gofakeit.New(10)
+	userService := NewService(faker, store)
+	ctx := context.Background()
+
+	t.Run("invalid report should return a validation error", func(t *testing.T) {
+		// when
+		_, err := userService.Report(ctx, &Report{ReporterID: 1, ReportedID: 1, Reason: "boring"})
+
+		// then
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Equal(t, []string{"id", "reason"}, sortedKeys(validationErr))
+	})
+
+	t.Run("other reason requires details", func(t *testing.T) {
+		// when
+		_, err := userService.Report(ctx, &Report{ReporterID: 1, ReportedID: 2, Reason: ReportReasonOther})
+
+		// then
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Equal(t, []string{"details"}, sortedKeys(validationErr))
+	})
+
+	t.Run("successful report is stored open", func(t *testing.T) {
+		// given
+		report := &Report{ReporterID: 1, ReportedID: 2, Reason: ReportReasonSpam, Details: "sends links"}
+		store.EXPECT().GetUser(ctx, int32(2)).Return(NewFakeUser(faker), nil)
+		store.EXPECT().CreateReport(ctx, report).DoAndReturn(func(_ context.Context, r *Report) (*Report, error) {
+			r.ID = 5
+			return r, nil
+		})
+
+		// when
+		createdReport, err := userService.Report(ctx, report)
+		require.NoError(t, err)
+
+		// then
+		require.Equal(t, int32(5), createdReport.ID)
+		require.Equal(t, ReportStatusOpen, createdReport.Status)
+		require.False(t, createdReport.CreatedAt.IsZero())
+	})
+}
+
+func TestService_Moderate(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	faker := gofakeit.New(10)
+	userService := NewService(faker, store)
+	ctx := context.Background()
+
+	t.Run("invalid moderation should return a validation error", func(t *testing.T) {
+		// given
+		past := time.Now().Add(-time.Hour)
+		moderation := &Moderation{UserID: 1, ModeratorID: 1, Status: ModerationStatusSuspended, Until: &past}
+
+		// when
+		_, err := userService.Moderate(ctx, moderation)
+
+		// then
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Equal(t, []string{"id", "reason", "until"}, sortedKeys(validationErr))
+	})
+
+	t.Run("ban cannot have an end", func(t *testing.T) {
+		// given
+		future := time.Now().Add(time.Hour)
+		moderation := &Moderation{UserID: 2, ModeratorID: 1, Status: ModerationStatusBanned, Reason: "spam", Until: &future}
+
+		// when
+		_, err := userService.Moderate(ctx, moderation)
+
+		// then
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Equal(t, []string{"until"}, sortedKeys(validationErr))
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		// given
+		moderation := &Moderation{UserID: 2, ModeratorID: 1, Status: ModerationStatusBanned, Reason: "spam"}
+		store.EXPECT().Moderate(ctx, moderation).Return(nil, ErrUserNotFound)
+
+		// when
+		_, err := userService.Moderate(ctx, moderation)
+
+		// then
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+
+	t.Run("successful ban", func(t *testing.T) {
+		// given
+		user := NewFakeUser(faker)
+		moderation := &Moderation{UserID: user.ID, ModeratorID: user.ID + 1, Status: ModerationStatusBanned, Reason: "spam"}
+		store.EXPECT().Moderate(ctx, moderation).DoAndReturn(func(_ context.Context, m *Moderation) (*User, error) {
+			user.Moderation = m
+			return user, nil
+		})
+
+		// when
+		bannedUser, err := userService.Moderate(ctx, moderation)
+		require.NoError(t, err)
+
+		// then
+		require.Empty(t, bannedUser.Password)
+		require.False(t, bannedUser.Moderation.CreatedAt.IsZero())
+		require.ErrorIs(t, bannedUser.moderationErr(time.Now()), ErrUserBanned)
+	})
+}
+
+func TestService_GetUserHistory(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	faker := gofakeit.New(10)
+	userService := NewService(faker, store)
+	ctx := context.Background()
+
+	t.Run("history gathers reports and moderations", func(t *testing.T) {
+		// given
+		user := NewFakeUser(faker)
+		received := []*Report{{ID: 2, ReporterID: 9, ReportedID: user.ID, Reason: ReportReasonSpam}}
+		filed := []*Report{{ID: 1, ReporterID: user.ID, ReportedID: 9, Reason: ReportReasonHarassment}}
+		moderations := []*Moderation{{UserID: user.ID, ModeratorID: 5, Status: ModerationStatusBanned, Reason: "spam"}}
+		store.EXPECT().GetUser(ctx, user.ID).Return(user, nil)
+		store.EXPECT().ListReports(ctx, &ReportFilter{ReportedID: user.ID, Limit: 1}).
+			Return(received, &ReportsCursor{ID: 2}, nil)
+		store.EXPECT().ListReports(ctx, &ReportFilter{ReporterID: user.ID, Limit: 1}).Return(filed, nil, nil)
+		store.EXPECT().GetModerations(ctx, user.ID).Return(moderations, nil)
+
+		// when
+		history, err := userService.GetUserHistory(ctx, user.ID, &HistoryQuery{Limit: 1})
+		require.NoError(t, err)
+
+		// then
+		require.Equal(t, &UserHistory{
+			User:                      user,
+			ReportsReceived:           received,
+			ReportsReceivedNextCursor: encodeCursor(&ReportsCursor{ID: 2}),
+			ReportsFiled:              filed,
+			Moderations:               moderations,
+		}, history)
+	})
 }
@@ -0,0 +1,280 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/muzzapp/date-api/internal/securetoken"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	recoveryCodes = 10
+	// totpPeriod is the length in seconds of a TOTP time step
+	totpPeriod = 30
+)
+
+type TwoFactorConfig struct {
+	// Issuer is the name shown by the authenticator apps
+	Issuer       string        `envconfig:"TWO_FACTOR_ISSUER" default:"date-api"`
+	ChallengeTTL time.Duration `envconfig:"TWO_FACTOR_CHALLENGE_TTL" default:"5m"`
+	// Key encrypts the TOTP secrets, 32 random bytes encoded in base64
+	Key string `envconfig:"TWO_FACTOR_KEY"`
+}
+
+const TokenPurposeTwoFactorLogin TokenPurpose = "two_factor_login"
+
+// TwoFactor is the TOTP setup of a user, it is only checked at login once Enabled by a first valid code.
+type TwoFactor struct {
+	// Secret is the TOTP secret sealed by the TwoFactorKey
+	Secret  string `bson:"secret"`
+	Enabled bool   `bson:"enabled"`
+	// RecoveryCodes are the hashes of the codes left, each one replaces a TOTP code once
+	RecoveryCodes []string   `bson:"recoveryCodes"`
+	EnabledAt     *time.Time `bson:"enabledAt,omitempty"`
+	// LastStep is the time step of the last TOTP code accepted, a code is only accepted for a later step
+	LastStep int64 `bson:"lastStep,omitempty"`
+}
+
+func (t *TwoFactor) enabled() bool {
+	return t != nil && t.Enabled
+}
+
+// TwoFactorEnrollment is returned once, the recovery codes are only stored hashed.
+type TwoFactorEnrollment struct {
+	URI           string
+	Secret        string
+	RecoveryCodes []string
+}
+
+// TwoFactorRequiredError is returned by Login when the password is right but a TOTP code is needed,
+// Challenge is exchanged with the code by LoginTwoFactor.
+type TwoFactorRequiredError struct {
+	Challenge string
+	ExpiresIn time.Duration
+}
+
+func (e *TwoFactorRequiredError) Error() string {
+	return "two factor code required"
+}
+
+func (e *TwoFactorRequiredError) Is(target error) bool {
+	return target == ErrTwoFactorRequired
+}
+
+// WithTwoFactor enables the TOTP login, the challenges are one time tokens and the secrets are sealed by key.
+func WithTwoFactor(challenges TokenStore, conf *TwoFactorConfig, key *TwoFactorKey) Option {
+	return func(s *Service) {
+		s.challenges = challenges
+		s.twoFactor = conf
+		s.twoFactorKey = key
+	}
+}
+
+// twoFactorErr tells whether the TOTP login is enabled.
+func (s *Service) twoFactorErr() error {
+	if s.twoFactor == nil {
+		return ErrTwoFactorDisabled
+	}
+	return nil
+}
+
+// EnrollTwoFactor generates a new TOTP secret and recovery codes for the user, replacing a pending enrollment.
+// The user must confirm it with a code before it is enabled.
+func (s *Service) EnrollTwoFactor(ctx context.Context, ID int32) (*TwoFactorEnrollment, error) {
+	if err := s.twoFactorErr(); err != nil {
+		return nil, err
+	}
+	user, err := s.store.GetUser(ctx, ID)
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("EnrollTwoFactor GetUser", "ID", ID, "err", err)
+		}
+		return nil, err
+	}
+	if user.TwoFactor.enabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: s.twoFactor.Issuer, AccountName: user.Email})
+	if err != nil {
+		slog.Error("EnrollTwoFactor Generate", "ID", ID, "err", err)
+		return nil, err
+	}
+	sealed, err := s.twoFactorKey.seal(ID, key.Secret())
+	if err != nil {
+		slog.Error("EnrollTwoFactor seal", "ID", ID, "err", err)
+		return nil, err
+	}
+	enrollment := &TwoFactorEnrollment{URI: key.URL(), Secret: key.Secret()}
+	twoFactor := &TwoFactor{Secret: sealed}
+	for range recoveryCodes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		enrollment.RecoveryCodes = append(enrollment.RecoveryCodes, code)
+		twoFactor.RecoveryCodes = append(twoFactor.RecoveryCodes, securetoken.Hash(normalizeRecoveryCode(code)))
+	}
+
+	if _, err = s.store.UpdateUser(ctx, ID, &UserUpdate{TwoFactor: twoFactor}); err != nil {
+		slog.Error("EnrollTwoFactor UpdateUser", "ID", ID, "err", err)
+		return nil, err
+	}
+	return enrollment, nil
+}
+
+// ConfirmTwoFactor enables the pending enrollment of the user once code proves the authenticator app is set up.
+func (s *Service) ConfirmTwoFactor(ctx context.Context, ID int32, code string) error {
+	if err := s.twoFactorErr(); err != nil {
+		return err
+	}
+	user, err := s.store.GetUser(ctx, ID)
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("ConfirmTwoFactor GetUser", "ID", ID, "err", err)
+		}
+		return err
+	}
+	switch {
+	case user.TwoFactor == nil:
+		return ErrTwoFactorNotEnrolled
+	case user.TwoFactor.Enabled:
+		return ErrTwoFactorEnabled
+	}
+	secret, err := s.twoFactorKey.open(ID, user.TwoFactor.Secret)
+	if err != nil {
+		slog.Error("ConfirmTwoFactor open", "ID", ID, "err", err)
+		return err
+	}
+	now := time.Now().UTC()
+	step, ok := matchTOTP(code, secret, now)
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	twoFactor := *user.TwoFactor
+	twoFactor.Enabled = true
+	twoFactor.EnabledAt = &now
+	twoFactor.LastStep = step
+	if _, err = s.store.UpdateUser(ctx, ID, &UserUpdate{TwoFactor: &twoFactor}); err != nil {
+		slog.Error("ConfirmTwoFactor UpdateUser", "ID", ID, "err", err)
+		return err
+	}
+	return nil
+}
+
+// LoginTwoFactor completes a login with the challenge returned by Login and a TOTP or recovery code. The
+// challenge is single use, a wrong code counts as a failed login and the password must be sent again.
+func (s *Service) LoginTwoFactor(ctx context.Context, challenge, code, ip string) (*User, error) {
+	if err := s.twoFactorErr(); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	token, err := s.challenges.UseOneTimeToken(ctx, securetoken.Hash(challenge), TokenPurposeTwoFactorLogin, now)
+	if err != nil {
+		if !errors.Is(err, ErrInvalidToken) {
+			slog.Error("LoginTwoFactor UseOneTimeToken", "err", err)
+		}
+		return nil, err
+	}
+	user, err := s.GetActiveUser(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	keys := s.lockoutKeys(user.Email, ip)
+	if err = s.checkLockout(ctx, keys, now); err != nil {
+		return nil, err
+	}
+
+	if err = s.checkTwoFactorCode(ctx, user, code, now); err != nil {
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			return nil, err
+		}
+		if failureErr := s.recordLoginFailure(ctx, keys, now); failureErr != nil {
+			return nil, failureErr
+		}
+		return nil, err
+	}
+	if err = s.resetLoginFailures(ctx, keys); err != nil {
+		return nil, err
+	}
+	user.TwoFactor = nil
+	return user, nil
+}
+
+// requireTwoFactor returns the TwoFactorRequiredError carrying a new challenge for LoginTwoFactor.
+func (s *Service) requireTwoFactor(ctx context.Context, user *User) error {
+	challenge, err := createOneTimeToken(ctx, s.challenges, user.ID, TokenPurposeTwoFactorLogin, s.twoFactor.ChallengeTTL)
+	if err != nil {
+		slog.Error("requireTwoFactor createOneTimeToken", "ID", user.ID, "err", err)
+		return err
+	}
+	return &TwoFactorRequiredError{Challenge: challenge, ExpiresIn: s.twoFactor.ChallengeTTL}
+}
+
+// checkTwoFactorCode accepts a TOTP code once, a replayed code is rejected like a wrong one.
+func (s *Service) checkTwoFactorCode(ctx context.Context, user *User, code string, now time.Time) error {
+	secret, err := s.twoFactorKey.open(user.ID, user.TwoFactor.Secret)
+	if err != nil {
+		slog.Error("checkTwoFactorCode open", "ID", user.ID, "err", err)
+		return err
+	}
+	if step, ok := matchTOTP(code, secret, now); ok {
+		if err := s.store.UseTOTPStep(ctx, user.ID, step); err != nil {
+			if !errors.Is(err, ErrInvalidTwoFactorCode) {
+				slog.Error("checkTwoFactorCode UseTOTPStep", "ID", user.ID, "err", err)
+			}
+			return err
+		}
+		return nil
+	}
+	hashed := securetoken.Hash(normalizeRecoveryCode(code))
+	if err := s.store.UseRecoveryCode(ctx, user.ID, hashed); err != nil {
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			slog.Error("checkTwoFactorCode UseRecoveryCode", "ID", user.ID, "err", err)
+		}
+		return err
+	}
+	slog.Info("recovery code used", "ID", user.ID)
+	return nil
+}
+
+// matchTOTP returns the time step of code, the codes of the steps before and after now are accepted too
+// for the clock skew of the devices.
+func matchTOTP(code, secret string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	current := now.Unix() / totpPeriod
+	for _, step := range []int64{current - 1, current, current + 1} {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), totp.ValidateOpts{
+			Period: totpPeriod,
+			Digits: otp.DigitsSix,
+		})
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// newRecoveryCode returns a code like abcd-efgh, easy to type back.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	return fmt.Sprintf("%s-%s", code[:4], code[4:]), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
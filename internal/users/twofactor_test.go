@@ -0,0 +1,301 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/muzzapp/date-api/internal/securetoken"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/require"
+)
+
+func newTwoFactorConfig(t *testing.T) (*TwoFactorConfig, *TwoFactorKey) {
+	t.Helper()
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	conf := &TwoFactorConfig{Issuer: "date-api", ChallengeTTL: 5 * time.Minute, Key: base64.StdEncoding.EncodeToString(b)}
+	key, err := NewTwoFactorKey(conf)
+	require.NoError(t, err)
+	return conf, key
+}
+
+func sealSecret(t *testing.T, key *TwoFactorKey, ID int32, secret string) string {
+	t.Helper()
+	sealed, err := key.seal(ID, secret)
+	require.NoError(t, err)
+	return sealed
+}
+
+func TestNewTwoFactorKey(t *testing.T) {
+	for _, key := range []string{"", "not base64", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		// when
+		_, err := NewTwoFactorKey(&TwoFactorConfig{Key: key})
+
+		// then
+		require.ErrorIs(t, err, errTwoFactorKey)
+	}
+}
+
+func TestTwoFactorKey(t *testing.T) {
+	// given
+	_, key := newTwoFactorConfig(t)
+	sealed := sealSecret(t, key, 7, "JBSWY3DPEHPK3PXP")
+
+	t.Run("sealed secret opens for its user", func(t *testing.T) {
+		// when
+		secret, err := key.open(7, sealed)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, "JBSWY3DPEHPK3PXP", secret)
+		require.NotContains(t, sealed, "JBSWY3DPEHPK3PXP")
+	})
+
+	t.Run("sealed secret does not open for another user", func(t *testing.T) {
+		// when
+		_, err := key.open(8, sealed)
+
+		// then
+		require.Error(t, err)
+	})
+}
+
+func TestService_EnrollTwoFactor(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	tokens := NewMockTokenStore(controller)
+	conf, twoFactorKey := newTwoFactorConfig(t)
+	userService := NewService(nil, store, WithTwoFactor(tokens, conf, twoFactorKey))
+	ctx := context.Background()
+
+	t.Run("already enabled", func(t *testing.T) {
+		// given
+		store.EXPECT().GetUser(ctx, int32(7)).Return(&User{ID: 7, TwoFactor: &TwoFactor{Enabled: true}}, nil)
+
+		// when
+		_, err := userService.EnrollTwoFactor(ctx, 7)
+
+		// then
+		require.ErrorIs(t, err, ErrTwoFactorEnabled)
+	})
+
+	t.Run("stores a pending secret and the hashed recovery codes", func(t *testing.T) {
+		// given
+		store.EXPECT().GetUser(ctx, int32(7)).Return(&User{ID: 7, Email: "jane@date.app"}, nil)
+		var stored *TwoFactor
+		store.EXPECT().UpdateUser(ctx, int32(7), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ int32, update *UserUpdate) (*User, error) {
+				stored = update.TwoFactor
+				return &User{ID: 7}, nil
+			})
+
+		// when
+		enrollment, err := userService.EnrollTwoFactor(ctx, 7)
+
+		// then
+		require.NoError(t, err)
+		require.Contains(t, enrollment.URI, "otpauth://totp/date-api:jane@date.app")
+		require.False(t, stored.Enabled)
+		secret, err := twoFactorKey.open(7, stored.Secret)
+		require.NoError(t, err)
+		require.Equal(t, enrollment.Secret, secret)
+		require.Len(t, enrollment.RecoveryCodes, recoveryCodes)
+		require.Len(t, stored.RecoveryCodes, recoveryCodes)
+		require.Equal(t, securetoken.Hash(normalizeRecoveryCode(enrollment.RecoveryCodes[0])), stored.RecoveryCodes[0])
+	})
+}
+
+func TestService_ConfirmTwoFactor(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	tokens := NewMockTokenStore(controller)
+	conf, twoFactorKey := newTwoFactorConfig(t)
+	userService := NewService(nil, store, WithTwoFactor(tokens, conf, twoFactorKey))
+	ctx := context.Background()
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "date-api", AccountName: "jane@date.app"})
+	require.NoError(t, err)
+	sealed := sealSecret(t, twoFactorKey, 7, key.Secret())
+
+	t.Run("not enrolled", func(t *testing.T) {
+		// given
+		store.EXPECT().GetUser(ctx, int32(7)).Return(&User{ID: 7}, nil)
+
+		// when
+		err := userService.ConfirmTwoFactor(ctx, 7, "123456")
+
+		// then
+		require.ErrorIs(t, err, ErrTwoFactorNotEnrolled)
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		// given
+		store.EXPECT().GetUser(ctx, int32(7)).Return(&User{ID: 7, TwoFactor: &TwoFactor{Secret: sealed}}, nil)
+
+		// when
+		err := userService.ConfirmTwoFactor(ctx, 7, "abcdef")
+
+		// then
+		require.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+	})
+
+	t.Run("valid code enables two factor", func(t *testing.T) {
+		// given
+		store.EXPECT().GetUser(ctx, int32(7)).Return(&User{ID: 7, TwoFactor: &TwoFactor{Secret: sealed}}, nil)
+		store.EXPECT().UpdateUser(ctx, int32(7), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ int32, update *UserUpdate) (*User, error) {
+				require.True(t, update.TwoFactor.Enabled)
+				require.NotNil(t, update.TwoFactor.EnabledAt)
+				require.Equal(t, sealed, update.TwoFactor.Secret)
+				require.NotZero(t, update.TwoFactor.LastStep)
+				return &User{ID: 7}, nil
+			})
+		code, err := totp.GenerateCode(key.Secret(), time.Now())
+		require.NoError(t, err)
+
+		// when
+		err = userService.ConfirmTwoFactor(ctx, 7, code)
+
+		// then
+		require.NoError(t, err)
+	})
+}
+
+func TestService_LoginTwoFactor(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := NewMockStore(controller)
+	tokens := NewMockTokenStore(controller)
+	conf, twoFactorKey := newTwoFactorConfig(t)
+	userService := NewService(nil, store, WithTwoFactor(tokens, conf, twoFactorKey))
+	ctx := context.Background()
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "date-api", AccountName: "jane@date.app"})
+	require.NoError(t, err)
+	sealed := sealSecret(t, twoFactorKey, 7, key.Secret())
+	newUser := func() *User {
+		return &User{
+			ID:            7,
+			Email:         "jane@date.app",
+			Password:      hashPassword("Sup3rSecret"),
+			EmailVerified: true,
+			TwoFactor:     &TwoFactor{Secret: sealed, Enabled: true},
+		}
+	}
+
+	t.Run("password login returns a challenge", func(t *testing.T) {
+		// given
+		store.EXPECT().GetUserByEmail(ctx, "jane@date.app").Return(newUser(), nil)
+		var stored *OneTimeToken
+		tokens.EXPECT().CreateOneTimeToken(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, token *OneTimeToken) error {
+			stored = token
+			return nil
+		})
+
+		// when
+		user, err := userService.Login(ctx, "jane@date.app", "Sup3rSecret", "")
+
+		// then
+		require.Nil(t, user)
+		var twoFactorErr *TwoFactorRequiredError
+		require.True(t, errors.As(err, &twoFactorErr))
+		require.ErrorIs(t, err, ErrTwoFactorRequired)
+		require.Equal(t, 5*time.Minute, twoFactorErr.ExpiresIn)
+		require.Equal(t, TokenPurposeTwoFactorLogin, stored.Purpose)
+		require.Equal(t, int32(7), stored.UserID)
+		require.Equal(t, securetoken.Hash(twoFactorErr.Challenge), stored.ID)
+	})
+
+	t.Run("invalid challenge", func(t *testing.T) {
+		// given
+		tokens.EXPECT().UseOneTimeToken(ctx, securetoken.Hash("challenge"), TokenPurposeTwoFactorLogin, gomock.Any()).
+			Return(nil, ErrInvalidToken)
+
+		// when
+		_, err := userService.LoginTwoFactor(ctx, "challenge", "123456", "")
+
+		// then
+		require.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("valid TOTP code", func(t *testing.T) {
+		// given
+		tokens.EXPECT().UseOneTimeToken(ctx, securetoken.Hash("challenge"), TokenPurposeTwoFactorLogin, gomock.Any()).
+			Return(&OneTimeToken{UserID: 7, Purpose: TokenPurposeTwoFactorLogin}, nil)
+		store.EXPECT().GetUser(ctx, int32(7)).Return(newUser(), nil)
+		now := time.Now()
+		code, err := totp.GenerateCode(key.Secret(), now)
+		require.NoError(t, err)
+		store.EXPECT().UseTOTPStep(ctx, int32(7), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ int32, step int64) error {
+				require.InDelta(t, now.Unix()/totpPeriod, step, 1)
+				return nil
+			})
+
+		// when
+		user, err := userService.LoginTwoFactor(ctx, "challenge", code, "")
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, int32(7), user.ID)
+		require.Equal(t, RoleUser, user.Role)
+		require.Nil(t, user.TwoFactor)
+	})
+
+	t.Run("replayed TOTP code", func(t *testing.T) {
+		// given
+		tokens.EXPECT().UseOneTimeToken(ctx, securetoken.Hash("challenge"), TokenPurposeTwoFactorLogin, gomock.Any()).
+			Return(&OneTimeToken{UserID: 7, Purpose: TokenPurposeTwoFactorLogin}, nil)
+		store.EXPECT().GetUser(ctx, int32(7)).Return(newUser(), nil)
+		code, err := totp.GenerateCode(key.Secret(), time.Now())
+		require.NoError(t, err)
+		store.EXPECT().UseTOTPStep(ctx, int32(7), gomock.Any()).Return(ErrInvalidTwoFactorCode)
+
+		// when
+		_, err = userService.LoginTwoFactor(ctx, "challenge", code, "")
+
+		// then
+		require.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+	})
+
+	t.Run("recovery code", func(t *testing.T) {
+		// given
+		tokens.EXPECT().UseOneTimeToken(ctx, securetoken.Hash("challenge"), TokenPurposeTwoFactorLogin, gomock.Any()).
+			Return(&OneTimeToken{UserID: 7, Purpose: TokenPurposeTwoFactorLogin}, nil)
+		store.EXPECT().GetUser(ctx, int32(7)).Return(newUser(), nil)
+		store.EXPECT().UseRecoveryCode(ctx, int32(7), securetoken.Hash("abcdefgh")).Return(nil)
+
+		// when
+		user, err := userService.LoginTwoFactor(ctx, "challenge", "ABCD-EFGH", "")
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, int32(7), user.ID)
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		// given
+		tokens.EXPECT().UseOneTimeToken(ctx, securetoken.Hash("challenge"), TokenPurposeTwoFactorLogin, gomock.Any()).
+			Return(&OneTimeToken{UserID: 7, Purpose: TokenPurposeTwoFactorLogin}, nil)
+		store.EXPECT().GetUser(ctx, int32(7)).Return(newUser(), nil)
+		store.EXPECT().UseRecoveryCode(ctx, int32(7), gomock.Any()).Return(ErrInvalidTwoFactorCode)
+
+		// when
+		_, err := userService.LoginTwoFactor(ctx, "challenge", "abcdef", "")
+
+		// then
+		require.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+	})
+}
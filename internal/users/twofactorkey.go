@@ -0,0 +1,60 @@
+package users
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strconv"
+)
+
+var errTwoFactorKey = errors.New("TWO_FACTOR_KEY must be 32 random bytes encoded in base64")
+
+// TwoFactorKey encrypts the TOTP secrets at rest with AES-256-GCM, a copy of the database does not give away the
+// secrets generating the codes.
+type TwoFactorKey struct {
+	aead cipher.AEAD
+}
+
+func NewTwoFactorKey(conf *TwoFactorConfig) (*TwoFactorKey, error) {
+	key, err := base64.StdEncoding.DecodeString(conf.Key)
+	if err != nil || len(key) != 32 {
+		return nil, errTwoFactorKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorKey{aead: aead}, nil
+}
+
+// seal encrypts the secret of the user, the user ID is authenticated so a secret cannot be copied to another user.
+func (k *TwoFactorKey) seal(ID int32, secret string) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := k.aead.Seal(nonce, nonce, []byte(secret), []byte(strconv.Itoa(int(ID))))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *TwoFactorKey) open(ID int32, sealed string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(b) < k.aead.NonceSize() {
+		return "", errors.New("sealed two factor secret too short")
+	}
+	nonce, ciphertext := b[:k.aead.NonceSize()], b[k.aead.NonceSize():]
+	secret, err := k.aead.Open(nil, nonce, ciphertext, []byte(strconv.Itoa(int(ID))))
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
@@ -0,0 +1,107 @@
+package users
+
+import (
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	minimumAge        = 18
+	maximumAge        = 100
+	minPasswordLength = 8
+	// bcrypt ignores everything after the 72nd byte
+	maxPasswordLength = 72
+	maxNameLength     = 100
+	maxBioLength      = 500
+
+	maxReportDetailsLength = 1000
+)
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func validateEmail(email string, errs ValidationError) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		errs["email"] = "must be a valid email address"
+	}
+}
+
+func validatePassword(password string, errs ValidationError) {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		errs["password"] = "must be between 8 and 72 characters"
+		return
+	}
+	var upper, lower, digit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	if !upper || !lower || !digit {
+		errs["password"] = "must contain an upper case letter, a lower case letter and a digit"
+	}
+}
+
+func validateName(name string, errs ValidationError) {
+	if name == "" || len(name) > maxNameLength {
+		errs["name"] = "must be between 1 and 100 characters"
+	}
+}
+
+func validateBio(bio string, errs ValidationError) {
+	if len(bio) > maxBioLength {
+		errs["bio"] = "must be at most 500 characters"
+	}
+}
+
+func validateGender(gender string, errs ValidationError) {
+	switch gender {
+	case "male", "female":
+	default:
+		errs["gender"] = "must be male or female"
+	}
+}
+
+func validateDOB(now, dob time.Time, errs ValidationError) {
+	if dob.IsZero() || dob.After(now) {
+		errs["dob"] = "must be a date in the past"
+		return
+	}
+	if calculateAge(now, dob) < minimumAge {
+		errs["dob"] = "must be at least 18 years old"
+	}
+}
+
+func validateAgeRange(minAge, maxAge int32, errs ValidationError) {
+	if minAge != 0 && (minAge < minimumAge || minAge > maximumAge) {
+		errs["minAge"] = "must be between 18 and 100"
+	}
+	if maxAge != 0 && (maxAge < minimumAge || maxAge > maximumAge) {
+		errs["maxAge"] = "must be between 18 and 100"
+	}
+	if minAge != 0 && maxAge != 0 && minAge > maxAge {
+		errs["maxAge"] = "must not be lower than minAge"
+	}
+}
+
+func validateCoordinates(c *Coordinates, errs ValidationError) {
+	if c == nil {
+		errs["location"] = "is required"
+		return
+	}
+	if c.Latitude < -90 || c.Latitude > 90 {
+		errs["location.latitude"] = "must be between -90 and 90"
+	}
+	if c.Longitude < -180 || c.Longitude > 180 {
+		errs["location.longitude"] = "must be between -180 and 180"
+	}
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+// AdminHandler serves the moderation endpoints, its routes must be restricted to admins.
+type AdminHandler struct {
+	service Admin
+}
+
+func NewAdminHandler(service Admin) *AdminHandler {
+	return &AdminHandler{service: service}
+}
+
+func (h *AdminHandler) ListReports() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r := new(ReportsRequest)
+		if err := c.QueryParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		r.validate()
+
+		result, err := h.service.ListReports(c.Context(), toReportsQuery(r))
+		if err != nil {
+			return sendError(c, err)
+		}
+		return c.JSON(toReportsResponse(result))
+	}
+}
+
+func (h *AdminHandler) GetUserHistory() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ID, err := userIDFromParams(c)
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		r := new(HistoryRequest)
+		if err = c.QueryParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		r.validate()
+
+		history, err := h.service.GetUserHistory(c.Context(), ID, &users.HistoryQuery{Limit: r.Limit})
+		if err != nil {
+			return sendError(c, err)
+		}
+		return c.JSON(toUserHistoryResponse(history))
+	}
+}
+
+func (h *AdminHandler) Suspend() fiber.Handler {
+	return h.moderate(users.ModerationStatusSuspended)
+}
+
+func (h *AdminHandler) Ban() fiber.Handler {
+	return h.moderate(users.ModerationStatusBanned)
+}
+
+// LiftBan reinstates a banned or suspended user.
+func (h *AdminHandler) LiftBan() fiber.Handler {
+	return h.moderate(users.ModerationStatusActive)
+}
+
+func (h *AdminHandler) moderate(status users.ModerationStatus) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		moderatorID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+		ID, err := userIDFromParams(c)
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		r := new(ModerationRequest)
+		if len(c.Body()) > 0 {
+			if err = c.BodyParser(r); err != nil {
+				return c.SendStatus(fiber.StatusBadRequest)
+			}
+		}
+
+		user, err := h.service.Moderate(c.Context(), toModeration(moderatorID, ID, status, r))
+		if err != nil {
+			return sendError(c, err)
+		}
+		return c.JSON(toAdminUserResponse(user))
+	}
+}
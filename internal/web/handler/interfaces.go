@@ -3,12 +3,46 @@ package handler
 import (
 	"context"
 
+	"github.com/muzzapp/date-api/internal/auth"
 	"github.com/muzzapp/date-api/internal/users"
 )
 
 type Users interface {
 	CreateUser(ctx context.Context) (*users.User, error)
-	Login(ctx context.Context, email, password string) (*users.User, error)
-	Discover(ctx context.Context, ID, minAge, maxAge int32, gender string, ranked bool) ([]*users.Profile, error)
+	Register(ctx context.Context, r *users.Registration) (*users.User, error)
+	GetUser(ctx context.Context, ID int32) (*users.User, error)
+	UpdateUser(ctx context.Context, ID int32, p *users.ProfileUpdate) (*users.User, error)
+	UpdateLocation(ctx context.Context, ID int32, c *users.Coordinates) (*users.User, error)
+	GetPreferences(ctx context.Context, ID int32) (*users.Preferences, error)
+	UpdatePreferences(ctx context.Context, ID int32, p *users.Preferences) (*users.Preferences, error)
+	Login(ctx context.Context, email, password, ip string) (*users.User, error)
+	Discover(ctx context.Context, ID int32, q *users.DiscoverQuery) (*users.DiscoverResult, error)
 	Swipe(ctx context.Context, ID, swipedID int32, ok bool) (bool, error)
+	GetMatches(ctx context.Context, ID int32, q *users.MatchesQuery) (*users.MatchesResult, error)
+	Unmatch(ctx context.Context, ID int32, matchID string) error
+	Block(ctx context.Context, ID, blockedID int32) error
+	Report(ctx context.Context, report *users.Report) (*users.Report, error)
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) (int32, error)
+	VerifyEmail(ctx context.Context, token string) error
+	ResendEmailVerification(ctx context.Context, email string) error
+	LoginTwoFactor(ctx context.Context, challenge, code, ip string) (*users.User, error)
+	EnrollTwoFactor(ctx context.Context, ID int32) (*users.TwoFactorEnrollment, error)
+	ConfirmTwoFactor(ctx context.Context, ID int32, code string) error
+	DeleteAccount(ctx context.Context, ID int32) error
+	ExportAccount(ctx context.Context, ID int32) (*users.AccountExport, error)
+}
+
+type Admin interface {
+	ListReports(ctx context.Context, q *users.ReportsQuery) (*users.ReportsResult, error)
+	GetUserHistory(ctx context.Context, ID int32, q *users.HistoryQuery) (*users.UserHistory, error)
+	Moderate(ctx context.Context, m *users.Moderation) (*users.User, error)
+}
+
+type Auth interface {
+	Issue(ctx context.Context, user *users.User) (*auth.Tokens, error)
+	Refresh(ctx context.Context, refreshToken string) (*auth.Tokens, error)
+	Logout(ctx context.Context, claims *auth.Claims, refreshToken string) error
+	JWKS() *auth.JWKS
+	RevokeSessions(ctx context.Context, ID int32) error
 }
@@ -1,10 +1,89 @@
 package handler
 
+import "time"
+
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	// ExpiresIn is the lifetime of Token in seconds
+	ExpiresIn int64 `json:"expiresIn"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// TwoFactorChallengeResponse is returned by login instead of the tokens when the user enabled two factor.
+type TwoFactorChallengeResponse struct {
+	ChallengeToken string `json:"challengeToken"`
+	// ExpiresIn is the lifetime of ChallengeToken in seconds
+	ExpiresIn int64 `json:"expiresIn"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	// Code is a TOTP code or a recovery code
+	Code string `json:"code"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorEnrollmentResponse struct {
+	Result *TwoFactorEnrollment `json:"result"`
+}
+
+type TwoFactorEnrollment struct {
+	URI           string   `json:"uri"`
+	Secret        string   `json:"secret"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type RegisterRequest struct {
+	Email    string    `json:"email"`
+	Password string    `json:"password"`
+	Name     string    `json:"name"`
+	Gender   string    `json:"gender"`
+	DOB      string    `json:"dob"`
+	Location *Location `json:"location"`
+}
+
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type ErrorResponse struct {
+	Errors map[string]string `json:"errors"`
+}
+
 type CreateUserResponse struct {
 	Result *User `json:"result"`
 }
@@ -12,17 +91,81 @@ type CreateUserResponse struct {
 type User struct {
 	ID       int32  `json:"id"`
 	Email    string `json:"email"`
-	Password string `json:"password"`
+	Password string `json:"password,omitempty"`
 	Name     string `json:"name"`
 	Gender   string `json:"gender"`
 	Age      int32  `json:"age"`
 }
 
+type UpdateMeRequest struct {
+	Name     *string   `json:"name"`
+	Gender   *string   `json:"gender"`
+	Bio      *string   `json:"bio"`
+	DOB      *string   `json:"dob"`
+	Location *Location `json:"location"`
+}
+
+type UpdateLocationRequest struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+}
+
+type MeResponse struct {
+	Result *Me `json:"result"`
+}
+
+type Me struct {
+	ID       int32     `json:"id"`
+	Email    string    `json:"email"`
+	Name     string    `json:"name"`
+	Gender   string    `json:"gender"`
+	Bio      string    `json:"bio"`
+	Age      int32     `json:"age"`
+	DOB      string    `json:"dob"`
+	Location *Location `json:"location"`
+
+	EmailVerified    bool `json:"emailVerified"`
+	TwoFactorEnabled bool `json:"twoFactorEnabled"`
+}
+
+type Preferences struct {
+	Genders     []string `json:"genders"`
+	MinAge      int32    `json:"minAge"`
+	MaxAge      int32    `json:"maxAge"`
+	MaxDistance float64  `json:"maxDistance"`
+	Unit        string   `json:"unit"`
+	Ranked      bool     `json:"ranked"`
+}
+
+type PreferencesResponse struct {
+	Result *Preferences `json:"result"`
+}
+
 type DiscoverRequest struct {
-	Gender string `query:"gender"`
-	MinAge int32  `query:"min-age"`
-	MaxAge int32  `query:"max-age"`
-	Ranked bool   `query:"ranked"`
+	Gender      string  `query:"gender"`
+	MinAge      int32   `query:"min-age"`
+	MaxAge      int32   `query:"max-age"`
+	Ranked      *bool   `query:"ranked"`
+	MaxDistance float64 `query:"max-distance"`
+	Unit        string  `query:"unit"`
+	Limit       int32   `query:"limit"`
+	Cursor      string  `query:"cursor"`
+}
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+func pageLimit(limit int32) int32 {
+	switch {
+	case limit <= 0:
+		return defaultPageLimit
+	case limit > maxPageLimit:
+		return maxPageLimit
+	default:
+		return limit
+	}
 }
 
 func (d *DiscoverRequest) validate() {
@@ -30,13 +173,22 @@ func (d *DiscoverRequest) validate() {
 		d.MinAge = 18
 	}
 	if d.MaxAge > 0 && d.MaxAge > 100 {
-		d.MinAge = 100
+		d.MaxAge = 100
 	}
+	d.Limit = pageLimit(d.Limit)
 	switch d.Gender {
 	case "", "male", "female":
 	default:
 		d.Gender = ""
 	}
+	if d.MaxDistance < 0 {
+		d.MaxDistance = 0
+	}
+	switch d.Unit {
+	case "", "km", "mi":
+	default:
+		d.Unit = ""
+	}
 }
 
 type Profile struct {
@@ -48,7 +200,9 @@ type Profile struct {
 }
 
 type DiscoverResponse struct {
-	Results []*Profile `json:"results"`
+	Results    []*Profile `json:"results"`
+	Unit       string     `json:"unit"`
+	NextCursor string     `json:"nextCursor,omitempty"`
 }
 
 type SwipeRequest struct {
@@ -64,3 +218,133 @@ type Swipe struct {
 	Matched   bool  `json:"matched"`
 	MatchedID int32 `json:"matchedID,omitempty"`
 }
+
+type MatchesRequest struct {
+	Limit  int32  `query:"limit"`
+	Cursor string `query:"cursor"`
+}
+
+func (m *MatchesRequest) validate() {
+	m.Limit = pageLimit(m.Limit)
+}
+
+type MatchesResponse struct {
+	Results    []*Match `json:"results"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+type Match struct {
+	ID        string          `json:"id"`
+	MatchedAt time.Time       `json:"matchedAt"`
+	Profile   *MatchedProfile `json:"profile"`
+}
+
+type MatchedProfile struct {
+	ID     int32  `json:"id"`
+	Name   string `json:"name"`
+	Gender string `json:"gender"`
+	Age    int32  `json:"age"`
+}
+
+type ReportRequest struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+type ReportResponse struct {
+	Result *Report `json:"result"`
+}
+
+type Report struct {
+	ID         int32     `json:"id"`
+	ReporterID int32     `json:"reporterID"`
+	ReportedID int32     `json:"reportedID"`
+	Reason     string    `json:"reason"`
+	Details    string    `json:"details"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// AccountExportResponse is the archive of every data kept about the requester.
+type AccountExportResponse struct {
+	ExportedAt  time.Time        `json:"exportedAt"`
+	Profile     *Me              `json:"profile"`
+	Preferences *Preferences     `json:"preferences"`
+	Swipes      []*ExportedSwipe `json:"swipes"`
+	Matches     []*Match         `json:"matches"`
+	Reports     []*Report        `json:"reports"`
+}
+
+type ExportedSwipe struct {
+	SwipedID  int32     `json:"id"`
+	Ok        bool      `json:"ok"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type ReportsRequest struct {
+	Status     string `query:"status"`
+	Reason     string `query:"reason"`
+	ReporterID int32  `query:"reporter-id"`
+	ReportedID int32  `query:"reported-id"`
+	Limit      int32  `query:"limit"`
+	Cursor     string `query:"cursor"`
+}
+
+func (r *ReportsRequest) validate() {
+	r.Limit = pageLimit(r.Limit)
+}
+
+type ReportsResponse struct {
+	Results    []*Report `json:"results"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+type ModerationRequest struct {
+	Reason string     `json:"reason"`
+	Until  *time.Time `json:"until"`
+}
+
+type Moderation struct {
+	ModeratorID int32      `json:"moderatorID"`
+	Status      string     `json:"status"`
+	Reason      string     `json:"reason"`
+	Until       *time.Time `json:"until,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+type AdminUser struct {
+	ID         int32       `json:"id"`
+	Email      string      `json:"email"`
+	Name       string      `json:"name"`
+	Gender     string      `json:"gender"`
+	Age        int32       `json:"age"`
+	Role       string      `json:"role"`
+	Moderation *Moderation `json:"moderation"`
+}
+
+type AdminUserResponse struct {
+	Result *AdminUser `json:"result"`
+}
+
+// HistoryRequest pages the reports received and filed, the next ones are listed by GET /admin/reports.
+type HistoryRequest struct {
+	Limit int32 `query:"limit"`
+}
+
+func (r *HistoryRequest) validate() {
+	r.Limit = pageLimit(r.Limit)
+}
+
+type UserHistory struct {
+	User                      *AdminUser    `json:"user"`
+	ReportsReceived           []*Report     `json:"reportsReceived"`
+	ReportsReceivedNextCursor string        `json:"reportsReceivedNextCursor,omitempty"`
+	ReportsFiled              []*Report     `json:"reportsFiled"`
+	ReportsFiledNextCursor    string        `json:"reportsFiledNextCursor,omitempty"`
+	Moderations               []*Moderation `json:"moderations"`
+}
+
+type UserHistoryResponse struct {
+	Result *UserHistory `json:"result"`
+}
@@ -1,6 +1,131 @@
 package handler
 
-import "github.com/muzzapp/date-api/internal/users"
+import (
+	"time"
+
+	"github.com/muzzapp/date-api/internal/auth"
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+const dateLayout = time.DateOnly
+
+func toRegistration(r *RegisterRequest) (*users.Registration, error) {
+	dob, err := time.Parse(dateLayout, r.DOB)
+	if err != nil {
+		return nil, users.ValidationError{"dob": "must be a date formatted as YYYY-MM-DD"}
+	}
+	return &users.Registration{
+		Email:    r.Email,
+		Password: r.Password,
+		Name:     r.Name,
+		Gender:   r.Gender,
+		DOB:      dob,
+		Location: toCoordinates(r.Location),
+	}, nil
+}
+
+func toProfileUpdate(r *UpdateMeRequest) (*users.ProfileUpdate, error) {
+	update := &users.ProfileUpdate{
+		Name:     r.Name,
+		Gender:   r.Gender,
+		Bio:      r.Bio,
+		Location: toCoordinates(r.Location),
+	}
+	if r.DOB != nil {
+		dob, err := time.Parse(dateLayout, *r.DOB)
+		if err != nil {
+			return nil, users.ValidationError{"dob": "must be a date formatted as YYYY-MM-DD"}
+		}
+		update.DOB = &dob
+	}
+	return update, nil
+}
+
+func toLocationCoordinates(r *UpdateLocationRequest) (*users.Coordinates, error) {
+	errs := users.ValidationError{}
+	if r.Latitude == nil {
+		errs["location.latitude"] = "is required"
+	}
+	if r.Longitude == nil {
+		errs["location.longitude"] = "is required"
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return &users.Coordinates{
+		Longitude: *r.Longitude,
+		Latitude:  *r.Latitude,
+	}, nil
+}
+
+func toMeResponse(u *users.User) *MeResponse {
+	if u == nil {
+		return nil
+	}
+	me := &Me{
+		ID:       u.ID,
+		Email:    u.Email,
+		Name:     u.Name,
+		Gender:   u.Gender,
+		Bio:      u.Bio,
+		Location: toLocation(u.Location),
+
+		EmailVerified:    u.EmailVerified,
+		TwoFactorEnabled: u.TwoFactor != nil && u.TwoFactor.Enabled,
+	}
+	if u.Age != nil {
+		me.Age = u.Age.Value
+		me.DOB = u.Age.DOB.Format(dateLayout)
+	}
+	return &MeResponse{Result: me}
+}
+
+func toLocation(l *users.Location) *Location {
+	if l == nil || l.Coordinates == nil {
+		return nil
+	}
+	return &Location{
+		Latitude:  l.Coordinates.Latitude,
+		Longitude: l.Coordinates.Longitude,
+	}
+}
+
+func toCoordinates(l *Location) *users.Coordinates {
+	if l == nil {
+		return nil
+	}
+	return &users.Coordinates{
+		Longitude: l.Longitude,
+		Latitude:  l.Latitude,
+	}
+}
+
+func toTokenResponse(t *auth.Tokens) *TokenResponse {
+	return &TokenResponse{
+		Token:        t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		ExpiresIn:    int64(t.ExpiresIn.Seconds()),
+	}
+}
+
+func toTwoFactorChallengeResponse(err *users.TwoFactorRequiredError) *TwoFactorChallengeResponse {
+	return &TwoFactorChallengeResponse{
+		ChallengeToken: err.Challenge,
+		ExpiresIn:      int64(err.ExpiresIn.Seconds()),
+	}
+}
+
+func toTwoFactorEnrollmentResponse(e *users.TwoFactorEnrollment) *TwoFactorEnrollmentResponse {
+	return &TwoFactorEnrollmentResponse{Result: &TwoFactorEnrollment{
+		URI:           e.URI,
+		Secret:        e.Secret,
+		RecoveryCodes: e.RecoveryCodes,
+	}}
+}
+
+func toErrorResponse(err users.ValidationError) *ErrorResponse {
+	return &ErrorResponse{Errors: err}
+}
 
 func toCreateUserResponse(u *users.User) *CreateUserResponse {
 	if u == nil {
@@ -18,9 +143,59 @@ func toCreateUserResponse(u *users.User) *CreateUserResponse {
 	}
 }
 
-func toDiscoverResponse(ps []*users.Profile) *DiscoverResponse {
+func toPreferences(p *Preferences) *users.Preferences {
+	return &users.Preferences{
+		Genders:     p.Genders,
+		MinAge:      p.MinAge,
+		MaxAge:      p.MaxAge,
+		MaxDistance: p.MaxDistance,
+		Unit:        users.DistanceUnit(p.Unit),
+		Ranked:      p.Ranked,
+	}
+}
+
+func toPreferencesResponse(p *users.Preferences) *PreferencesResponse {
+	if p == nil {
+		return nil
+	}
+	genders := p.Genders
+	if genders == nil {
+		genders = []string{}
+	}
+	return &PreferencesResponse{
+		Result: &Preferences{
+			Genders:     genders,
+			MinAge:      p.MinAge,
+			MaxAge:      p.MaxAge,
+			MaxDistance: p.MaxDistance,
+			Unit:        string(p.Unit),
+			Ranked:      p.Ranked,
+		},
+	}
+}
+
+func toDiscoverQuery(r *DiscoverRequest) *users.DiscoverQuery {
+	var genders []string
+	if r.Gender != "" {
+		genders = []string{r.Gender}
+	}
+	return &users.DiscoverQuery{
+		MinAge:      r.MinAge,
+		MaxAge:      r.MaxAge,
+		Genders:     genders,
+		Ranked:      r.Ranked,
+		MaxDistance: r.MaxDistance,
+		Unit:        users.DistanceUnit(r.Unit),
+		Limit:       r.Limit,
+		Cursor:      r.Cursor,
+	}
+}
+
+func toDiscoverResponse(r *users.DiscoverResult) *DiscoverResponse {
 	return &DiscoverResponse{
-		Results: toProfiles(ps),
+		Results:    toProfiles(r.Profiles),
+		Unit:       string(r.Unit),
+		NextCursor: r.NextCursor,
 	}
 }
 
@@ -44,3 +219,183 @@ func toProfile(p *users.Profile) *Profile {
 		DistanceFromMe: p.DistanceFromMe,
 	}
 }
+
+func toMatchesQuery(r *MatchesRequest) *users.MatchesQuery {
+	return &users.MatchesQuery{
+		Limit:  r.Limit,
+		Cursor: r.Cursor,
+	}
+}
+
+func toMatchesResponse(r *users.MatchesResult) *MatchesResponse {
+	matches := make([]*Match, len(r.Matches))
+	for i, m := range r.Matches {
+		matches[i] = toMatch(m)
+	}
+	return &MatchesResponse{
+		Results:    matches,
+		NextCursor: r.NextCursor,
+	}
+}
+
+func toMatch(m *users.Match) *Match {
+	match := &Match{
+		ID:        m.ID,
+		MatchedAt: m.CreatedAt,
+	}
+	if m.Profile != nil {
+		match.Profile = &MatchedProfile{
+			ID:     m.Profile.ID,
+			Name:   m.Profile.Name,
+			Gender: m.Profile.Gender,
+			Age:    m.Profile.Age,
+		}
+	}
+	return match
+}
+
+func toAccountExportResponse(e *users.AccountExport) *AccountExportResponse {
+	export := &AccountExportResponse{
+		ExportedAt: e.ExportedAt,
+		Swipes:     make([]*ExportedSwipe, len(e.Swipes)),
+		Matches:    make([]*Match, len(e.Matches)),
+		Reports:    toReportResults(e.Reports),
+	}
+	if me := toMeResponse(e.User); me != nil {
+		export.Profile = me.Result
+	}
+	if preferences := toPreferencesResponse(e.User.Preferences); preferences != nil {
+		export.Preferences = preferences.Result
+	}
+	for i, s := range e.Swipes {
+		export.Swipes[i] = &ExportedSwipe{
+			SwipedID:  s.SwipedID,
+			Ok:        s.OK,
+			CreatedAt: s.CreatedAt,
+			UpdatedAt: s.UpdatedAt,
+		}
+	}
+	for i, m := range e.Matches {
+		export.Matches[i] = toMatch(m)
+	}
+	return export
+}
+
+func toReport(reporterID, reportedID int32, r *ReportRequest) *users.Report {
+	return &users.Report{
+		ReporterID: reporterID,
+		ReportedID: reportedID,
+		Reason:     users.ReportReason(r.Reason),
+		Details:    r.Details,
+	}
+}
+
+func toReportResponse(r *users.Report) *ReportResponse {
+	if r == nil {
+		return nil
+	}
+	return &ReportResponse{Result: toReportResult(r)}
+}
+
+func toReportResult(r *users.Report) *Report {
+	return &Report{
+		ID:         r.ID,
+		ReporterID: r.ReporterID,
+		ReportedID: r.ReportedID,
+		Reason:     string(r.Reason),
+		Details:    r.Details,
+		Status:     string(r.Status),
+		CreatedAt:  r.CreatedAt,
+	}
+}
+
+func toReportResults(rs []*users.Report) []*Report {
+	reports := make([]*Report, len(rs))
+	for i, r := range rs {
+		reports[i] = toReportResult(r)
+	}
+	return reports
+}
+
+func toReportsQuery(r *ReportsRequest) *users.ReportsQuery {
+	return &users.ReportsQuery{
+		Status:     users.ReportStatus(r.Status),
+		Reason:     users.ReportReason(r.Reason),
+		ReporterID: r.ReporterID,
+		ReportedID: r.ReportedID,
+		Limit:      r.Limit,
+		Cursor:     r.Cursor,
+	}
+}
+
+func toReportsResponse(r *users.ReportsResult) *ReportsResponse {
+	return &ReportsResponse{
+		Results:    toReportResults(r.Reports),
+		NextCursor: r.NextCursor,
+	}
+}
+
+func toModeration(moderatorID, ID int32, status users.ModerationStatus, r *ModerationRequest) *users.Moderation {
+	return &users.Moderation{
+		UserID:      ID,
+		ModeratorID: moderatorID,
+		Status:      status,
+		Reason:      r.Reason,
+		Until:       r.Until,
+	}
+}
+
+func toModerationResult(m *users.Moderation) *Moderation {
+	if m == nil {
+		return nil
+	}
+	return &Moderation{
+		ModeratorID: m.ModeratorID,
+		Status:      string(m.Status),
+		Reason:      m.Reason,
+		Until:       m.Until,
+		CreatedAt:   m.CreatedAt,
+	}
+}
+
+func toAdminUser(u *users.User) *AdminUser {
+	user := &AdminUser{
+		ID:         u.ID,
+		Email:      u.Email,
+		Name:       u.Name,
+		Gender:     u.Gender,
+		Role:       string(u.Role),
+		Moderation: toModerationResult(u.Moderation),
+	}
+	if user.Role == "" {
+		user.Role = string(users.RoleUser)
+	}
+	if u.Age != nil {
+		user.Age = u.Age.Value
+	}
+	return user
+}
+
+func toAdminUserResponse(u *users.User) *AdminUserResponse {
+	if u == nil {
+		return nil
+	}
+	return &AdminUserResponse{Result: toAdminUser(u)}
+}
+
+func toUserHistoryResponse(h *users.UserHistory) *UserHistoryResponse {
+	moderations := make([]*Moderation, len(h.Moderations))
+	for i, m := range h.Moderations {
+		moderations[i] = toModerationResult(m)
+	}
+	return &UserHistoryResponse{
+		Result: &UserHistory{
+			User:                      toAdminUser(h.User),
+			ReportsReceived:           toReportResults(h.ReportsReceived),
+			ReportsReceivedNextCursor: h.ReportsReceivedNextCursor,
+			ReportsFiled:              toReportResults(h.ReportsFiled),
+			ReportsFiledNextCursor:    h.ReportsFiledNextCursor,
+			Moderations:               moderations,
+		},
+	}
+}
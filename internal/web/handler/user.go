@@ -2,20 +2,23 @@ package handler
 
 import (
 	"errors"
-	"time"
+	"fmt"
+	"math"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/muzzapp/date-api/internal/auth"
 	"github.com/muzzapp/date-api/internal/users"
+	"github.com/muzzapp/date-api/internal/web/middleware"
 )
 
 type UserHandler struct {
 	service Users
-	secret  string
+	auth    Auth
 }
 
-func NewUserHandler(secret string, service Users) *UserHandler {
-	return &UserHandler{service: service, secret: secret}
+func NewUserHandler(service Users, auth Auth) *UserHandler {
+	return &UserHandler{service: service, auth: auth}
 }
 
 func (h *UserHandler) Login() fiber.Handler {
@@ -28,30 +31,219 @@ func (h *UserHandler) Login() fiber.Handler {
 			return c.SendStatus(fiber.StatusBadRequest)
 		}
 
-		user, err := h.service.Login(c.Context(), r.Email, r.Password)
-		switch {
-		case errors.Is(err, users.ErrUserNotFound), errors.Is(err, users.ErrPasswordMismatch):
-			return c.SendStatus(fiber.StatusBadRequest)
-		case err != nil:
+		user, err := h.service.Login(c.Context(), r.Email, r.Password, c.IP())
+		var twoFactorErr *users.TwoFactorRequiredError
+		if errors.As(err, &twoFactorErr) {
+			return c.JSON(toTwoFactorChallengeResponse(twoFactorErr))
+		}
+		if err != nil {
+			return sendLoginError(c, err)
+		}
+
+		tokens, err := h.auth.Issue(c.Context(), user)
+		if err != nil {
 			return c.SendStatus(fiber.StatusInternalServerError)
 		}
 
-		token, err := h.generateToken(user.ID, user.Name)
+		return c.JSON(toTokenResponse(tokens))
+	}
+}
+
+// LoginTwoFactor exchanges the challenge returned by Login and a TOTP or recovery code for the tokens.
+func (h *UserHandler) LoginTwoFactor() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r := new(TwoFactorLoginRequest)
+		if err := c.BodyParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		if r.ChallengeToken == "" || r.Code == "" {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+
+		user, err := h.service.LoginTwoFactor(c.Context(), r.ChallengeToken, r.Code, c.IP())
+		if err != nil {
+			return sendLoginError(c, err)
+		}
+
+		tokens, err := h.auth.Issue(c.Context(), user)
 		if err != nil {
 			return c.SendStatus(fiber.StatusInternalServerError)
 		}
 
-		return c.JSON(fiber.Map{"token": token})
+		return c.JSON(toTokenResponse(tokens))
+	}
+}
+
+func sendLoginError(c *fiber.Ctx, err error) error {
+	var lockedErr *users.LoginLockedError
+	switch {
+	case errors.As(err, &lockedErr):
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+		return c.SendStatus(fiber.StatusTooManyRequests)
+	case errors.Is(err, users.ErrUserNotFound), errors.Is(err, users.ErrPasswordMismatch):
+		return c.SendStatus(fiber.StatusBadRequest)
+	default:
+		return sendError(c, err)
+	}
+}
+
+func (h *UserHandler) RefreshToken() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r := new(RefreshRequest)
+		if err := c.BodyParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		if r.RefreshToken == "" {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+
+		tokens, err := h.auth.Refresh(c.Context(), r.RefreshToken)
+		if err != nil {
+			return sendError(c, err)
+		}
+		return c.JSON(toTokenResponse(tokens))
+	}
+}
+
+// JWKS publishes the public keys verifying the access tokens for the other services.
+func (h *UserHandler) JWKS() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		return c.JSON(h.auth.JWKS())
+	}
+}
+
+// Logout revokes the access token of the request, and the session of the refresh token when one is sent.
+func (h *UserHandler) Logout() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r := new(LogoutRequest)
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(r); err != nil {
+				return c.SendStatus(fiber.StatusBadRequest)
+			}
+		}
+		claims, err := claimsFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+
+		if err = h.auth.Logout(c.Context(), claims, r.RefreshToken); err != nil {
+			return sendError(c, err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// ForgotPassword always answers 202 so it cannot be used to find out which emails are registered.
+func (h *UserHandler) ForgotPassword() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r := new(ForgotPasswordRequest)
+		if err := c.BodyParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		if r.Email == "" {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+
+		if err := h.service.ForgotPassword(c.Context(), r.Email); err != nil {
+			return sendError(c, err)
+		}
+		return c.SendStatus(fiber.StatusAccepted)
+	}
+}
+
+// ResetPassword sets the new password and logs the user out of every session.
+func (h *UserHandler) ResetPassword() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r := new(ResetPasswordRequest)
+		if err := c.BodyParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		if r.Token == "" {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+
+		ID, err := h.service.ResetPassword(c.Context(), r.Token, r.Password)
+		if err != nil {
+			return sendError(c, err)
+		}
+		if err = h.auth.RevokeSessions(c.Context(), ID); err != nil {
+			return sendError(c, err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
 	}
 }
 
-func (h *UserHandler) generateToken(ID int32, name string) (string, error) {
-	claims := jwt.MapClaims{
-		"id":   ID,
-		"name": name,
-		"exp":  time.Now().Local().Add(time.Hour * time.Duration(24)).Unix(),
+// EnrollTwoFactor starts the TOTP enrollment, it is enabled by ConfirmTwoFactor.
+func (h *UserHandler) EnrollTwoFactor() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requesterID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+
+		enrollment, err := h.service.EnrollTwoFactor(c.Context(), requesterID)
+		if err != nil {
+			return sendError(c, err)
+		}
+		return c.Status(fiber.StatusCreated).JSON(toTwoFactorEnrollmentResponse(enrollment))
+	}
+}
+
+func (h *UserHandler) ConfirmTwoFactor() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requesterID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+		r := new(TwoFactorCodeRequest)
+		if err = c.BodyParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		if r.Code == "" {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+
+		if err = h.service.ConfirmTwoFactor(c.Context(), requesterID, r.Code); err != nil {
+			return sendError(c, err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+func (h *UserHandler) VerifyEmail() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r := new(VerifyEmailRequest)
+		if err := c.BodyParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		if r.Token == "" {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+
+		if err := h.service.VerifyEmail(c.Context(), r.Token); err != nil {
+			return sendError(c, err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// ResendEmailVerification always answers 202 once the email is given, like ForgotPassword.
+func (h *UserHandler) ResendEmailVerification() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r := new(ResendVerificationRequest)
+		if err := c.BodyParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		if r.Email == "" {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+
+		if err := h.service.ResendEmailVerification(c.Context(), r.Email); err != nil {
+			return sendError(c, err)
+		}
+		return c.SendStatus(fiber.StatusAccepted)
 	}
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(h.secret))
 }
 
 func (h *UserHandler) CreateUser() fiber.Handler {
@@ -64,6 +256,159 @@ func (h *UserHandler) CreateUser() fiber.Handler {
 	}
 }
 
+func (h *UserHandler) Register() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r := new(RegisterRequest)
+		if err := c.BodyParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		registration, err := toRegistration(r)
+		if err != nil {
+			return sendError(c, err)
+		}
+
+		user, err := h.service.Register(c.Context(), registration)
+		if err != nil {
+			return sendError(c, err)
+		}
+		return c.Status(fiber.StatusCreated).JSON(toCreateUserResponse(user))
+	}
+}
+
+func (h *UserHandler) GetMe() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requesterID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+		user, err := h.service.GetUser(c.Context(), requesterID)
+		if err != nil {
+			return sendError(c, err)
+		}
+		return c.JSON(toMeResponse(user))
+	}
+}
+
+// DeleteMe soft deletes the account of the requester and logs them out of every session.
+func (h *UserHandler) DeleteMe() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, err := claimsFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+		requesterID, err := claims.UserID()
+		if err != nil {
+			return sendError(c, err)
+		}
+
+		if err = h.service.DeleteAccount(c.Context(), requesterID); err != nil {
+			return sendError(c, err)
+		}
+		if err = h.auth.RevokeSessions(c.Context(), requesterID); err != nil {
+			return sendError(c, err)
+		}
+		if err = h.auth.Logout(c.Context(), claims, ""); err != nil {
+			return sendError(c, err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// ExportMe returns the data kept about the requester as a JSON file.
+func (h *UserHandler) ExportMe() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requesterID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+
+		export, err := h.service.ExportAccount(c.Context(), requesterID)
+		if err != nil {
+			return sendError(c, err)
+		}
+		c.Attachment(fmt.Sprintf("date-api-export-%d.json", requesterID))
+		return c.JSON(toAccountExportResponse(export))
+	}
+}
+
+func (h *UserHandler) UpdateMe() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r := new(UpdateMeRequest)
+		if err := c.BodyParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		requesterID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+		update, err := toProfileUpdate(r)
+		if err != nil {
+			return sendError(c, err)
+		}
+
+		user, err := h.service.UpdateUser(c.Context(), requesterID, update)
+		if err != nil {
+			return sendError(c, err)
+		}
+		return c.JSON(toMeResponse(user))
+	}
+}
+
+func (h *UserHandler) UpdateLocation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r := new(UpdateLocationRequest)
+		if err := c.BodyParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		requesterID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+		coordinates, err := toLocationCoordinates(r)
+		if err != nil {
+			return sendError(c, err)
+		}
+
+		user, err := h.service.UpdateLocation(c.Context(), requesterID, coordinates)
+		if err != nil {
+			return sendError(c, err)
+		}
+		return c.JSON(toMeResponse(user))
+	}
+}
+
+func (h *UserHandler) GetPreferences() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requesterID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+		preferences, err := h.service.GetPreferences(c.Context(), requesterID)
+		if err != nil {
+			return sendError(c, err)
+		}
+		return c.JSON(toPreferencesResponse(preferences))
+	}
+}
+
+func (h *UserHandler) UpdatePreferences() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r := new(Preferences)
+		if err := c.BodyParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		requesterID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+		preferences, err := h.service.UpdatePreferences(c.Context(), requesterID, toPreferences(r))
+		if err != nil {
+			return sendError(c, err)
+		}
+		return c.JSON(toPreferencesResponse(preferences))
+	}
+}
+
 func (h *UserHandler) Discover() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		r := new(DiscoverRequest)
@@ -72,12 +417,15 @@ func (h *UserHandler) Discover() fiber.Handler {
 		}
 		r.validate()
 
-		requesterID := userIDFromToken(c)
-		profiles, err := h.service.Discover(c.Context(), requesterID, r.MinAge, r.MaxAge, r.Gender, r.Ranked)
+		requesterID, err := userIDFromToken(c)
 		if err != nil {
-			return c.SendStatus(fiber.StatusInternalServerError)
+			return sendError(c, err)
+		}
+		result, err := h.service.Discover(c.Context(), requesterID, toDiscoverQuery(r))
+		if err != nil {
+			return sendError(c, err)
 		}
-		return c.JSON(toDiscoverResponse(profiles))
+		return c.JSON(toDiscoverResponse(result))
 	}
 }
 
@@ -87,7 +435,10 @@ func (h *UserHandler) Swipe() fiber.Handler {
 		if err := c.BodyParser(r); err != nil {
 			return c.SendStatus(fiber.StatusBadRequest)
 		}
-		requesterID := userIDFromToken(c)
+		requesterID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
 		ok, err := h.service.Swipe(c.Context(), requesterID, r.SwipedID, r.Ok)
 		switch {
 		case errors.Is(err, users.ErrUserNotFound):
@@ -107,8 +458,130 @@ func (h *UserHandler) Swipe() fiber.Handler {
 	}
 }
 
-func userIDFromToken(c *fiber.Ctx) int32 {
-	user := c.Locals("user").(*jwt.Token)
-	claims := user.Claims.(jwt.MapClaims)
-	return int32(claims["id"].(float64))
+func (h *UserHandler) GetMatches() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r := new(MatchesRequest)
+		if err := c.QueryParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		r.validate()
+
+		requesterID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+		result, err := h.service.GetMatches(c.Context(), requesterID, toMatchesQuery(r))
+		if err != nil {
+			return sendError(c, err)
+		}
+		return c.JSON(toMatchesResponse(result))
+	}
+}
+
+func (h *UserHandler) Unmatch() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requesterID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+		if err = h.service.Unmatch(c.Context(), requesterID, c.Params("id")); err != nil {
+			return sendError(c, err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+func (h *UserHandler) Block() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requesterID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+		blockedID, err := userIDFromParams(c)
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		if err = h.service.Block(c.Context(), requesterID, blockedID); err != nil {
+			return sendError(c, err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+func (h *UserHandler) Report() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requesterID, err := userIDFromToken(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+		reportedID, err := userIDFromParams(c)
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		r := new(ReportRequest)
+		if err = c.BodyParser(r); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+
+		report, err := h.service.Report(c.Context(), toReport(requesterID, reportedID, r))
+		if err != nil {
+			return sendError(c, err)
+		}
+		return c.Status(fiber.StatusCreated).JSON(toReportResponse(report))
+	}
+}
+
+// sendError maps the business errors shared by several endpoints to their HTTP status.
+func sendError(c *fiber.Ctx, err error) error {
+	var validationErr users.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return c.Status(fiber.StatusBadRequest).JSON(toErrorResponse(validationErr))
+	case errors.Is(err, users.ErrInvalidCursor):
+		return c.SendStatus(fiber.StatusBadRequest)
+	case errors.Is(err, users.ErrInvalidToken):
+		return c.Status(fiber.StatusBadRequest).JSON(toErrorResponse(users.ValidationError{"token": err.Error()}))
+	case errors.Is(err, users.ErrInvalidTwoFactorCode):
+		return c.Status(fiber.StatusBadRequest).JSON(toErrorResponse(users.ValidationError{"code": "is invalid"}))
+	case errors.Is(err, auth.ErrInvalidRefreshToken), errors.Is(err, auth.ErrInvalidClaims):
+		return c.SendStatus(fiber.StatusUnauthorized)
+	case errors.Is(err, users.ErrEmailTaken), errors.Is(err, users.ErrTwoFactorEnabled),
+		errors.Is(err, users.ErrTwoFactorNotEnrolled):
+		return c.SendStatus(fiber.StatusConflict)
+	case errors.Is(err, users.ErrUserBanned), errors.Is(err, users.ErrUserSuspended),
+		errors.Is(err, users.ErrEmailNotVerified):
+		return c.SendStatus(fiber.StatusForbidden)
+	case errors.Is(err, users.ErrUserNotFound), errors.Is(err, users.ErrMatchNotFound):
+		return c.SendStatus(fiber.StatusNotFound)
+	case errors.Is(err, users.ErrAccountRecoveryDisabled), errors.Is(err, users.ErrTwoFactorDisabled):
+		return c.SendStatus(fiber.StatusNotImplemented)
+	default:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
+
+func userIDFromParams(c *fiber.Ctx) (int32, error) {
+	ID, err := strconv.ParseInt(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return int32(ID), nil
+}
+
+// claimsFromToken returns the claims verified by middleware.Authentication, they are missing on the routes
+// served without it.
+func claimsFromToken(c *fiber.Ctx) (*auth.Claims, error) {
+	claims, ok := middleware.Claims(c)
+	if !ok {
+		return nil, auth.ErrInvalidClaims
+	}
+	return claims, nil
+}
+
+func userIDFromToken(c *fiber.Ctx) (int32, error) {
+	claims, err := claimsFromToken(c)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID()
 }
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/muzzapp/date-api/internal/users"
+)
+
+// Admin only lets through the tokens with the admin role, it must run after Authentication.
+func Admin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := Claims(c)
+		if !ok {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		if !claims.HasRole(users.RoleAdmin) {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+		return c.Next()
+	}
+}
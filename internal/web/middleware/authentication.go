@@ -1,12 +1,55 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/muzzapp/date-api/internal/auth"
+	"github.com/muzzapp/date-api/internal/users"
 )
 
-func Authentication(secret string) fiber.Handler {
+// Verifier picks the key verifying a token signature and verifies its claims once the signature is valid.
+type Verifier interface {
+	Keyfunc(token *jwt.Token) (interface{}, error)
+	Verify(ctx context.Context, claims *auth.Claims) error
+}
+
+// Authentication verifies the token signature and expiry, then its claims: a token from another issuer or
+// audience, without a subject or an ID, or revoked is rejected with a 401, as is the token of a deleted user.
+// The token of a user who may no longer log in, like a banned or suspended one, is rejected with a 403.
+func Authentication(verifier Verifier) fiber.Handler {
 	return jwtware.New(jwtware.Config{
-		SigningKey: jwtware.SigningKey{Key: []byte(secret)},
+		KeyFunc: verifier.Keyfunc,
+		Claims:  &auth.Claims{},
+		SuccessHandler: func(c *fiber.Ctx) error {
+			claims, ok := Claims(c)
+			if !ok {
+				return c.SendStatus(fiber.StatusUnauthorized)
+			}
+			err := verifier.Verify(c.Context(), claims)
+			switch {
+			case errors.Is(err, auth.ErrInvalidClaims), errors.Is(err, auth.ErrTokenRevoked):
+				return c.SendStatus(fiber.StatusUnauthorized)
+			case errors.Is(err, users.ErrUserBanned), errors.Is(err, users.ErrUserSuspended),
+				errors.Is(err, users.ErrEmailNotVerified):
+				return c.SendStatus(fiber.StatusForbidden)
+			case err != nil:
+				return c.SendStatus(fiber.StatusInternalServerError)
+			}
+			return c.Next()
+		},
 	})
 }
+
+// Claims returns the claims of the token parsed by Authentication.
+func Claims(c *fiber.Ctx) (*auth.Claims, bool) {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := token.Claims.(*auth.Claims)
+	return claims, ok
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/muzzapp/date-api/internal/auth"
+	"github.com/muzzapp/date-api/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthentication(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// setUp
+	store := auth.NewMockStore(controller)
+	userService := auth.NewMockUsers(controller)
+	conf := &auth.Config{Secret: "secret", Issuer: "date-api", Audience: "date-api", AccessTokenTTL: time.Minute}
+	keys, err := auth.NewKeySet(conf)
+	require.NoError(t, err)
+	authService := auth.NewService(conf, keys, store, userService)
+	app := fiber.New()
+	app.Use(Authentication(authService))
+	app.Get("/matches", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	app.Get("/admin/reports", Admin(), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	ctx := context.Background()
+	issue := func(user *users.User) string {
+		store.EXPECT().CreateRefreshToken(ctx, gomock.Any()).Return(nil)
+		tokens, err := authService.Issue(ctx, user)
+		require.NoError(t, err)
+		return tokens.AccessToken
+	}
+	get := func(path, token string) int {
+		req := httptest.NewRequest(fiber.MethodGet, path, nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	t.Run("token of an active user is accepted", func(t *testing.T) {
+		// given
+		user := &users.User{ID: 1, Role: users.RoleUser}
+		token := issue(user)
+		store.EXPECT().IsAccessTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil)
+		userService.EXPECT().GetActiveUser(gomock.Any(), user.ID).Return(user, nil)
+
+		// when
+		status := get("/matches", token)
+
+		// then
+		require.Equal(t, fiber.StatusOK, status)
+	})
+
+	t.Run("token issued before a ban is refused", func(t *testing.T) {
+		// given
+		token := issue(&users.User{ID: 2, Role: users.RoleUser})
+		store.EXPECT().IsAccessTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil)
+		userService.EXPECT().GetActiveUser(gomock.Any(), int32(2)).Return(nil, users.ErrUserBanned)
+
+		// when
+		status := get("/matches", token)
+
+		// then
+		require.Equal(t, fiber.StatusForbidden, status)
+	})
+
+	t.Run("token issued before a demotion loses the admin role", func(t *testing.T) {
+		// given
+		token := issue(&users.User{ID: 3, Role: users.RoleAdmin})
+		store.EXPECT().IsAccessTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil)
+		userService.EXPECT().GetActiveUser(gomock.Any(), int32(3)).Return(&users.User{ID: 3, Role: users.RoleUser}, nil)
+
+		// when
+		status := get("/admin/reports", token)
+
+		// then
+		require.Equal(t, fiber.StatusForbidden, status)
+	})
+}
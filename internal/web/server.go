@@ -2,10 +2,12 @@ package web
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	fiberv2 "github.com/gofiber/fiber/v2"
+	"github.com/muzzapp/date-api/internal/auth"
 	"github.com/muzzapp/date-api/internal/config"
 	"github.com/muzzapp/date-api/internal/users"
 	"github.com/muzzapp/date-api/internal/web/handler"
@@ -14,10 +16,15 @@ import (
 )
 
 type Config struct {
-	Port         int    `envconfig:"PORT" default:"80"`
-	ReadTimeout  int    `envconfig:"READ_TIMEOUT" default:"80"`
-	WriteTimeout int    `envconfig:"WRITE_TIMEOUT" default:"80"`
-	Secret       string `envconfig:"SECRET"`
+	Port         int `envconfig:"PORT" default:"80"`
+	ReadTimeout  int `envconfig:"READ_TIMEOUT" default:"80"`
+	WriteTimeout int `envconfig:"WRITE_TIMEOUT" default:"80"`
+	// ProxyHeader is the header holding the client IP when running behind a proxy, like X-Forwarded-For
+	ProxyHeader string `envconfig:"PROXY_HEADER"`
+	// TrustedProxies are the IPs or CIDR ranges of the proxies, ProxyHeader is ignored on requests from elsewhere
+	TrustedProxies []string `envconfig:"TRUSTED_PROXIES"`
+	// FakeUsers enables the faker based /user/create route used to seed the database
+	FakeUsers bool `envconfig:"FAKE_USERS" default:"true"`
 }
 
 type Server struct {
@@ -25,29 +32,68 @@ type Server struct {
 	port string
 }
 
-func New(userService *users.Service) (*Server, error) {
+func New(userService *users.Service, authService *auth.Service) (*Server, error) {
 	// Validate environment variables.
 	c := &Config{}
 	if err := config.Load(c); err != nil {
 		return nil, err
 	}
+	if c.ProxyHeader != "" && len(c.TrustedProxies) == 0 {
+		return nil, errors.New("PROXY_HEADER requires TRUSTED_PROXIES")
+	}
 
 	srv := fiberv2.New(fiberv2.Config{
-		AppName:      "date-api",
-		ReadTimeout:  time.Duration(c.ReadTimeout) * time.Second,
-		WriteTimeout: time.Duration(c.WriteTimeout) * time.Second,
+		AppName:                 "date-api",
+		ReadTimeout:             time.Duration(c.ReadTimeout) * time.Second,
+		WriteTimeout:            time.Duration(c.WriteTimeout) * time.Second,
+		ProxyHeader:             c.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          c.TrustedProxies,
 	})
 
-	userHandler := handler.NewUserHandler(c.Secret, userService)
+	userHandler := handler.NewUserHandler(userService, authService)
+	adminHandler := handler.NewAdminHandler(userService)
 
 	// open
 	srv.Post("/login", userHandler.Login())
-	srv.Post("/user/create", userHandler.CreateUser())
+	srv.Post("/login/2fa", userHandler.LoginTwoFactor())
+	srv.Post("/token/refresh", userHandler.RefreshToken())
+	srv.Get("/.well-known/jwks.json", userHandler.JWKS())
+	srv.Post("/users", userHandler.Register())
+	srv.Post("/password/forgot", userHandler.ForgotPassword())
+	srv.Post("/password/reset", userHandler.ResetPassword())
+	srv.Post("/email/verify", userHandler.VerifyEmail())
+	srv.Post("/email/verify/resend", userHandler.ResendEmailVerification())
+	if c.FakeUsers {
+		srv.Post("/user/create", userHandler.CreateUser())
+	}
 
 	// restricted
-	srv.Use(middleware.Authentication(c.Secret))
+	srv.Use(middleware.Authentication(authService))
+	srv.Post("/logout", userHandler.Logout())
+	srv.Get("/me", userHandler.GetMe())
+	srv.Patch("/me", userHandler.UpdateMe())
+	srv.Delete("/me", userHandler.DeleteMe())
+	srv.Get("/me/export", userHandler.ExportMe())
+	srv.Put("/me/location", userHandler.UpdateLocation())
+	srv.Get("/me/preferences", userHandler.GetPreferences())
+	srv.Put("/me/preferences", userHandler.UpdatePreferences())
+	srv.Post("/me/2fa", userHandler.EnrollTwoFactor())
+	srv.Post("/me/2fa/confirm", userHandler.ConfirmTwoFactor())
 	srv.Get("/discover", userHandler.Discover())
 	srv.Post("/swipe", userHandler.Swipe())
+	srv.Get("/matches", userHandler.GetMatches())
+	srv.Delete("/matches/:id", userHandler.Unmatch())
+	srv.Post("/users/:id/block", userHandler.Block())
+	srv.Post("/users/:id/report", userHandler.Report())
+
+	// admin
+	admin := srv.Group("/admin", middleware.Admin())
+	admin.Get("/reports", adminHandler.ListReports())
+	admin.Get("/users/:id/history", adminHandler.GetUserHistory())
+	admin.Post("/users/:id/suspend", adminHandler.Suspend())
+	admin.Post("/users/:id/ban", adminHandler.Ban())
+	admin.Delete("/users/:id/ban", adminHandler.LiftBan())
 
 	return &Server{srv: srv, port: fmt.Sprintf(":%d", c.Port)}, nil
 }